@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/admin"
+	"tcp-load-balancer/internal/balancer"
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/config"
+	"tcp-load-balancer/internal/health"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+)
+
+// limiters restrict the connections of clients to one or more frontends.
+type limiters struct {
+	conn *server.ConnectionLimiter
+	rate *server.RateLimiter
+}
+
+// newLimiters returns limiters which enforce the configured limits.
+func newLimiters(limits config.Limits) limiters {
+	return limiters{
+		conn: server.NewConnectionLimiter(limits.MaxConnectionsPerClient, limits.ClientConnectionOverrides),
+		rate: server.NewRateLimiter(
+			rate(limits.PerClientRate),
+			rate(limits.GlobalRate),
+			time.Duration(limits.RateLimiterIdleTTL),
+			clock.Real{},
+		),
+	}
+}
+
+// newFrontend returns a load balancer which serves the listener as described by the configuration, with the hosts,
+// policy, limits and retries of the configuration already applied. Unless the listener has limits of its own, it
+// enforces the shared limiters. The load balancer is listening, but does not accept connections until it is run.
+func newFrontend(cfg *config.File, listener config.Listener, shared limiters, extra ...server.Option) (*server.LoadBalancer, error) {
+	opts, err := serverOptions(cfg, listener, shared)
+	if err != nil {
+		return nil, err
+	}
+
+	lb, err := server.New(listener.Network, listener.Address, time.Duration(cfg.Timeouts.Host), append(opts, extra...)...)
+	if err != nil {
+		return nil, fmt.Errorf("listener %q: %w", listener.Name, err)
+	}
+
+	s, err := settings(cfg, listener, nil, lb.Logger())
+	if err == nil {
+		_, err = lb.Reconfigure(s)
+	}
+	if err != nil {
+		lb.Shutdown(context.Background())
+		return nil, fmt.Errorf("listener %q: %w", listener.Name, err)
+	}
+	return lb, nil
+}
+
+// serverOptions returns the options of a load balancer which serves the listener as described by the configuration.
+// Settings which can change while the load balancer runs are applied afterwards with Reconfigure.
+func serverOptions(cfg *config.File, listener config.Listener, shared limiters) ([]server.Option, error) {
+	if listener.Limits != nil {
+		shared = newLimiters(*listener.Limits)
+	}
+	opts := []server.Option{
+		server.WithName(listener.Name),
+		server.WithHandshakeTimeout(time.Duration(cfg.Timeouts.Handshake)),
+		server.WithConnectionLimiter(shared.conn),
+		server.WithRateLimiter(shared.rate),
+	}
+
+	if listener.TLS != nil {
+		certificate, clientCAs, err := listener.TLS.Load()
+		if err != nil {
+			return nil, fmt.Errorf("listener %q: %w", listener.Name, err)
+		}
+		opts = append(opts, server.WithMutualTLS(certificate, clientCAs))
+
+		if listener.TLS.IdentitySource != "" {
+			source, err := identity.ParseSource(listener.TLS.IdentitySource)
+			if err != nil {
+				return nil, fmt.Errorf("listener %q: %w", listener.Name, err)
+			}
+			opts = append(opts, server.WithIdentitySource(source))
+		}
+	}
+
+	b, err := balancer.New(listener.Strategy)
+	if err != nil {
+		return nil, fmt.Errorf("listener %q: %w", listener.Name, err)
+	}
+	opts = append(opts, server.WithBalancer(b))
+
+	if listener.StickyTTL > 0 {
+		opts = append(opts, server.WithStickySessions(server.NewStickyTable(time.Duration(listener.StickyTTL), server.DefaultStickyMaxEntries, clock.Real{})))
+	}
+
+	return opts, nil
+}
+
+// settings returns the settings of a running load balancer which serves the listener as described by the
+// configuration. The unlisted hosts are load balanced after the hosts of the listener's pool, unless the pool lists
+// a host with the same ID. The limits are those of the listener, or the top-level limits if it has none of its own.
+// The hosts of the pool log to logger.
+func settings(cfg *config.File, listener config.Listener, unlisted []*upstream.TcpHost, logger *logging.Logger) (server.Settings, error) {
+	pool, _ := cfg.Pool(listener.Pool)
+	hosts := make([]*upstream.TcpHost, 0, len(pool.Hosts)+len(unlisted))
+	for _, h := range pool.Hosts {
+		host, err := upstream.New(h.Address, listener.Network,
+			upstream.WithPool(pool.Name),
+			upstream.WithWeight(h.Weight),
+			upstream.WithLabels(h.Labels),
+			upstream.WithLogger(logger),
+		)
+		if err != nil {
+			return server.Settings{}, fmt.Errorf("pool %q: %w", pool.Name, err)
+		}
+		hosts = append(hosts, host)
+	}
+	listed := hostIDs(hosts)
+	for _, h := range unlisted {
+		if !listed[h.ID()] {
+			hosts = append(hosts, h)
+		}
+	}
+
+	p, err := cfg.LoadPolicy()
+	if err != nil {
+		return server.Settings{}, fmt.Errorf("unable to load authorization policy: %w", err)
+	}
+
+	limits := cfg.Limits
+	if listener.Limits != nil {
+		limits = *listener.Limits
+	}
+
+	return server.Settings{
+		Hosts:                     hosts,
+		Policy:                    p,
+		MaxConnectionsPerClient:   limits.MaxConnectionsPerClient,
+		ClientConnectionOverrides: limits.ClientConnectionOverrides,
+		PerClientRate:             rate(limits.PerClientRate),
+		GlobalRate:                rate(limits.GlobalRate),
+		RetryPolicy: server.RetryPolicy{
+			MaxAttempts: cfg.Retry.MaxAttempts,
+			Timeout:     time.Duration(cfg.Timeouts.Dial),
+		},
+		DrainTimeout: time.Duration(cfg.Timeouts.Drain),
+	}, nil
+}
+
+// newAdmin returns the admin API described by the configuration, which manages the frontends and shows the
+// configuration returned by current. The audit log, if it is a file, must be closed once the API has shut down.
+func newAdmin(cfg *config.File, frontends *server.Frontends, current func() interface{}, logger *logging.Logger) (*admin.Server, io.Closer, error) {
+	opts := []admin.Option{admin.WithConfig(current), admin.WithLogger(logger)}
+
+	if t := cfg.Admin.TLS; t != nil {
+		certificate, clientCAs, err := t.Load()
+		if err != nil {
+			return nil, nil, fmt.Errorf("admin API: %w", err)
+		}
+		opts = append(opts, admin.WithMutualTLS(certificate, clientCAs))
+
+		if t.IdentitySource != "" {
+			source, err := identity.ParseSource(t.IdentitySource)
+			if err != nil {
+				return nil, nil, fmt.Errorf("admin API: %w", err)
+			}
+			opts = append(opts, admin.WithIdentitySource(source))
+		}
+	}
+
+	var auditLog io.Closer = io.NopCloser(nil)
+	if cfg.Admin.AuditLog != "" {
+		f, err := os.OpenFile(cfg.Admin.AuditLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("admin API: unable to open audit log: %w", err)
+		}
+		opts = append(opts, admin.WithAuditLog(f))
+		auditLog = f
+	}
+
+	a, err := admin.New(cfg.Admin.Address, frontends, opts...)
+	if err != nil {
+		auditLog.Close()
+		return nil, nil, err
+	}
+	return a, auditLog, nil
+}
+
+// newAccessLog returns the access log described by the configuration, or nil if connections are not recorded. The
+// returned file must be closed once the frontends have shut down.
+func newAccessLog(cfg *config.File) (*accesslog.Logger, io.Closer, error) {
+	if cfg.AccessLog == nil {
+		return nil, io.NopCloser(nil), nil
+	}
+
+	format, err := accesslog.ParseFormat(cfg.AccessLog.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := accesslog.OpenFile(cfg.AccessLog.Path, cfg.AccessLog.MaxSizeMB*1024*1024, cfg.AccessLog.MaxBackups)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open access log: %w", err)
+	}
+	return accesslog.New(f, format), f, nil
+}
+
+// newLogger returns the logger described by the configuration, which writes to stderr.
+func newLogger(cfg *config.File) (*logging.Logger, error) {
+	level, err := logging.ParseLevel(cfg.Logging.Level)
+	if err != nil {
+		return nil, err
+	}
+	format, err := logging.ParseFormat(cfg.Logging.Format)
+	if err != nil {
+		return nil, err
+	}
+	return logging.New(os.Stderr, logging.WithLevel(level), logging.WithFormat(format)), nil
+}
+
+// healthConfig returns the health checker configuration described by the configuration.
+func healthConfig(cfg *config.File) health.Config {
+	return health.Config{
+		Interval:           time.Duration(cfg.HealthCheck.Interval),
+		Timeout:            time.Duration(cfg.HealthCheck.Timeout),
+		HealthyThreshold:   cfg.HealthCheck.HealthyThreshold,
+		UnhealthyThreshold: cfg.HealthCheck.UnhealthyThreshold,
+		Jitter:             time.Duration(cfg.HealthCheck.Jitter),
+	}
+}
+
+// healthProbe returns the probe of active health checks described by the configuration.
+func healthProbe(cfg *config.File) health.Probe {
+	switch hc := cfg.HealthCheck; hc.Probe {
+	case config.ProbeSendExpect:
+		return health.SendExpectProbe{Send: []byte(hc.Send), Expect: []byte(hc.Expect)}
+	case config.ProbeHTTP:
+		return health.HTTPProbe{Path: hc.Path, ExpectedStatus: hc.ExpectedStatus}
+	default:
+		return health.TCPProbe{}
+	}
+}
+
+// rate converts a configured rate, which is nil when unlimited.
+func rate(r *config.Rate) server.Rate {
+	if r == nil {
+		return server.Rate{}
+	}
+	return server.Rate{PerSecond: r.PerSecond, Burst: r.Burst}
+}
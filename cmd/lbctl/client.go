@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"tcp-load-balancer/internal/admin"
+)
+
+// requestTimeout bounds each request to the admin API.
+const requestTimeout = time.Second * 30
+
+// client sends requests to the admin API.
+type client struct {
+	// base is the URL of the admin API, such as "http://127.0.0.1:9090".
+	base string
+
+	http *http.Client
+}
+
+// newClient returns a client of the admin API at address. A bare host and port is reached over HTTPS when a client
+// certificate is given, and over HTTP otherwise. The CA file, when set, replaces the system roots.
+func newClient(address, certFile, keyFile, caFile string) (*client, error) {
+	var tlsConfig *tls.Config
+	if certFile != "" || keyFile != "" || caFile != "" {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+		if certFile != "" || keyFile != "" {
+			certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to load client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{certificate}
+		}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read CA file: %w", err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", caFile)
+			}
+			tlsConfig.RootCAs = roots
+		}
+	}
+
+	if !strings.Contains(address, "://") {
+		scheme := "http://"
+		if tlsConfig != nil {
+			scheme = "https://"
+		}
+		address = scheme + address
+	}
+	return &client{
+		base: strings.TrimSuffix(address, "/"),
+		http: &http.Client{Timeout: requestTimeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}, nil
+}
+
+// do sends a request with body encoded as JSON, if it is not nil, and decodes a successful response into v.
+// For an unsuccessful response, the error explained by the admin API is returned.
+func (c *client) do(method, path string, query url.Values, body, v interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to reach the admin API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr admin.Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Error == "" {
+			return fmt.Errorf("admin API responded %s", resp.Status)
+		}
+		return errors.New(apiErr.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid response from the admin API: %w", err)
+	}
+	return nil
+}
+
+func (c *client) get(path string, query url.Values, v interface{}) error {
+	return c.do(http.MethodGet, path, query, nil, v)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"tcp-load-balancer/internal/admin"
+)
+
+// command runs a command of lbctl against the admin API.
+type command struct {
+	client *client
+	out    *output
+	stderr io.Writer
+}
+
+// run dispatches the command named by the first arguments.
+func (c *command) run(args []string) error {
+	if len(args) == 0 {
+		return c.usageError("no command given")
+	}
+	if args[0] == "stats" {
+		return c.showStats(args[1:])
+	}
+	if len(args) == 1 {
+		return c.usageError(fmt.Sprintf("%s needs a subcommand", args[0]))
+	}
+
+	switch name := args[0] + " " + args[1]; name {
+	case "hosts list":
+		return c.listHosts(args[2:])
+	case "hosts add":
+		return c.addHost(args[2:])
+	case "hosts weight":
+		return c.setWeight(args[2:])
+	case "hosts drain":
+		return c.drainHost(args[2:])
+	case "hosts remove":
+		return c.removeHost(args[2:])
+	case "conns list":
+		return c.listConnections(args[2:])
+	case "config show":
+		return c.showConfig(args[2:])
+	default:
+		return c.usageError(fmt.Sprintf("unknown command %q", name))
+	}
+}
+
+func (c *command) listHosts(args []string) error {
+	flags := c.flags("hosts list")
+	frontend := flags.String("frontend", "", "List only the hosts of the named frontend")
+	if err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	if *frontend != "" {
+		query.Set("frontend", *frontend)
+	}
+	var hosts []admin.Host
+	if err := c.client.get("/hosts", query, &hosts); err != nil {
+		return err
+	}
+	return c.writeHosts(hosts)
+}
+
+func (c *command) addHost(args []string) error {
+	flags := c.flags("hosts add")
+	frontend := flags.String("frontend", "", "Name of the frontend to add the host to")
+	pool := flags.String("pool", "", "Pool of the host, matched by authorization policies")
+	weight := flags.Uint64("weight", 0, "Relative capacity of the host; 0 is the default weight of 1")
+	labels := labelsFlag{}
+	flags.Var(labels, "label", "Label of the host as key=value, matched by authorization policies; may be repeated")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	name, err := c.frontend(*frontend)
+	if err != nil {
+		return err
+	}
+	req := admin.AddHostRequest{Address: flags.Arg(0), Pool: *pool, Weight: *weight, Labels: labels}
+	var host admin.Host
+	if err := c.client.do(http.MethodPost, hostsPath(name), nil, req, &host); err != nil {
+		return err
+	}
+	return c.writeHosts([]admin.Host{host})
+}
+
+func (c *command) setWeight(args []string) error {
+	flags := c.flags("hosts weight")
+	frontend := flags.String("frontend", "", "Name of the frontend of the host")
+	if err := c.parse(flags, args, 2); err != nil {
+		return err
+	}
+	weight, err := strconv.ParseUint(flags.Arg(1), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid weight %q", flags.Arg(1))
+	}
+
+	path, err := c.hostPath(*frontend, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var host admin.Host
+	if err := c.client.do(http.MethodPatch, path, nil, admin.UpdateHostRequest{Weight: &weight}, &host); err != nil {
+		return err
+	}
+	return c.writeHosts([]admin.Host{host})
+}
+
+func (c *command) drainHost(args []string) error {
+	flags := c.flags("hosts drain")
+	frontend := flags.String("frontend", "", "Name of the frontend of the host")
+	timeout := flags.Duration("timeout", 0, "How long open connections may last before they are closed; 0 waits until they end")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	path, err := c.hostPath(*frontend, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if *timeout > 0 {
+		query.Set("timeout", timeout.String())
+	}
+	var host admin.Host
+	if err := c.client.do(http.MethodPost, path+"/drain", query, nil, &host); err != nil {
+		return err
+	}
+	return c.writeHosts([]admin.Host{host})
+}
+
+func (c *command) removeHost(args []string) error {
+	flags := c.flags("hosts remove")
+	frontend := flags.String("frontend", "", "Name of the frontend of the host")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	path, err := c.hostPath(*frontend, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	var host admin.Host
+	if err := c.client.do(http.MethodDelete, path, nil, nil, &host); err != nil {
+		return err
+	}
+	return c.writeHosts([]admin.Host{host})
+}
+
+func (c *command) listConnections(args []string) error {
+	flags := c.flags("conns list")
+	frontend := flags.String("frontend", "", "List only the connections of the named frontend")
+	clientName := flags.String("client", "", "List only the connections of the named client, e.g. billing or cn=billing")
+	host := flags.String("host", "", "List only the connections to the host with the given ID or address")
+	if err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	for key, value := range map[string]string{"frontend": *frontend, "client": *clientName, "host": *host} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	var connections []admin.Connection
+	if err := c.client.get("/connections", query, &connections); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(connections))
+	for i, conn := range connections {
+		rows[i] = []string{
+			conn.Frontend,
+			strconv.FormatUint(conn.ID, 10),
+			conn.Client,
+			conn.HostAddress,
+			conn.Started.Local().Format(time.RFC3339),
+			time.Since(conn.Started).Round(time.Second).String(),
+		}
+	}
+	return c.out.write(connections, []string{"FRONTEND", "ID", "CLIENT", "HOST", "STARTED", "AGE"}, rows)
+}
+
+// showConfig writes the configuration in effect, which is JSON in either format.
+func (c *command) showConfig(args []string) error {
+	if err := c.parse(c.flags("config show"), args, 0); err != nil {
+		return err
+	}
+	var cfg interface{}
+	if err := c.client.get("/config", nil, &cfg); err != nil {
+		return err
+	}
+	return c.out.json(cfg)
+}
+
+func (c *command) showStats(args []string) error {
+	if err := c.parse(c.flags("stats"), args, 0); err != nil {
+		return err
+	}
+	var stats []admin.Stats
+	if err := c.client.get("/stats", nil, &stats); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(stats))
+	for i, s := range stats {
+		rows[i] = []string{
+			s.Frontend,
+			strconv.Itoa(s.Hosts),
+			strconv.Itoa(s.HealthyHosts),
+			strconv.Itoa(s.DrainingHosts),
+			strconv.Itoa(s.Connections),
+			strconv.FormatUint(s.RejectedConnections, 10),
+			strconv.FormatUint(s.ConnectionLimitRejections, 10),
+			strconv.FormatUint(s.RateLimitRejections, 10),
+		}
+	}
+	return c.out.write(stats, []string{"FRONTEND", "HOSTS", "HEALTHY", "DRAINING", "CONNECTIONS", "REJECTED", "CONN LIMITED", "RATE LIMITED"}, rows)
+}
+
+// writeHosts writes the hosts.
+func (c *command) writeHosts(hosts []admin.Host) error {
+	rows := make([][]string, len(hosts))
+	for i, h := range hosts {
+		rows[i] = []string{
+			h.Frontend,
+			h.ID.String(),
+			h.Address,
+			h.Pool,
+			strconv.FormatUint(h.Weight, 10),
+			strconv.FormatUint(h.Connections, 10),
+			strconv.FormatBool(h.Healthy),
+			strconv.FormatBool(h.Draining),
+		}
+	}
+	return c.out.write(hosts, []string{"FRONTEND", "ID", "ADDRESS", "POOL", "WEIGHT", "CONNECTIONS", "HEALTHY", "DRAINING"}, rows)
+}
+
+// flags returns the flag set of the named command, which accepts the output flag.
+func (c *command) flags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("lbctl "+name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	c.out.register(flags)
+	return flags
+}
+
+// parse parses the arguments of a command, which takes exactly n positional arguments.
+func (c *command) parse(flags *flag.FlagSet, args []string, n int) error {
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != n {
+		fmt.Fprintf(c.stderr, "%s takes %d argument(s), got %d\n", flags.Name(), n, flags.NArg())
+		flags.PrintDefaults()
+		return errUsage
+	}
+	return nil
+}
+
+// usageError writes the problem and the usage, and returns errUsage.
+func (c *command) usageError(problem string) error {
+	fmt.Fprintf(c.stderr, "lbctl: %s\n\n%s", problem, usage)
+	return errUsage
+}
+
+// frontend returns the named frontend or, if no name is given, the only running frontend.
+func (c *command) frontend(name string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+
+	var frontends []admin.Frontend
+	if err := c.client.get("/frontends", nil, &frontends); err != nil {
+		return "", err
+	}
+	if len(frontends) != 1 {
+		names := make([]string, len(frontends))
+		for i, f := range frontends {
+			names[i] = f.Name
+		}
+		return "", fmt.Errorf("%d frontends are running (%s), choose one with -frontend", len(frontends), strings.Join(names, ", "))
+	}
+	return frontends[0].Name, nil
+}
+
+// hostPath returns the path of the host of the frontend, which is identified by its ID or address.
+func (c *command) hostPath(frontend, host string) (string, error) {
+	name, err := c.frontend(frontend)
+	if err != nil {
+		return "", err
+	}
+
+	var hosts []admin.Host
+	if err := c.client.get(hostsPath(name), nil, &hosts); err != nil {
+		return "", err
+	}
+	for _, h := range hosts {
+		if h.ID.String() == host || h.Address == host {
+			return hostsPath(name) + "/" + h.ID.String(), nil
+		}
+	}
+	return "", fmt.Errorf("frontend %q has no host %q", name, host)
+}
+
+// hostsPath returns the path of the hosts of the frontend.
+func hostsPath(frontend string) string {
+	return "/frontends/" + url.PathEscape(frontend) + "/hosts"
+}
+
+// labelsFlag collects repeated key=value flags.
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (l labelsFlag) Set(pair string) error {
+	k, v, ok := strings.Cut(pair, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("label %q must be key=value", pair)
+	}
+	l[k] = v
+	return nil
+}
@@ -0,0 +1,80 @@
+// Command lbctl manages a running load balancer through its admin API.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// defaultAdminAddress is the admin API reached unless -admin or LBCTL_ADMIN says otherwise.
+const defaultAdminAddress = "127.0.0.1:9090"
+
+const usage = `Usage: lbctl [flags] <command> [command flags] [arguments]
+
+Commands:
+  hosts list [-frontend NAME]                       list hosts with their connections and health
+  hosts add [-frontend NAME] [-pool P] [-weight N] [-label k=v] ADDRESS
+                                                    add a host
+  hosts weight [-frontend NAME] HOST WEIGHT         change the weight of a host
+  hosts drain [-frontend NAME] [-timeout 5m] HOST   drain a host, then remove it
+  hosts remove [-frontend NAME] HOST                remove a host, closing its connections
+  conns list [-frontend NAME] [-client NAME] [-host HOST]
+                                                    list open connections
+  config show                                       show the configuration in effect
+  stats                                             show the counters of each frontend
+
+HOST is the ID or address of a host. The frontend may be left out while only one is running.
+
+Flags:
+`
+
+// errUsage is returned for a command line which cannot be run; the usage has already been written.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command line, writing results to stdout and problems to stderr, and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	address := os.Getenv("LBCTL_ADMIN")
+	if address == "" {
+		address = defaultAdminAddress
+	}
+
+	flags := flag.NewFlagSet("lbctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&address, "admin", address, "Address or URL of the admin API; defaults to $LBCTL_ADMIN")
+	certFile := flags.String("cert", "", "Path of the PEM encoded client certificate, for an admin API which requires mTLS")
+	keyFile := flags.String("key", "", "Path of the PEM encoded private key of the client certificate")
+	caFile := flags.String("ca", "", "Path of the PEM encoded CA certificates which sign the certificate of the admin API")
+	var out output
+	out.register(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	c, err := newClient(address, *certFile, *keyFile, *caFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "lbctl: %s\n", err)
+		return 1
+	}
+	out.w = stdout
+
+	cmd := &command{client: c, out: &out, stderr: stderr}
+	if err := cmd.run(flags.Args()); err != nil {
+		if errors.Is(err, errUsage) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "lbctl: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/admin"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+	"tcp-load-balancer/test"
+)
+
+func TestHosts(t *testing.T) {
+	lb, address := runLoadBalancer(t)
+	added := startHost(t)
+
+	out := lbctl(t, address, 0, "hosts", "list")
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "FRONTEND") || !strings.Contains(lines[1], lb.Hosts()[0].Address().String()) {
+		t.Errorf("hosts list =\n%s\nwant a header and the host", out)
+	}
+
+	var hosts []admin.Host
+	out = lbctl(t, address, 0, "-o", "json", "hosts", "add", "-pool", "web", "-weight", "2", "-label", "env=prod", added)
+	if err := json.Unmarshal([]byte(out), &hosts); err != nil || len(hosts) != 1 {
+		t.Fatalf("hosts add -o json = %q, want the added host as JSON", out)
+	}
+	if h := hosts[0]; h.Address != added || h.Pool != "web" || h.Weight != 2 || h.Labels["env"] != "prod" || len(lb.Hosts()) != 2 {
+		t.Errorf("added host = %+v, want it to be load balanced with its pool, weight and labels", h)
+	}
+
+	// Hosts are identified by address or ID.
+	if out = lbctl(t, address, 0, "hosts", "weight", "-o", "json", added, "5"); !strings.Contains(out, `"weight": 5`) {
+		t.Errorf("hosts weight = %s, want the host with weight 5", out)
+	}
+	if out = lbctl(t, address, 0, "hosts", "drain", "-o", "json", "-timeout", "1m", hosts[0].ID.String()); !strings.Contains(out, `"draining": true`) {
+		t.Errorf("hosts drain = %s, want the draining host", out)
+	}
+	if !eventually(time.Second*5, func() bool { return len(lb.Hosts()) == 1 }) {
+		t.Fatal("drained host was not removed")
+	}
+
+	lbctl(t, address, 0, "hosts", "remove", "-frontend", "api", lb.Hosts()[0].Address().String())
+	if len(lb.Hosts()) != 0 {
+		t.Errorf("frontend has %d host(s) after the last was removed, want 0", len(lb.Hosts()))
+	}
+
+	if out = lbctl(t, address, 1, "hosts", "remove", added); !strings.Contains(out, `no host "`+added+`"`) {
+		t.Errorf("hosts remove of an unknown host = %q, want an error naming the host", out)
+	}
+}
+
+func TestConnsList(t *testing.T) {
+	lb, address := runLoadBalancer(t)
+	conn, err := net.Dial("tcp", lb.Address().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !eventually(time.Second*5, func() bool { return len(lb.Sessions()) == 1 }) {
+		t.Fatal("connection was not forwarded to a host")
+	}
+
+	if out := lbctl(t, address, 0, "conns", "list", "--client", "127.0.0.1"); !strings.Contains(out, "address=127.0.0.1") {
+		t.Errorf("conns list --client 127.0.0.1 =\n%s\nwant the connection of the client", out)
+	}
+	if out := lbctl(t, address, 0, "conns", "list", "--client", "10.0.0.1"); strings.Count(out, "\n") != 1 {
+		t.Errorf("conns list --client 10.0.0.1 =\n%s\nwant only the header", out)
+	}
+}
+
+func TestStatsAndConfig(t *testing.T) {
+	_, address := runLoadBalancer(t)
+
+	var stats []admin.Stats
+	out := lbctl(t, address, 0, "stats", "-o", "json")
+	if err := json.Unmarshal([]byte(out), &stats); err != nil || len(stats) != 1 || stats[0].Frontend != "api" || stats[0].HealthyHosts != 1 {
+		t.Errorf("stats -o json = %s, want the counters of frontend api", out)
+	}
+	if out = lbctl(t, address, 0, "stats"); !strings.Contains(out, "CONNECTIONS") || !strings.Contains(out, "api") {
+		t.Errorf("stats =\n%s\nwant a table of the counters of frontend api", out)
+	}
+
+	var cfg map[string]string
+	out = lbctl(t, address, 0, "config", "show")
+	if err := json.Unmarshal([]byte(out), &cfg); err != nil || cfg["strategy"] != "least_connections" {
+		t.Errorf("config show = %s, want the configuration in effect", out)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "no command", args: nil, want: 2},
+		{name: "unknown command", args: []string{"upstreams", "list"}, want: 2},
+		{name: "missing subcommand", args: []string{"hosts"}, want: 2},
+		{name: "missing argument", args: []string{"hosts", "drain"}, want: 2},
+		{name: "unknown output format", args: []string{"-o", "yaml", "stats"}, want: 2},
+		{name: "unreachable admin API", args: []string{"-admin", "127.0.0.1:1", "stats"}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			if code := run(tt.args, io.Discard, &stderr); code != tt.want {
+				t.Errorf("run(%v) = %d, want %d", tt.args, code, tt.want)
+			}
+			if stderr.Len() == 0 {
+				t.Error("nothing was written to stderr")
+			}
+		})
+	}
+}
+
+// runLoadBalancer runs a frontend named api, which forwards to a test host, along with its admin API. It returns
+// the frontend and the address of the admin API.
+func runLoadBalancer(t *testing.T) (*server.LoadBalancer, string) {
+	lb, err := server.New("tcp", "127.0.0.1:0", time.Second, server.WithName("api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := upstream.New(startHost(t), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.AddUpstream(host)
+
+	frontends := &server.Frontends{}
+	if err := frontends.Start(lb); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { frontends.Shutdown(context.Background()) })
+
+	cfg := map[string]string{"strategy": "least_connections"}
+	api, err := admin.New("127.0.0.1:0", frontends, admin.WithConfig(func() interface{} { return cfg }), admin.WithAuditLog(io.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go api.Serve()
+	t.Cleanup(func() { api.Shutdown(context.Background()) })
+	return lb, api.Address().String()
+}
+
+// lbctl runs lbctl against the admin API at address, and checks its exit code. It returns what lbctl wrote to
+// stdout, or to stderr if it failed.
+func lbctl(t *testing.T, address string, code int, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	if got := run(append([]string{"-admin", address}, args...), &stdout, &stderr); got != code {
+		t.Fatalf("lbctl %s exited with %d, want %d: %s", strings.Join(args, " "), got, code, stderr.String())
+	}
+	if code != 0 {
+		return stderr.String()
+	}
+	return stdout.String()
+}
+
+// startHost starts a test host until the test ends, and returns its address.
+func startHost(t *testing.T) string {
+	h, err := test.InitializeHost("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h.Addr().String()
+}
+
+// eventually polls the condition until it returns true or the timeout passes.
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return condition()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// output writes the results of commands as a table or as JSON.
+type output struct {
+	// format is formatTable or formatJSON.
+	format string
+
+	w io.Writer
+}
+
+// register adds the -o flag to the flag set. It is registered with every command, so it may be given either before
+// or after the command.
+func (o *output) register(flags *flag.FlagSet) {
+	if o.format == "" {
+		o.format = formatTable
+	}
+	flags.Var(o, "o", "Output format: table or json")
+}
+
+// String returns the format, so that output is a flag.Value.
+func (o *output) String() string {
+	return o.format
+}
+
+// Set selects the format.
+func (o *output) Set(format string) error {
+	switch format {
+	case formatTable, formatJSON:
+		o.format = format
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, must be table or json", format)
+	}
+}
+
+// write writes v as JSON, or otherwise as a table with the given columns and one row per element of rows.
+func (o *output) write(v interface{}, columns []string, rows [][]string) error {
+	if o.format == formatJSON {
+		return o.json(v)
+	}
+
+	tw := tabwriter.NewWriter(o.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(columns, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// json writes v as indented JSON.
+func (o *output) json(v interface{}) error {
+	e := json.NewEncoder(o.w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
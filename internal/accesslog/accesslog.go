@@ -0,0 +1,199 @@
+// Package accesslog records every connection proxied by the load balancer, one record per line.
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+)
+
+var ErrUnknownFormat = errors.New("unknown access log format")
+
+// Format is the encoding of the records of an access log.
+type Format string
+
+const (
+	// JSON writes each record as a JSON object on its own line.
+	JSON Format = "json"
+
+	// Logfmt writes each record as key=value pairs on its own line.
+	Logfmt Format = "logfmt"
+)
+
+// ParseFormat returns the format with the given name, "json" or "logfmt".
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case JSON, Logfmt:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w %q, must be json or logfmt", ErrUnknownFormat, name)
+	}
+}
+
+// Termination is why a connection ended.
+type Termination string
+
+const (
+	// ClientClosed is a client which closed its connection first, the normal end of a connection.
+	ClientClosed Termination = "client_close"
+
+	// HostClosed is a host which closed its connection before the client did.
+	HostClosed Termination = "host_close"
+
+	// TimedOut is a read or write which exceeded its deadline.
+	TimedOut Termination = "timeout"
+
+	// Failed is a connection which could not be forwarded, or whose forwarding failed with an error.
+	Failed Termination = "error"
+
+	// Closed is a connection closed by the load balancer, because its host was drained or removed, or because the
+	// load balancer shut down.
+	Closed Termination = "closed"
+)
+
+// Record describes a connection which was proxied, or which could not be.
+type Record struct {
+	// Start is when the connection was handled, and Duration is how long it lasted.
+	Start    time.Time
+	Duration time.Duration
+
+	// Frontend is the name of the load balancer which accepted the connection.
+	Frontend string
+
+	// ConnectionID identifies the connection within the frontend.
+	ConnectionID uint64
+
+	// ClientAddress is the remote address of the client, and Client is its identity, such as "cn=billing".
+	ClientAddress string
+	Client        string
+
+	// Upstream is the address of the host the connection was forwarded to. It is empty if no host accepted it.
+	Upstream string
+
+	// BytesIn were received from the client, and BytesOut were sent to it.
+	BytesIn  uint64
+	BytesOut uint64
+
+	// Termination is why the connection ended, and Error is the error which ended it, if any.
+	Termination Termination
+	Error       string
+
+	// Retries is the number of hosts which were dialed for the connection and failed.
+	Retries int
+}
+
+// jsonRecord is a Record as it is written in the JSON format.
+type jsonRecord struct {
+	Start         time.Time   `json:"start"`
+	Frontend      string      `json:"frontend"`
+	ConnectionID  uint64      `json:"connection_id"`
+	ClientAddress string      `json:"client_address"`
+	Client        string      `json:"client"`
+	Upstream      string      `json:"upstream"`
+	Duration      float64     `json:"duration"`
+	BytesIn       uint64      `json:"bytes_in"`
+	BytesOut      uint64      `json:"bytes_out"`
+	Termination   Termination `json:"termination"`
+	Retries       int         `json:"retries"`
+	Error         string      `json:"error,omitempty"`
+}
+
+// Logger writes access log records. It is safe for concurrent use, and each record is written with a single Write,
+// so that records are never interleaved.
+type Logger struct {
+	w      io.Writer
+	format Format
+
+	// mu serializes writes to w.
+	mu sync.Mutex
+}
+
+// New returns a logger which writes records to w in the given format.
+func New(w io.Writer, format Format) *Logger {
+	return &Logger{w: w, format: format}
+}
+
+// Log writes the record.
+func (l *Logger) Log(r Record) error {
+	var buf bytes.Buffer
+	if l.format == Logfmt {
+		encodeLogfmt(&buf, r)
+	} else {
+		if err := json.NewEncoder(&buf).Encode(jsonRecord{
+			Start:         r.Start,
+			Frontend:      r.Frontend,
+			ConnectionID:  r.ConnectionID,
+			ClientAddress: r.ClientAddress,
+			Client:        r.Client,
+			Upstream:      r.Upstream,
+			Duration:      r.Duration.Seconds(),
+			BytesIn:       r.BytesIn,
+			BytesOut:      r.BytesOut,
+			Termination:   r.Termination,
+			Retries:       r.Retries,
+			Error:         r.Error,
+		}); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.w.Write(buf.Bytes())
+	return err
+}
+
+// field is a key and its value in the logfmt format.
+type field struct {
+	key   string
+	value string
+}
+
+// encodeLogfmt writes the record as a line of key=value pairs, with the same keys as the JSON format.
+func encodeLogfmt(buf *bytes.Buffer, r Record) {
+	pairs := []field{
+		{"start", r.Start.Format(time.RFC3339Nano)},
+		{"frontend", r.Frontend},
+		{"connection_id", strconv.FormatUint(r.ConnectionID, 10)},
+		{"client_address", r.ClientAddress},
+		{"client", r.Client},
+		{"upstream", r.Upstream},
+		{"duration", strconv.FormatFloat(r.Duration.Seconds(), 'f', -1, 64)},
+		{"bytes_in", strconv.FormatUint(r.BytesIn, 10)},
+		{"bytes_out", strconv.FormatUint(r.BytesOut, 10)},
+		{"termination", string(r.Termination)},
+		{"retries", strconv.Itoa(r.Retries)},
+	}
+	if r.Error != "" {
+		pairs = append(pairs, field{"error", r.Error})
+	}
+
+	for i, p := range pairs {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(p.key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(p.value))
+	}
+	buf.WriteByte('\n')
+}
+
+// logfmtValue quotes the value if it is empty, or contains spaces, quotes, equals signs or unprintable characters.
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if r == ' ' || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
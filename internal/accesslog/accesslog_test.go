@@ -0,0 +1,78 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/accesslog"
+)
+
+func TestLogger_Log(t *testing.T) {
+	record := accesslog.Record{
+		Start:         time.Date(2024, 3, 1, 12, 0, 0, 500000000, time.UTC),
+		Duration:      time.Millisecond * 1500,
+		Frontend:      "payments",
+		ConnectionID:  7,
+		ClientAddress: "10.0.0.1:53211",
+		Client:        "cn=billing",
+		Upstream:      "10.0.0.2:8080",
+		BytesIn:       120,
+		BytesOut:      4096,
+		Termination:   accesslog.HostClosed,
+		Error:         "host closed prior to client disconnection",
+		Retries:       1,
+	}
+
+	tests := []struct {
+		name   string
+		format accesslog.Format
+		record accesslog.Record
+		want   string
+	}{
+		{
+			name:   "json",
+			format: accesslog.JSON,
+			record: record,
+			want: `{"start":"2024-03-01T12:00:00.5Z","frontend":"payments","connection_id":7,"client_address":"10.0.0.1:53211",` +
+				`"client":"cn=billing","upstream":"10.0.0.2:8080","duration":1.5,"bytes_in":120,"bytes_out":4096,` +
+				`"termination":"host_close","retries":1,"error":"host closed prior to client disconnection"}` + "\n",
+		},
+		{
+			name:   "logfmt",
+			format: accesslog.Logfmt,
+			record: record,
+			want: `start=2024-03-01T12:00:00.5Z frontend=payments connection_id=7 client_address=10.0.0.1:53211 ` +
+				`client="cn=billing" upstream=10.0.0.2:8080 duration=1.5 bytes_in=120 bytes_out=4096 ` +
+				`termination=host_close retries=1 error="host closed prior to client disconnection"` + "\n",
+		},
+		{
+			name:   "logfmt without an upstream or error",
+			format: accesslog.Logfmt,
+			record: accesslog.Record{Start: record.Start, Frontend: "payments", ConnectionID: 8, Termination: accesslog.Failed},
+			want: `start=2024-03-01T12:00:00.5Z frontend=payments connection_id=8 client_address="" client="" upstream="" ` +
+				`duration=0 bytes_in=0 bytes_out=0 termination=error retries=0` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := accesslog.New(&buf, tt.format).Log(tt.record); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Log() wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := accesslog.ParseFormat("logfmt"); err != nil || f != accesslog.Logfmt {
+		t.Errorf("ParseFormat(logfmt) = %q, %v, want logfmt", f, err)
+	}
+	if _, err := accesslog.ParseFormat("text"); !errors.Is(err, accesslog.ErrUnknownFormat) {
+		t.Errorf("ParseFormat(text) error = %v, want ErrUnknownFormat", err)
+	}
+}
@@ -0,0 +1,109 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// RotatingFile is a file which is rotated once writing to it would make it larger than its maximum size. The file at
+// path is renamed to path.1, path.1 to path.2 and so on, keeping at most the configured number of rotated files.
+// It is safe for concurrent use.
+type RotatingFile struct {
+	path string
+
+	// maxSize is the size in bytes above which the file is rotated. Zero never rotates it.
+	maxSize int64
+
+	// maxBackups is the number of rotated files which are kept.
+	maxBackups int
+
+	// file is the open file at path, and size is its size.
+	file *os.File
+	size int64
+
+	// mu protects file and size from concurrent writes.
+	mu sync.Mutex
+}
+
+// OpenFile opens the file at path for appending, creating it if needed. It is rotated once it would grow beyond
+// maxSize bytes, and up to maxBackups rotated files are kept.
+func OpenFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(os.O_APPEND); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Write writes p to the file, first rotating the file if p would make it larger than its maximum size. A single
+// write is never split across files, so a write larger than the maximum size is written to a file of its own.
+// If the file cannot be rotated, p is still written to the file in use, which grows until a later rotation succeeds,
+// and the rotation error is returned.
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rotateErr error
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		rotateErr = r.rotate()
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Close closes the file.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// rotate renames the file and each rotated file to the next number, discarding the oldest, and opens a new file.
+// The file in use is renamed while it is open, and closed only once the new file is open, so that it can still be
+// written to if rotating fails.
+func (r *RotatingFile) rotate() error {
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("unable to rotate %s: %w", r.backup(i), err)
+			}
+		}
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return fmt.Errorf("unable to rotate %s: %w", r.path, err)
+		}
+	}
+
+	rotated := r.file
+	if err := r.open(os.O_TRUNC); err != nil {
+		return fmt.Errorf("unable to open %s after rotation: %w", r.path, err)
+	}
+	if err := rotated.Close(); err != nil {
+		return fmt.Errorf("unable to close rotated %s: %w", r.path, err)
+	}
+	return nil
+}
+
+// open opens the file at path with the given flag, which either appends to or truncates an existing file.
+func (r *RotatingFile) open(flag int) error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|flag, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+// backup returns the path of the ith rotated file.
+func (r *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
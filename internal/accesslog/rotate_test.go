@@ -0,0 +1,89 @@
+package accesslog_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tcp-load-balancer/internal/accesslog"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := accesslog.OpenFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// The existing file is appended to until the next write would make it larger than 10 bytes.
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n", "a write larger than the maximum\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "a write larger than the maximum\n",
+		path + ".1": "fourth\n",
+		path + ".2": "third\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than 2 rotated files were kept")
+	}
+}
+
+func TestRotatingFile_RotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := accesslog.OpenFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A directory which is not empty cannot be replaced by renaming the file over it.
+	if err = os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("second\n")); err == nil {
+		t.Fatal("Write() did not return the rotation error")
+	}
+
+	// Once the file can be rotated, writes succeed again, and nothing written while rotation failed was lost.
+	if err = os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("third\n")); err != nil {
+		t.Fatalf("Write() after rotation failed = %v, want no error", err)
+	}
+
+	want := map[string]string{
+		path:        "third\n",
+		path + ".1": "first\nsecond\n",
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, content)
+		}
+	}
+}
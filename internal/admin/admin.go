@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/server"
+)
+
+// readHeaderTimeout bounds how long a client of the admin API has to send the headers of a request.
+const readHeaderTimeout = time.Second * 10
+
+// Server is an HTTP API used to inspect and manage running frontends. It lists hosts with their connection counts and
+// health, adds, removes and drains hosts, changes their weights, lists open connections and shows the configuration
+// in effect. Every response is JSON, and every change is recorded in the audit log.
+type Server struct {
+	// frontends are the frontends managed through the API.
+	frontends *server.Frontends
+
+	// config returns the configuration in effect, which is written as JSON. When nil, no configuration is shown.
+	config func() interface{}
+
+	// audit records changes made through the API.
+	audit *auditLog
+
+	// tlsConfig is set when the API requires mutual TLS.
+	tlsConfig *tls.Config
+
+	// identitySource selects which field of the client certificate names the actor of a change.
+	identitySource identity.Source
+
+	// log receives messages about the API. Nil means the default logger.
+	log *logging.Logger
+
+	// listener is the listener of the API, and httpServer serves requests from it.
+	listener   net.Listener
+	httpServer *http.Server
+
+	// mu serializes changes, so that checking for a host and changing it is not interleaved with another change.
+	mu sync.Mutex
+}
+
+// Option configures optional behavior of a Server during New.
+type Option func(*Server)
+
+// WithMutualTLS requires every client of the API to complete a TLS 1.3 handshake and present a certificate signed by
+// one of clientCAs. The actor of each change is then named by the client certificate rather than by the address.
+func WithMutualTLS(certificate tls.Certificate, clientCAs *x509.CertPool) Option {
+	return func(s *Server) {
+		s.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientCAs:    clientCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS13,
+		}
+	}
+}
+
+// WithIdentitySource selects which field of the verified client certificate names the actor of a change.
+// The default is the subject common name. It has no effect unless mTLS is enabled.
+func WithIdentitySource(source identity.Source) Option {
+	return func(s *Server) {
+		s.identitySource = source
+	}
+}
+
+// WithConfig shows the value returned by config, written as JSON, as the configuration in effect.
+func WithConfig(config func() interface{}) Option {
+	return func(s *Server) {
+		s.config = config
+	}
+}
+
+// WithAuditLog writes a JSON record of every change to w, one per line. By default, records are written to the logger.
+func WithAuditLog(w io.Writer) Option {
+	return func(s *Server) {
+		s.audit = &auditLog{w: w}
+	}
+}
+
+// WithLogger sets the logger which receives messages about the API, and audit records unless they are written to an
+// audit log.
+func WithLogger(logger *logging.Logger) Option {
+	return func(s *Server) {
+		s.log = logger
+	}
+}
+
+// New returns an admin API which manages the frontends, listening on address. Call Serve to handle requests.
+func New(address string, frontends *server.Frontends, opts ...Option) (*Server, error) {
+	s := &Server{
+		frontends:      frontends,
+		audit:          &auditLog{},
+		identitySource: identity.SourceCommonName,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.audit.log = s.log
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for admin API requests: %w", err)
+	}
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+	s.listener = ln
+	s.httpServer = &http.Server{Handler: s, ReadHeaderTimeout: readHeaderTimeout}
+	return s, nil
+}
+
+// Address returns the address the API listens on.
+func (s *Server) Address() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve handles requests until Shutdown is called, and then returns nil.
+func (s *Server) Serve() error {
+	if err := s.httpServer.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests, and waits for requests which are being handled until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
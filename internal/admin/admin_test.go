@@ -0,0 +1,364 @@
+package admin_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/admin"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+	"tcp-load-balancer/test"
+)
+
+func TestServer_Hosts(t *testing.T) {
+	frontends, lb := runFrontend(t, "api")
+	var audit lockedBuffer
+	api := runAdmin(t, frontends, admin.WithAuditLog(&audit))
+	base := "http://" + api.Address().String()
+
+	var hosts []admin.Host
+	if status := request(t, http.DefaultClient, http.MethodGet, base+"/hosts", nil, &hosts); status != http.StatusOK || len(hosts) != 1 {
+		t.Fatalf("GET /hosts = %d with %d host(s), want 200 with 1", status, len(hosts))
+	}
+	if hosts[0].Frontend != "api" || !hosts[0].Healthy || hosts[0].Draining {
+		t.Errorf("host = %+v, want a healthy host of frontend api", hosts[0])
+	}
+
+	// Add a host.
+	added := startHost(t)
+	var host admin.Host
+	body := admin.AddHostRequest{Address: added, Pool: "web", Weight: 2}
+	if status := request(t, http.DefaultClient, http.MethodPost, base+"/frontends/api/hosts", body, &host); status != http.StatusCreated {
+		t.Fatalf("POST host = %d, want %d", status, http.StatusCreated)
+	}
+	if host.Address != added || host.Pool != "web" || host.Weight != 2 || len(lb.Hosts()) != 2 {
+		t.Errorf("added host = %+v, want it to be load balanced with pool web and weight 2", host)
+	}
+	hostPath := fmt.Sprintf("%s/frontends/api/hosts/%s", base, host.ID)
+
+	var apiErr admin.Error
+	if status := request(t, http.DefaultClient, http.MethodPost, base+"/frontends/api/hosts", body, &apiErr); status != http.StatusConflict {
+		t.Errorf("POST of a duplicate host = %d, want %d", status, http.StatusConflict)
+	}
+
+	// Change its weight.
+	weight := uint64(7)
+	if status := request(t, http.DefaultClient, http.MethodPatch, hostPath, admin.UpdateHostRequest{Weight: &weight}, &host); status != http.StatusOK || host.Weight != 7 {
+		t.Errorf("PATCH weight = %d with weight %d, want 200 with weight 7", status, host.Weight)
+	}
+
+	// Drain it, which removes it once it has no connections.
+	if status := request(t, http.DefaultClient, http.MethodPost, hostPath+"/drain?timeout=1m", nil, &host); status != http.StatusAccepted || !host.Draining {
+		t.Errorf("POST drain = %d with draining %t, want %d with draining true", status, host.Draining, http.StatusAccepted)
+	}
+	if !eventually(time.Second*5, func() bool { return len(lb.Hosts()) == 1 }) {
+		t.Fatal("drained host was not removed")
+	}
+	if status := request(t, http.DefaultClient, http.MethodDelete, hostPath, nil, &apiErr); status != http.StatusNotFound {
+		t.Errorf("DELETE of a drained host = %d, want %d", status, http.StatusNotFound)
+	}
+
+	// Remove the original host.
+	if status := request(t, http.DefaultClient, http.MethodDelete, fmt.Sprintf("%s/frontends/api/hosts/%s", base, hosts[0].ID), nil, &host); status != http.StatusOK {
+		t.Errorf("DELETE = %d, want %d", status, http.StatusOK)
+	}
+	if len(lb.Hosts()) != 0 {
+		t.Errorf("frontend has %d host(s) after the last was removed, want 0", len(lb.Hosts()))
+	}
+
+	// Every change is audited, including those which were refused.
+	var actions []string
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var record admin.AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("audit record %q is not JSON: %s", line, err)
+		}
+		if record.Frontend != "api" || record.Actor == "" {
+			t.Errorf("audit record = %+v, want the frontend and actor", record)
+		}
+		actions = append(actions, fmt.Sprintf("%s %d", record.Action, record.Status))
+	}
+	want := []string{"add_host 201", "add_host 409", "update_host 200", "drain_host 202", "remove_host 404", "remove_host 200"}
+	if strings.Join(actions, ", ") != strings.Join(want, ", ") {
+		t.Errorf("audited %v, want %v", actions, want)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	frontends, _ := runFrontend(t, "api")
+	api := runAdmin(t, frontends, admin.WithAuditLog(io.Discard))
+	base := "http://" + api.Address().String()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{name: "unknown path", method: http.MethodGet, path: "/upstreams", want: http.StatusNotFound},
+		{name: "unknown frontend", method: http.MethodGet, path: "/frontends/web/hosts", want: http.StatusNotFound},
+		{name: "invalid host ID", method: http.MethodGet, path: "/frontends/api/hosts/1", want: http.StatusBadRequest},
+		{name: "method not allowed", method: http.MethodPut, path: "/frontends/api/hosts", want: http.StatusMethodNotAllowed},
+		{name: "missing address", method: http.MethodPost, path: "/frontends/api/hosts", body: admin.AddHostRequest{}, want: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPost, path: "/frontends/api/hosts", body: map[string]string{"adress": "127.0.0.1:1"}, want: http.StatusBadRequest},
+		{name: "no configuration", method: http.MethodGet, path: "/config", want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr admin.Error
+			if status := request(t, http.DefaultClient, tt.method, base+tt.path, tt.body, &apiErr); status != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.method, tt.path, status, tt.want)
+			}
+			if apiErr.Error == "" {
+				t.Error("response does not explain the error")
+			}
+		})
+	}
+}
+
+func TestServer_Connections(t *testing.T) {
+	frontends, lb := runFrontend(t, "api")
+	api := runAdmin(t, frontends, admin.WithConfig(func() interface{} { return map[string]string{"listener": "api"} }))
+	base := "http://" + api.Address().String()
+
+	conn, err := net.Dial("tcp", lb.Address().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !eventually(time.Second*5, func() bool { return len(lb.Sessions()) == 1 }) {
+		t.Fatal("connection was not forwarded to a host")
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: 1},
+		{query: "?client=127.0.0.1", want: 1},
+		{query: "?client=address=127.0.0.1&frontend=api", want: 1},
+		{query: "?client=10.0.0.1", want: 0},
+		{query: "?frontend=web", want: 0},
+	}
+	for _, tt := range tests {
+		var connections []admin.Connection
+		if status := request(t, http.DefaultClient, http.MethodGet, base+"/connections"+tt.query, nil, &connections); status != http.StatusOK || len(connections) != tt.want {
+			t.Errorf("GET /connections%s = %d with %d connection(s), want 200 with %d", tt.query, status, len(connections), tt.want)
+		}
+	}
+
+	var stats []admin.Stats
+	if status := request(t, http.DefaultClient, http.MethodGet, base+"/stats", nil, &stats); status != http.StatusOK || len(stats) != 1 || stats[0].Connections != 1 || stats[0].HealthyHosts != 1 {
+		t.Errorf("GET /stats = %d with %+v, want 200 with one connection and one healthy host", status, stats)
+	}
+
+	var cfg map[string]string
+	if status := request(t, http.DefaultClient, http.MethodGet, base+"/config", nil, &cfg); status != http.StatusOK || cfg["listener"] != "api" {
+		t.Errorf("GET /config = %d with %v, want the configuration", status, cfg)
+	}
+}
+
+func TestServer_Metrics(t *testing.T) {
+	frontends, lb := runFrontend(t, "api")
+	api := runAdmin(t, frontends)
+
+	conn, err := net.Dial("tcp", lb.Address().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	response := make([]byte, 2048)
+	n, err := conn.Read(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bytes of a connection are counted once it ends.
+	conn.Close()
+	if !eventually(time.Second*5, func() bool { return len(lb.Sessions()) == 0 }) {
+		t.Fatal("connection did not end after the client closed it")
+	}
+	if lb.BytesToClients() != uint64(n) {
+		t.Fatalf("%d bytes were sent to the client, want %d", lb.BytesToClients(), n)
+	}
+
+	resp, err := http.Get("http://" + api.Address().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", contentType)
+	}
+
+	host := lb.Hosts()[0].Address().String()
+	for _, want := range []string{
+		"# TYPE tcp_lb_connections_accepted_total counter",
+		`tcp_lb_connections_accepted_total{frontend="api"} 1`,
+		`tcp_lb_connections_rejected_total{frontend="api",reason="no_host"} 0`,
+		`tcp_lb_connections_active{frontend="api"} 0`,
+		`tcp_lb_bytes_total{direction="received",frontend="api"} 5`,
+		fmt.Sprintf(`tcp_lb_bytes_total{direction="sent",frontend="api"} %d`, n),
+		`tcp_lb_forward_errors_total{cause="host_closed",frontend="api"} 0`,
+		fmt.Sprintf(`tcp_lb_upstream_connections_active{frontend="api",host=%q} 0`, host),
+		fmt.Sprintf(`tcp_lb_upstream_healthy{frontend="api",host=%q} 1`, host),
+		"# TYPE tcp_lb_upstream_dial_duration_seconds histogram",
+		fmt.Sprintf(`tcp_lb_upstream_dial_duration_seconds_bucket{frontend="api",host=%q,le="+Inf"} 1`, host),
+		fmt.Sprintf(`tcp_lb_upstream_dial_duration_seconds_count{frontend="api",host=%q} 1`, host),
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Errorf("GET /metrics is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestServer_MutualTLS(t *testing.T) {
+	pki, err := test.NewPKI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontends, _ := runFrontend(t, "api")
+	var audit lockedBuffer
+	api := runAdmin(t, frontends, admin.WithMutualTLS(pki.ServerCertificate, pki.ClientCA.Pool()), admin.WithAuditLog(&audit))
+	base := "https://" + api.Address().String()
+
+	clientTLSConfig, err := pki.ClientTLSConfig("operator")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLSConfig}}
+	var host admin.Host
+	if status := request(t, client, http.MethodPost, base+"/frontends/api/hosts", admin.AddHostRequest{Address: startHost(t)}, &host); status != http.StatusCreated {
+		t.Fatalf("POST host = %d, want %d", status, http.StatusCreated)
+	}
+	var record admin.AuditRecord
+	if err := json.Unmarshal(audit.Bytes(), &record); err != nil || record.Actor != "cn=operator" {
+		t.Errorf("audit record = %+v, want the actor named by the client certificate", record)
+	}
+
+	// A client without a certificate cannot use the API.
+	anonymous := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pki.ServerCA.Pool(), ServerName: test.ServerName}}}
+	if _, err := anonymous.Get(base + "/hosts"); err == nil {
+		t.Error("request without a client certificate succeeded")
+	}
+}
+
+// runFrontend runs a frontend with the given name, which forwards to a test host of its own.
+func runFrontend(t *testing.T, name string) (*server.Frontends, *server.LoadBalancer) {
+	lb, err := server.New("tcp", "127.0.0.1:0", time.Second, server.WithName(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := upstream.New(startHost(t), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.AddUpstream(host)
+
+	frontends := &server.Frontends{}
+	if err := frontends.Start(lb); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { frontends.Shutdown(context.Background()) })
+	return frontends, lb
+}
+
+// runAdmin serves the admin API for the frontends until the test ends.
+func runAdmin(t *testing.T, frontends *server.Frontends, opts ...admin.Option) *admin.Server {
+	api, err := admin.New("127.0.0.1:0", frontends, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go api.Serve()
+	t.Cleanup(func() { api.Shutdown(context.Background()) })
+	return api
+}
+
+// startHost starts a test host until the test ends, and returns its address.
+func startHost(t *testing.T) string {
+	h, err := test.InitializeHost("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h.Addr().String()
+}
+
+// request sends a request with body encoded as JSON, if it is not nil, and decodes the response into v.
+// It returns the status of the response.
+func request(t *testing.T, client *http.Client, method, url string, body, v interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("%s %s response is not JSON: %s", method, url, err)
+	}
+	return resp.StatusCode
+}
+
+// eventually polls the condition until it returns true or the timeout passes.
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return condition()
+}
+
+// lockedBuffer is a bytes.Buffer which is safe for concurrent use.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func (b *lockedBuffer) String() string {
+	return string(b.Bytes())
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/logging"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionAddHost    = "add_host"
+	ActionRemoveHost = "remove_host"
+	ActionDrainHost  = "drain_host"
+	ActionUpdateHost = "update_host"
+)
+
+// AuditRecord describes a change requested through the admin API, whether or not it succeeded.
+type AuditRecord struct {
+	// Time is when the change was requested.
+	Time time.Time `json:"time"`
+
+	// Actor names who requested the change: the identity of the client certificate when the API requires mutual TLS,
+	// or otherwise the address of the client.
+	Actor string `json:"actor"`
+
+	// RemoteAddr is the address the request came from.
+	RemoteAddr string `json:"remoteAddr"`
+
+	// Action is one of the Action constants.
+	Action string `json:"action"`
+
+	// Frontend is the name of the frontend which was changed.
+	Frontend string `json:"frontend"`
+
+	// Host is the address of the host which was changed, if it is known.
+	Host string `json:"host,omitempty"`
+
+	// Detail describes the change, such as the new weight of a host.
+	Detail string `json:"detail,omitempty"`
+
+	// Status is the HTTP status of the response.
+	Status int `json:"status"`
+
+	// Error explains why the change was refused or failed.
+	Error string `json:"error,omitempty"`
+}
+
+// auditLog writes audit records.
+type auditLog struct {
+	// w receives a JSON record per line. When nil, records are written to log.
+	w io.Writer
+
+	// log receives records when there is no w, and failures to write records. Nil means the default logger.
+	log *logging.Logger
+
+	// mu keeps records from interleaving.
+	mu sync.Mutex
+}
+
+// record writes the record, logging any failure to write it.
+func (a *auditLog) record(r AuditRecord) {
+	if a.w == nil {
+		a.log.Info("Audit", "actor", r.Actor, "remote_address", r.RemoteAddr, "action", r.Action, "frontend", r.Frontend,
+			"host", r.Host, "detail", r.Detail, "status", r.Status, "error", r.Error)
+		return
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		a.log.Error("Unable to encode audit record", "error", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(data, '\n')); err != nil {
+		a.log.Error("Unable to write audit record", "error", err)
+	}
+}
+
+// actor names who sent the request.
+func (s *Server) actor(r *http.Request) string {
+	if r.TLS != nil {
+		if client, err := identity.FromConnectionState(*r.TLS, s.identitySource, nil); err == nil {
+			return client.String()
+		}
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,502 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tcp-load-balancer/internal/config"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+
+	"github.com/google/uuid"
+)
+
+// maxRequestBytes bounds the size of a request body.
+const maxRequestBytes = 64 * 1024
+
+// Frontend describes a running frontend.
+type Frontend struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Hosts       int    `json:"hosts"`
+	Connections int    `json:"connections"`
+}
+
+// Stats are the counters of a running frontend. Limiters may be shared by several frontends, in which case the
+// connections they rejected are counted for each of them.
+type Stats struct {
+	Frontend      string `json:"frontend"`
+	Hosts         int    `json:"hosts"`
+	HealthyHosts  int    `json:"healthyHosts"`
+	DrainingHosts int    `json:"drainingHosts"`
+	Connections   int    `json:"connections"`
+
+	// RejectedConnections failed authentication.
+	RejectedConnections uint64 `json:"rejectedConnections"`
+
+	// ConnectionLimitRejections and RateLimitRejections were refused by the connection and rate limiters.
+	ConnectionLimitRejections uint64 `json:"connectionLimitRejections"`
+	RateLimitRejections       uint64 `json:"rateLimitRejections"`
+}
+
+// Host describes an upstream host of a frontend.
+type Host struct {
+	Frontend    string            `json:"frontend"`
+	ID          uuid.UUID         `json:"id"`
+	Address     string            `json:"address"`
+	Pool        string            `json:"pool,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Weight      uint64            `json:"weight"`
+	Connections uint64            `json:"connections"`
+	Healthy     bool              `json:"healthy"`
+	Draining    bool              `json:"draining"`
+}
+
+// Connection describes a client connection which is being forwarded to a host.
+type Connection struct {
+	Frontend    string    `json:"frontend"`
+	ID          uint64    `json:"id"`
+	Client      string    `json:"client"`
+	ClientID    uuid.UUID `json:"clientId"`
+	HostID      uuid.UUID `json:"hostId"`
+	HostAddress string    `json:"hostAddress"`
+	Started     time.Time `json:"started"`
+}
+
+// AddHostRequest is the body of a request to add a host to a frontend.
+type AddHostRequest struct {
+	// Address is the address of the host, e.g. "10.0.0.1:8080".
+	Address string `json:"address"`
+
+	// Network is one of "tcp", "tcp4" or "tcp6". Defaults to "tcp".
+	Network string `json:"network,omitempty"`
+
+	// Pool, Labels and Weight are matched by authorization policies and weighted balancing strategies.
+	Pool   string            `json:"pool,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Weight uint64            `json:"weight,omitempty"`
+}
+
+// UpdateHostRequest is the body of a request to change a host. Fields which are nil are left unchanged.
+type UpdateHostRequest struct {
+	Weight *uint64 `json:"weight,omitempty"`
+}
+
+// Error is the body of a response to a request which failed.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// errNotFound is returned for a path which is not part of the API.
+var errNotFound = errors.New("not found")
+
+// ServeHTTP routes a request of the admin API:
+//
+//	GET    /frontends                              list the running frontends
+//	GET    /hosts?frontend=NAME                    list the hosts of every frontend, or of one frontend
+//	GET    /connections?frontend=NAME&client=NAME  list open connections, optionally filtered
+//	GET    /config                                 show the configuration in effect
+//	GET    /stats                                  show the counters of every frontend
+//	GET    /metrics                                metrics of every frontend in the Prometheus text format
+//	GET    /frontends/NAME/hosts                   list the hosts of a frontend
+//	POST   /frontends/NAME/hosts                   add a host to a frontend
+//	GET    /frontends/NAME/hosts/ID                show a host
+//	PATCH  /frontends/NAME/hosts/ID                change the weight of a host
+//	DELETE /frontends/NAME/hosts/ID                remove a host, closing its connections
+//	POST   /frontends/NAME/hosts/ID/drain?timeout= drain a host in the background, then remove it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "frontends":
+		s.allow(w, r, map[string]http.HandlerFunc{http.MethodGet: s.listFrontends})
+	case len(segments) == 1 && segments[0] == "hosts":
+		s.allow(w, r, map[string]http.HandlerFunc{http.MethodGet: func(w http.ResponseWriter, r *http.Request) {
+			s.listHosts(w, r, r.URL.Query().Get("frontend"))
+		}})
+	case len(segments) == 1 && segments[0] == "connections":
+		s.allow(w, r, map[string]http.HandlerFunc{http.MethodGet: s.listConnections})
+	case len(segments) == 1 && segments[0] == "config":
+		s.allow(w, r, map[string]http.HandlerFunc{http.MethodGet: s.showConfig})
+	case len(segments) == 1 && segments[0] == "stats":
+		s.allow(w, r, map[string]http.HandlerFunc{http.MethodGet: s.showStats})
+	case len(segments) == 1 && segments[0] == "metrics":
+		s.allow(w, r, map[string]http.HandlerFunc{http.MethodGet: s.showMetrics})
+	case len(segments) == 3 && segments[0] == "frontends" && segments[2] == "hosts":
+		frontend := segments[1]
+		s.allow(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:  func(w http.ResponseWriter, r *http.Request) { s.listHosts(w, r, frontend) },
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { s.addHost(w, r, frontend) },
+		})
+	case len(segments) == 4 && segments[0] == "frontends" && segments[2] == "hosts":
+		frontend, id := segments[1], segments[3]
+		s.allow(w, r, map[string]http.HandlerFunc{
+			http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { s.showHost(w, r, frontend, id) },
+			http.MethodPatch:  func(w http.ResponseWriter, r *http.Request) { s.updateHost(w, r, frontend, id) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { s.removeHost(w, r, frontend, id) },
+		})
+	case len(segments) == 5 && segments[0] == "frontends" && segments[2] == "hosts" && segments[4] == "drain":
+		frontend, id := segments[1], segments[3]
+		s.allow(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { s.drainHost(w, r, frontend, id) },
+		})
+	default:
+		s.writeError(w, http.StatusNotFound, errNotFound)
+	}
+}
+
+// allow calls the handler of the request's method, or responds that the method is not allowed.
+func (s *Server) allow(w http.ResponseWriter, r *http.Request, handlers map[string]http.HandlerFunc) {
+	if handler, ok := handlers[r.Method]; ok {
+		handler(w, r)
+		return
+	}
+
+	methods := make([]string, 0, len(handlers))
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		if _, ok := handlers[method]; ok {
+			methods = append(methods, method)
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	s.writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+}
+
+func (s *Server) listFrontends(w http.ResponseWriter, r *http.Request) {
+	frontends := []Frontend{}
+	for _, lb := range s.frontends.List() {
+		frontends = append(frontends, Frontend{
+			Name:        lb.Name(),
+			Address:     lb.Address().String(),
+			Hosts:       len(lb.Hosts()),
+			Connections: len(lb.Sessions()),
+		})
+	}
+	s.writeJSON(w, http.StatusOK, frontends)
+}
+
+// listHosts lists the hosts of the named frontend, or of every frontend if the name is empty.
+func (s *Server) listHosts(w http.ResponseWriter, r *http.Request, frontend string) {
+	lbs := s.frontends.List()
+	if frontend != "" {
+		lb, err := s.frontend(frontend)
+		if err != nil {
+			s.writeError(w, http.StatusNotFound, err)
+			return
+		}
+		lbs = []*server.LoadBalancer{lb}
+	}
+
+	hosts := []Host{}
+	for _, lb := range lbs {
+		for _, h := range lb.Hosts() {
+			hosts = append(hosts, describeHost(lb, h))
+		}
+	}
+	s.writeJSON(w, http.StatusOK, hosts)
+}
+
+// listConnections lists the open connections, filtered by the frontend, client and host parameters when they are set.
+// A client matches by its name, such as "billing", or with its source, such as "cn=billing".
+func (s *Server) listConnections(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	frontend, client, host := query.Get("frontend"), query.Get("client"), query.Get("host")
+
+	connections := []Connection{}
+	for _, lb := range s.frontends.List() {
+		if frontend != "" && lb.Name() != frontend {
+			continue
+		}
+		for _, session := range lb.Sessions() {
+			if client != "" && session.Client.Name != client && session.Client.String() != client {
+				continue
+			}
+			if host != "" && session.Host.ID().String() != host && session.Host.Address().String() != host {
+				continue
+			}
+			connections = append(connections, Connection{
+				Frontend:    lb.Name(),
+				ID:          session.ID,
+				Client:      session.Client.String(),
+				ClientID:    session.Client.ID,
+				HostID:      session.Host.ID(),
+				HostAddress: session.Host.Address().String(),
+				Started:     session.Started,
+			})
+		}
+	}
+	s.writeJSON(w, http.StatusOK, connections)
+}
+
+func (s *Server) showConfig(w http.ResponseWriter, r *http.Request) {
+	if s.config == nil {
+		s.writeError(w, http.StatusNotFound, errors.New("no configuration is available"))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.config())
+}
+
+func (s *Server) showStats(w http.ResponseWriter, r *http.Request) {
+	stats := []Stats{}
+	for _, lb := range s.frontends.List() {
+		st := Stats{
+			Frontend:            lb.Name(),
+			Connections:         len(lb.Sessions()),
+			RejectedConnections: lb.RejectedConnections(),
+		}
+		for _, h := range lb.Hosts() {
+			st.Hosts++
+			if h.Healthy() {
+				st.HealthyHosts++
+			}
+			if lb.Draining(h) {
+				st.DrainingHosts++
+			}
+		}
+		if limiter := lb.ConnectionLimiter(); limiter != nil {
+			st.ConnectionLimitRejections = limiter.Rejected()
+		}
+		if limiter := lb.RateLimiter(); limiter != nil {
+			st.RateLimitRejections = limiter.Rejected()
+		}
+		stats = append(stats, st)
+	}
+	s.writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) showHost(w http.ResponseWriter, r *http.Request, frontend, id string) {
+	lb, host, status, err := s.host(frontend, id)
+	if err != nil {
+		s.writeError(w, status, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, describeHost(lb, host))
+}
+
+func (s *Server) addHost(w http.ResponseWriter, r *http.Request, frontend string) {
+	record := s.newRecord(r, ActionAddHost, frontend)
+	var req AddHostRequest
+	if err := decodeRequest(r, &req); err != nil {
+		s.fail(w, record, http.StatusBadRequest, err)
+		return
+	}
+	record.Host = req.Address
+	record.Detail = fmt.Sprintf("weight %d", req.Weight)
+	if req.Pool != "" {
+		record.Detail += fmt.Sprintf(", pool %q", req.Pool)
+	}
+	if req.Address == "" {
+		s.fail(w, record, http.StatusBadRequest, errors.New("address is required"))
+		return
+	}
+	if req.Network == "" {
+		req.Network = config.TCPNetwork
+	}
+
+	host, err := upstream.New(req.Address, req.Network,
+		upstream.WithPool(req.Pool),
+		upstream.WithLabels(req.Labels),
+		upstream.WithWeight(req.Weight),
+		upstream.WithLogger(s.log.With("frontend", frontend)),
+	)
+	if err != nil {
+		s.fail(w, record, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lb, err := s.frontend(frontend)
+	if err != nil {
+		s.fail(w, record, http.StatusNotFound, err)
+		return
+	}
+	if _, ok := lb.Host(host.ID()); ok {
+		s.fail(w, record, http.StatusConflict, fmt.Errorf("host %s is already load balanced", host.Address()))
+		return
+	}
+	lb.AddUpstream(host)
+
+	s.succeed(w, record, http.StatusCreated, describeHost(lb, host))
+}
+
+func (s *Server) updateHost(w http.ResponseWriter, r *http.Request, frontend, id string) {
+	record := s.newRecord(r, ActionUpdateHost, frontend)
+	var req UpdateHostRequest
+	if err := decodeRequest(r, &req); err != nil {
+		s.fail(w, record, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lb, host, status, err := s.host(frontend, id)
+	if err != nil {
+		s.fail(w, record, status, err)
+		return
+	}
+	record.Host = host.Address().String()
+	if req.Weight != nil {
+		record.Detail = fmt.Sprintf("weight %d -> %d", host.Weight(), *req.Weight)
+		if err := host.SetWeight(*req.Weight); err != nil {
+			s.fail(w, record, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	s.succeed(w, record, http.StatusOK, describeHost(lb, host))
+}
+
+func (s *Server) removeHost(w http.ResponseWriter, r *http.Request, frontend, id string) {
+	record := s.newRecord(r, ActionRemoveHost, frontend)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lb, host, status, err := s.host(frontend, id)
+	if err != nil {
+		s.fail(w, record, status, err)
+		return
+	}
+	record.Host = host.Address().String()
+	described := describeHost(lb, host)
+	if err := lb.RemoveUpstream(host.ID()); err != nil {
+		s.fail(w, record, http.StatusNotFound, err)
+		return
+	}
+
+	s.succeed(w, record, http.StatusOK, described)
+}
+
+// drainHost stops sending new connections to the host, and removes it once its connections end or the timeout
+// passes. It responds as soon as the host is draining.
+func (s *Server) drainHost(w http.ResponseWriter, r *http.Request, frontend, id string) {
+	record := s.newRecord(r, ActionDrainHost, frontend)
+	var timeout time.Duration
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil || timeout < 0 {
+			s.fail(w, record, http.StatusBadRequest, fmt.Errorf("invalid timeout %q", t))
+			return
+		}
+		record.Detail = "timeout " + timeout.String()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lb, host, status, err := s.host(frontend, id)
+	if err != nil {
+		s.fail(w, record, status, err)
+		return
+	}
+	record.Host = host.Address().String()
+
+	go func() {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		defer cancel()
+		if err := lb.DrainUpstream(ctx, host.ID()); err != nil {
+			s.log.Error("Unable to drain upstream host", "frontend", frontend, "host_id", host.ID(), "host", host.Address(), "error", err)
+		}
+	}()
+
+	described := describeHost(lb, host)
+	described.Draining = true
+	s.succeed(w, record, http.StatusAccepted, described)
+}
+
+// frontend returns the named running frontend.
+func (s *Server) frontend(name string) (*server.LoadBalancer, error) {
+	lb, ok := s.frontends.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", server.ErrUnknownFrontend, name)
+	}
+	return lb, nil
+}
+
+// host returns the host of the named frontend with the given ID, or the status and error to respond with.
+func (s *Server) host(frontend, id string) (*server.LoadBalancer, *upstream.TcpHost, int, error) {
+	lb, err := s.frontend(frontend)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, err
+	}
+	hostID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("invalid host ID %q", id)
+	}
+	host, ok := lb.Host(hostID)
+	if !ok {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("%w: %s", server.ErrUnknownUpstream, hostID)
+	}
+	return lb, host, http.StatusOK, nil
+}
+
+// newRecord starts the audit record of a change.
+func (s *Server) newRecord(r *http.Request, action, frontend string) AuditRecord {
+	return AuditRecord{
+		Time:       time.Now(),
+		Actor:      s.actor(r),
+		RemoteAddr: r.RemoteAddr,
+		Action:     action,
+		Frontend:   frontend,
+	}
+}
+
+// succeed audits a change which was made, and responds with v.
+func (s *Server) succeed(w http.ResponseWriter, record AuditRecord, status int, v interface{}) {
+	record.Status = status
+	s.audit.record(record)
+	s.writeJSON(w, status, v)
+}
+
+// fail audits a change which was refused or failed, and responds with the error.
+func (s *Server) fail(w http.ResponseWriter, record AuditRecord, status int, err error) {
+	record.Status = status
+	record.Error = err.Error()
+	s.audit.record(record)
+	s.writeError(w, status, err)
+}
+
+// describeHost describes a host of the load balancer.
+func describeHost(lb *server.LoadBalancer, h *upstream.TcpHost) Host {
+	return Host{
+		Frontend:    lb.Name(),
+		ID:          h.ID(),
+		Address:     h.Address().String(),
+		Pool:        h.Pool(),
+		Labels:      h.Labels(),
+		Weight:      h.Weight(),
+		Connections: h.ConnectionCount(),
+		Healthy:     h.Healthy(),
+		Draining:    lb.Draining(h),
+	}
+}
+
+// decodeRequest decodes the JSON body of a request, rejecting unknown fields.
+func decodeRequest(r *http.Request, v interface{}) error {
+	d := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBytes))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	if err := e.Encode(v); err != nil {
+		s.log.Warn("Unable to write admin API response", "error", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	s.writeJSON(w, status, Error{Error: err.Error()})
+}
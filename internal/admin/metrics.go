@@ -0,0 +1,138 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"tcp-load-balancer/internal/metrics"
+	"tcp-load-balancer/internal/server"
+)
+
+// showMetrics writes the metrics of every frontend in the Prometheus text format.
+func (s *Server) showMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := writeMetrics(w, s.frontends.List()); err != nil {
+		s.log.Warn("Unable to write metrics", "error", err)
+	}
+}
+
+// writeMetrics writes the metrics of the frontends.
+func writeMetrics(w io.Writer, lbs []*server.LoadBalancer) error {
+	t := metrics.NewTextWriter(w)
+
+	t.Declare("tcp_lb_connections_accepted_total", metrics.Counter, "Connections accepted by the listener of the frontend.")
+	for _, lb := range lbs {
+		t.Sample("tcp_lb_connections_accepted_total", metrics.Labels{"frontend": lb.Name()}, float64(lb.AcceptedConnections()))
+	}
+
+	t.Declare("tcp_lb_connections_rejected_total", metrics.Counter, "Connections closed before being forwarded, by reason. Limiter rejections are counted by tcp_lb_limiter_rejections_total.")
+	for _, lb := range lbs {
+		for _, reason := range []struct {
+			name  string
+			count uint64
+		}{
+			{name: "authentication", count: lb.RejectedConnections()},
+			{name: "no_host", count: lb.UnroutableConnections()},
+			{name: "dial_failed", count: lb.DialFailures()},
+		} {
+			t.Sample("tcp_lb_connections_rejected_total", metrics.Labels{"frontend": lb.Name(), "reason": reason.name}, float64(reason.count))
+		}
+	}
+
+	t.Declare("tcp_lb_connections_active", metrics.Gauge, "Connections being forwarded to a host.")
+	for _, lb := range lbs {
+		t.Sample("tcp_lb_connections_active", metrics.Labels{"frontend": lb.Name()}, float64(len(lb.Sessions())))
+	}
+
+	t.Declare("tcp_lb_bytes_total", metrics.Counter, "Bytes forwarded, by direction: received from clients or sent to clients.")
+	for _, lb := range lbs {
+		t.Sample("tcp_lb_bytes_total", metrics.Labels{"frontend": lb.Name(), "direction": "received"}, float64(lb.BytesFromClients()))
+		t.Sample("tcp_lb_bytes_total", metrics.Labels{"frontend": lb.Name(), "direction": "sent"}, float64(lb.BytesToClients()))
+	}
+
+	t.Declare("tcp_lb_forward_errors_total", metrics.Counter, "Connections whose forwarding failed, by cause.")
+	for _, lb := range lbs {
+		for _, cause := range server.ForwardErrorCauses {
+			t.Sample("tcp_lb_forward_errors_total", metrics.Labels{"frontend": lb.Name(), "cause": cause.String()}, float64(lb.ForwardErrors(cause)))
+		}
+	}
+
+	t.Declare("tcp_lb_upstream_connections_active", metrics.Gauge, "Open connections to the upstream host.")
+	for _, lb := range lbs {
+		for _, h := range lb.Hosts() {
+			t.Sample("tcp_lb_upstream_connections_active", hostLabels(lb, h.Address().String()), float64(h.ConnectionCount()))
+		}
+	}
+
+	t.Declare("tcp_lb_upstream_healthy", metrics.Gauge, "Whether the upstream host is healthy (1) or not (0).")
+	for _, lb := range lbs {
+		for _, h := range lb.Hosts() {
+			healthy := 0.0
+			if h.Healthy() {
+				healthy = 1
+			}
+			t.Sample("tcp_lb_upstream_healthy", hostLabels(lb, h.Address().String()), healthy)
+		}
+	}
+
+	var series []metrics.Labels
+	var snapshots []metrics.HistogramSnapshot
+	for _, lb := range lbs {
+		for _, h := range lb.Hosts() {
+			series = append(series, hostLabels(lb, h.Address().String()))
+			snapshots = append(snapshots, h.DialDurations())
+		}
+	}
+	t.Histogram("tcp_lb_upstream_dial_duration_seconds", "Time taken to establish connections to the upstream host.", series, snapshots)
+
+	t.Declare("tcp_lb_limiter_rejections_total", metrics.Counter, "Connections refused by a limiter, which may be shared by several frontends.")
+	for _, l := range limiters(lbs) {
+		t.Sample("tcp_lb_limiter_rejections_total", metrics.Labels{"limiter": l.kind, "frontends": strings.Join(l.frontends, ",")}, float64(l.rejected))
+	}
+
+	return t.Flush()
+}
+
+// hostLabels returns the labels of a host of a frontend.
+func hostLabels(lb *server.LoadBalancer, host string) metrics.Labels {
+	return metrics.Labels{"frontend": lb.Name(), "host": host}
+}
+
+// limiterRejections are the rejections of a limiter, along with the frontends which share it.
+type limiterRejections struct {
+	// kind is "connection" or "rate".
+	kind string
+
+	frontends []string
+	rejected  uint64
+}
+
+// limiters returns the rejections of each distinct limiter of the frontends, so that a limiter shared by several
+// frontends is counted once.
+func limiters(lbs []*server.LoadBalancer) []*limiterRejections {
+	var found []*limiterRejections
+	seen := map[interface{}]*limiterRejections{}
+	add := func(limiter interface{}, kind, frontend string, rejected uint64) {
+		l, ok := seen[limiter]
+		if !ok {
+			l = &limiterRejections{kind: kind, rejected: rejected}
+			seen[limiter] = l
+			found = append(found, l)
+		}
+		l.frontends = append(l.frontends, frontend)
+	}
+	for _, lb := range lbs {
+		if limiter := lb.ConnectionLimiter(); limiter != nil {
+			add(limiter, "connection", lb.Name(), limiter.Rejected())
+		}
+		if limiter := lb.RateLimiter(); limiter != nil {
+			add(limiter, "rate", lb.Name(), limiter.Rejected())
+		}
+	}
+	for _, l := range found {
+		sort.Strings(l.frontends)
+	}
+	return found
+}
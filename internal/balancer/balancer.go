@@ -0,0 +1,68 @@
+package balancer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+var ErrNoHosts = errors.New("no upstream hosts available")
+
+// ConnInfo describes the client connection a host is being picked for.
+type ConnInfo struct {
+	// Client is the identity of the client which opened the connection.
+	Client identity.ClientIdentity
+}
+
+// Balancer picks the upstream host for a new client connection.
+// Implementations must be safe for concurrent use.
+type Balancer interface {
+	// Pick returns one of the candidate hosts for the connection, or ErrNoHosts if there are no candidates.
+	// Candidates are the hosts the client is authorized to reach, normally only the healthy ones. When none of them
+	// are healthy the unhealthy hosts are passed instead, so implementations must not assume a candidate is healthy.
+	Pick(candidates []*upstream.TcpHost, conn ConnInfo) (*upstream.TcpHost, error)
+}
+
+// Sampler is implemented by balancers which only compare a few candidates sampled at random. The load balancer then
+// samples hosts itself and checks only those, rather than filtering every host for each connection, and passes
+// SampleSize candidates to Pick.
+type Sampler interface {
+	Balancer
+
+	// SampleSize is the number of distinct candidates Pick compares.
+	SampleSize() int
+}
+
+// factories maps the configuration name of each strategy to a constructor.
+var factories = map[string]func() Balancer{
+	"least_connections":          func() Balancer { return LeastConnections{} },
+	"weighted_round_robin":       func() Balancer { return NewWeightedRoundRobin() },
+	"weighted_least_connections": func() Balancer { return WeightedLeastConnections{} },
+	"power_of_two":               func() Balancer { return PowerOfTwoChoices{} },
+	"ring_hash":                  func() Balancer { return NewRingHash(HashByClientID, DefaultVirtualNodes) },
+	"maglev":                     func() Balancer { return NewMaglev(HashByClientID, DefaultMaglevTableSize) },
+	"peak_ewma":                  func() Balancer { return PeakEWMA{} },
+}
+
+// New returns a new instance of the strategy with the given configuration name, e.g. "least_connections".
+func New(name string) (Balancer, error) {
+	factory, ok := factories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown balancing strategy %q, expected one of: %s", name, strings.Join(Names(), ", "))
+	}
+	return factory(), nil
+}
+
+// Names returns the configuration names of every strategy, in alphabetical order.
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,277 @@
+package balancer
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+const (
+	// DefaultVirtualNodes is the number of points each unit of host weight gets on a hash ring.
+	DefaultVirtualNodes = 100
+
+	// maxRingPoints bounds the number of points on a hash ring. When the weights of the hosts would place more, the
+	// points of every host are scaled down in proportion, keeping at least one per host.
+	maxRingPoints = 1 << 20
+
+	// DefaultMaglevTableSize is the size of a Maglev lookup table. It must be prime, and much larger than the number of hosts.
+	DefaultMaglevTableSize = 65537
+
+	// maxCachedTables bounds the number of lookup tables kept for distinct candidate sets.
+	// Candidate sets differ between clients when authorization policies apply, so more than one table is cached.
+	maxCachedTables = 16
+)
+
+// HashKey selects which attribute of a connection is hashed to pick a host.
+type HashKey int
+
+const (
+	// HashByClientID hashes the client identity, which is derived from the source IP when TLS is not used.
+	HashByClientID HashKey = iota
+	// HashBySourceIP hashes the source IP of the connection, even when the client presented a certificate.
+	HashBySourceIP
+)
+
+// lookupTable maps a key hash to a host.
+type lookupTable interface {
+	// lookup returns the host for the hash, or nil if the table is empty.
+	lookup(hash uint64) *upstream.TcpHost
+}
+
+// ConsistentHash sends every connection with the same key to the same host for as long as that host is a candidate.
+// When hosts are added or removed, only a minimal share of keys move to a different host.
+type ConsistentHash struct {
+	// key selects the attribute of the connection which is hashed.
+	key HashKey
+
+	// build creates a lookup table for a set of candidates.
+	build func(candidates []*upstream.TcpHost) lookupTable
+
+	// tables caches lookup tables by a hash of their candidates, since building a table is expensive.
+	tables map[uint64]lookupTable
+
+	// mu protects tables from concurrent access.
+	mu sync.Mutex
+}
+
+// NewRingHash returns a ConsistentHash which places virtualNodes points on a hash ring per unit of host weight,
+// and sends each key to the host owning the first point at or after the key's hash.
+func NewRingHash(key HashKey, virtualNodes int) *ConsistentHash {
+	if virtualNodes < 1 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	return &ConsistentHash{
+		key: key,
+		build: func(candidates []*upstream.TcpHost) lookupTable {
+			return newRing(candidates, virtualNodes)
+		},
+		tables: make(map[uint64]lookupTable),
+	}
+}
+
+// NewMaglev returns a ConsistentHash which uses a Maglev lookup table of tableSize entries.
+// Maglev spreads keys more evenly than a ring, at the cost of slightly more keys moving when hosts change.
+// The table size must be prime for every host to be able to claim every entry, so a size which is not prime is
+// rounded up to the next prime. A size below 2 means DefaultMaglevTableSize.
+func NewMaglev(key HashKey, tableSize uint64) *ConsistentHash {
+	if tableSize < 2 {
+		tableSize = DefaultMaglevTableSize
+	}
+	tableSize = nextPrime(tableSize)
+	return &ConsistentHash{
+		key: key,
+		build: func(candidates []*upstream.TcpHost) lookupTable {
+			return newMaglevTable(candidates, tableSize)
+		},
+		tables: make(map[uint64]lookupTable),
+	}
+}
+
+// Pick returns the host the connection's key maps to.
+func (c *ConsistentHash) Pick(candidates []*upstream.TcpHost, conn ConnInfo) (*upstream.TcpHost, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, ErrNoHosts
+	case 1:
+		return candidates[0], nil
+	}
+
+	host := c.table(candidates).lookup(hashString(c.keyOf(conn)))
+	if host == nil {
+		return nil, ErrNoHosts
+	}
+	return host, nil
+}
+
+// keyOf returns the string hashed to pick a host for the connection.
+func (c *ConsistentHash) keyOf(conn ConnInfo) string {
+	if c.key == HashBySourceIP && conn.Client.Addr != nil {
+		return identity.FromAddr(conn.Client.Addr).Name
+	}
+	return conn.Client.ID.String()
+}
+
+// table returns the cached lookup table for the candidates, building it if needed.
+func (c *ConsistentHash) table(candidates []*upstream.TcpHost) lookupTable {
+	// The weight is part of the signature so that weight changes rebuild the table.
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	for _, host := range candidates {
+		id := host.ID()
+		h.Write(id[:])
+		binary.LittleEndian.PutUint64(buf, host.Weight())
+		h.Write(buf)
+	}
+	signature := h.Sum64()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := c.tables[signature]; ok {
+		return t
+	}
+	if len(c.tables) >= maxCachedTables {
+		c.tables = make(map[uint64]lookupTable)
+	}
+	t := c.build(candidates)
+	c.tables[signature] = t
+	return t
+}
+
+// ringPoint is a point on a hash ring owned by a host.
+type ringPoint struct {
+	hash uint64
+	host *upstream.TcpHost
+}
+
+// ring is a lookupTable of points sorted by hash.
+type ring []ringPoint
+
+// newRing places virtualNodes points per unit of weight for each host on a ring, scaled down if that would place more
+// than maxRingPoints.
+func newRing(candidates []*upstream.TcpHost, virtualNodes int) ring {
+	var total uint64
+	for _, host := range candidates {
+		total += uint64(virtualNodes) * host.Weight()
+	}
+	scale := 1.0
+	if total > maxRingPoints {
+		scale = float64(maxRingPoints) / float64(total)
+	}
+
+	var r ring
+	for _, host := range candidates {
+		name := hostName(host)
+		points := int(float64(uint64(virtualNodes)*host.Weight()) * scale)
+		if points < 1 {
+			points = 1
+		}
+		for i := 0; i < points; i++ {
+			r = append(r, ringPoint{hash: hashString(name + "#" + strconv.Itoa(i)), host: host})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].hash < r[j].hash })
+	return r
+}
+
+// lookup returns the host owning the first point at or after the hash, wrapping around the ring.
+func (r ring) lookup(hash uint64) *upstream.TcpHost {
+	if len(r) == 0 {
+		return nil
+	}
+	i := sort.Search(len(r), func(i int) bool { return r[i].hash >= hash })
+	if i == len(r) {
+		i = 0
+	}
+	return r[i].host
+}
+
+// maglevTable is a lookupTable where each entry holds the host for keys hashing to that entry.
+type maglevTable []*upstream.TcpHost
+
+// nextPrime returns the smallest prime which is at least n, for n of 2 or more.
+func nextPrime(n uint64) uint64 {
+	for ; ; n++ {
+		prime := true
+		for d := uint64(2); d*d <= n; d++ {
+			if n%d == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			return n
+		}
+	}
+}
+
+// newMaglevTable fills a table of the given size by letting each host claim entries in the order of its own
+// permutation of the table, as described in "Maglev: A Fast and Reliable Software Network Load Balancer".
+// Hosts take turns in proportion to their weight, so filling the table takes about size turns whatever the weights.
+func newMaglevTable(candidates []*upstream.TcpHost, size uint64) maglevTable {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	offsets := make([]uint64, len(candidates))
+	skips := make([]uint64, len(candidates))
+	next := make([]uint64, len(candidates))
+	for i, host := range candidates {
+		name := hostName(host)
+		offsets[i] = hashString(name+"#offset") % size
+		skips[i] = hashString(name+"#skip")%(size-1) + 1
+	}
+
+	table := make(maglevTable, size)
+	filled := uint64(0)
+	for {
+		for i, host := range candidates {
+			for turn := uint64(0); turn < host.Weight(); turn++ {
+				entry := (offsets[i] + next[i]*skips[i]) % size
+				for table[entry] != nil {
+					next[i]++
+					entry = (offsets[i] + next[i]*skips[i]) % size
+				}
+				table[entry] = host
+				next[i]++
+				filled++
+				if filled == size {
+					return table
+				}
+			}
+		}
+	}
+}
+
+// lookup returns the host in the entry the hash maps to.
+func (t maglevTable) lookup(hash uint64) *upstream.TcpHost {
+	if len(t) == 0 {
+		return nil
+	}
+	return t[hash%uint64(len(t))]
+}
+
+// hostName is the stable name of a host used to place it in lookup tables.
+func hostName(host *upstream.TcpHost) string {
+	return host.ID().String()
+}
+
+// hashString returns a well mixed 64 bit hash of s.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+
+	// FNV alone clusters similar inputs, so the result is passed through the splitmix64 finalizer.
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,243 @@
+package balancer
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestConsistentHash_Pick(t *testing.T) {
+	strategies := []struct {
+		name string
+		new  func(key HashKey) *ConsistentHash
+		// exact is true when removing a host moves only the keys which were on that host.
+		exact bool
+	}{
+		{name: "ring hash", new: func(key HashKey) *ConsistentHash { return NewRingHash(key, DefaultVirtualNodes) }, exact: true},
+		{name: "maglev", new: func(key HashKey) *ConsistentHash { return NewMaglev(key, DefaultMaglevTableSize) }, exact: false},
+	}
+	for _, s := range strategies {
+		t.Run(s.name, func(t *testing.T) {
+			t.Run("same client is always sent to the same host", func(t *testing.T) {
+				b := s.new(HashByClientID)
+				hosts := newHashedHosts(t, 10)
+				conn := connFrom("10.0.0.1:5000")
+				first, err := b.Pick(hosts, conn)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < 100; i++ {
+					if got, _ := b.Pick(hosts, conn); got != first {
+						t.Fatal("ConsistentHash.Pick() sent the same client to a different host")
+					}
+				}
+			})
+
+			t.Run("source ip key ignores the client port and certificate", func(t *testing.T) {
+				b := s.new(HashBySourceIP)
+				hosts := newHashedHosts(t, 10)
+				first, _ := b.Pick(hosts, connFrom("10.0.0.1:5000"))
+				for i := 0; i < 100; i++ {
+					conn := connFrom(fmt.Sprintf("10.0.0.1:%d", 5001+i))
+					conn.Client.ID = identity.FromAddr(&net.TCPAddr{IP: net.IPv4(192, 168, 0, byte(i))}).ID
+					if got, _ := b.Pick(hosts, conn); got != first {
+						t.Fatal("ConsistentHash.Pick() sent the same source IP to a different host")
+					}
+				}
+			})
+
+			t.Run("keys are spread across hosts", func(t *testing.T) {
+				hosts := newHashedHosts(t, 10)
+				owners := assignKeys(t, s.new(HashByClientID), hosts, 10000)
+				counts := make(map[*upstream.TcpHost]int)
+				for _, h := range owners {
+					counts[h]++
+				}
+				for i, h := range hosts {
+					// Each host should own roughly a tenth of the keys; allow a generous margin to keep the test stable.
+					if counts[h] < 500 || counts[h] > 1500 {
+						t.Errorf("host %d owns %d of 10000 keys, want roughly 1000", i, counts[h])
+					}
+				}
+			})
+
+			t.Run("removing a host moves a minimal share of keys", func(t *testing.T) {
+				b := s.new(HashByClientID)
+				hosts := newHashedHosts(t, 10)
+				removed := hosts[3]
+				before := assignKeys(t, b, hosts, 10000)
+				after := assignKeys(t, b, append(append([]*upstream.TcpHost{}, hosts[:3]...), hosts[4:]...), 10000)
+
+				moved := 0
+				for i := range before {
+					if after[i] == removed {
+						t.Fatal("ConsistentHash.Pick() selected a host which is no longer a candidate")
+					}
+					if before[i] != after[i] {
+						moved++
+						if s.exact && before[i] != removed {
+							t.Fatal("a key which was not on the removed host moved")
+						}
+					}
+				}
+				// Ideally a tenth of the keys move; anything beyond a fifth is not consistent hashing.
+				if moved > 2000 {
+					t.Errorf("%d of 10000 keys moved after removing 1 of 10 hosts, want roughly 1000", moved)
+				}
+			})
+
+			t.Run("adding a host moves a minimal share of keys", func(t *testing.T) {
+				b := s.new(HashByClientID)
+				hosts := newHashedHosts(t, 11)
+				added := hosts[10]
+				before := assignKeys(t, b, hosts[:10], 10000)
+				after := assignKeys(t, b, hosts, 10000)
+
+				moved := 0
+				for i := range before {
+					if before[i] != after[i] {
+						moved++
+						if s.exact && after[i] != added {
+							t.Fatal("a key moved to a host other than the added host")
+						}
+					}
+				}
+				// Ideally an eleventh of the keys move.
+				if moved > 2000 {
+					t.Errorf("%d of 10000 keys moved after adding an 11th host, want roughly 900", moved)
+				}
+			})
+
+			t.Run("heavier hosts own more keys", func(t *testing.T) {
+				hosts := newHashedHosts(t, 2)
+				hosts[0].SetWeight(3)
+				owners := assignKeys(t, s.new(HashByClientID), hosts, 10000)
+				heavy := 0
+				for _, h := range owners {
+					if h == hosts[0] {
+						heavy++
+					}
+				}
+				// Ideally three quarters of the keys are on the heavier host.
+				if heavy < 6500 || heavy > 8500 {
+					t.Errorf("host with weight 3 owns %d of 10000 keys, want roughly 7500", heavy)
+				}
+			})
+
+			t.Run("the heaviest hosts still fit in the table", func(t *testing.T) {
+				hosts := newHashedHosts(t, 20)
+				for _, h := range hosts {
+					if err := h.SetWeight(upstream.MaxWeight); err != nil {
+						t.Fatal(err)
+					}
+				}
+				owners := assignKeys(t, s.new(HashByClientID), hosts, 1000)
+				for _, h := range owners {
+					if h == nil {
+						t.Fatal("ConsistentHash.Pick() returned no host")
+					}
+				}
+			})
+
+			t.Run("no hosts returns an error (and does not panic)", func(t *testing.T) {
+				if _, err := s.new(HashByClientID).Pick(nil, ConnInfo{}); err == nil {
+					t.Error("ConsistentHash.Pick() did not return an error")
+				}
+			})
+		})
+	}
+}
+
+func TestNewRing_Capped(t *testing.T) {
+	hosts := newHashedHosts(t, 20)
+	for _, h := range hosts {
+		if err := h.SetWeight(upstream.MaxWeight); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hosts[0].SetWeight(1)
+
+	r := newRing(hosts, DefaultVirtualNodes)
+	if len(r) > maxRingPoints+len(hosts) {
+		t.Errorf("ring has %d points, want at most %d", len(r), maxRingPoints)
+	}
+	owned := false
+	for _, p := range r {
+		if p.host == hosts[0] {
+			owned = true
+		}
+	}
+	if !owned {
+		t.Error("the lightest host has no points on a scaled down ring")
+	}
+
+	if got := ring(nil).lookup(1); got != nil {
+		t.Errorf("lookup on an empty ring = %v, want nil", got)
+	}
+}
+
+func TestNewMaglev_TableSizeNotPrime(t *testing.T) {
+	// With a table of 1000 entries, hosts whose permutation skips by a factor of 1000 could only reach some of the
+	// entries, and filling the table would never finish.
+	owners := assignKeys(t, NewMaglev(HashByClientID, 1000), newHashedHosts(t, 5), 100)
+	for _, h := range owners {
+		if h == nil {
+			t.Fatal("ConsistentHash.Pick() returned no host")
+		}
+	}
+}
+
+func Test_nextPrime(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want uint64
+	}{
+		{n: 2, want: 2},
+		{n: 4, want: 5},
+		{n: 1000, want: 1009},
+		{n: DefaultMaglevTableSize, want: DefaultMaglevTableSize},
+	}
+	for _, tt := range tests {
+		if got := nextPrime(tt.n); got != tt.want {
+			t.Errorf("nextPrime(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+// newHashedHosts returns n hosts with distinct IDs, since consistent hashing places hosts by ID.
+func newHashedHosts(t *testing.T, n int) []*upstream.TcpHost {
+	hosts := make([]*upstream.TcpHost, n)
+	for i := range hosts {
+		h, err := upstream.New(fmt.Sprintf("10.1.0.%d:8080", i+1), "tcp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts[i] = h
+	}
+	return hosts
+}
+
+// connFrom returns the connection of a client identified by its source address, as when TLS is not used.
+func connFrom(address string) ConnInfo {
+	addr, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		panic(err)
+	}
+	return ConnInfo{Client: identity.FromAddr(addr)}
+}
+
+// assignKeys picks a host for n distinct clients, and returns the host picked for each.
+func assignKeys(t *testing.T, b Balancer, hosts []*upstream.TcpHost, n int) []*upstream.TcpHost {
+	owners := make([]*upstream.TcpHost, n)
+	for i := range owners {
+		h, err := b.Pick(hosts, connFrom(fmt.Sprintf("10.%d.%d.%d:5000", i>>16&0xff, i>>8&0xff, i&0xff)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		owners[i] = h
+	}
+	return owners
+}
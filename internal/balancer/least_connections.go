@@ -0,0 +1,25 @@
+package balancer
+
+import (
+	"tcp-load-balancer/internal/upstream"
+)
+
+// LeastConnections picks the host with the fewest open connections. Ties go to the first host in the candidate list.
+type LeastConnections struct{}
+
+// Pick returns the candidate with the fewest open connections.
+func (LeastConnections) Pick(candidates []*upstream.TcpHost, _ ConnInfo) (*upstream.TcpHost, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoHosts
+	}
+
+	var selectedHost *upstream.TcpHost
+
+	for _, h := range candidates {
+		if selectedHost == nil || h.ConnectionCount() < selectedHost.ConnectionCount() {
+			selectedHost = h
+		}
+	}
+
+	return selectedHost, nil
+}
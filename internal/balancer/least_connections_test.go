@@ -1,4 +1,4 @@
-package server
+package balancer
 
 import (
 	"reflect"
@@ -7,16 +7,16 @@ import (
 	"tcp-load-balancer/internal/upstream"
 )
 
-func TestLoadBalancer_LeastConnections(t *testing.T) {
+func TestLeastConnections_Pick(t *testing.T) {
 	tests := []struct {
 		name            string
-		l               *LoadBalancer
+		hosts           []*upstream.TcpHost
 		wantErr         bool
 		wantHostAtIndex int
 	}{
 		{
 			name: "host with fewest connections is selected",
-			l: func() *LoadBalancer {
+			hosts: func() []*upstream.TcpHost {
 				h0 := &upstream.TcpHost{}
 				h0.IncrementActiveConnections()
 				h0.IncrementActiveConnections()
@@ -29,16 +29,14 @@ func TestLoadBalancer_LeastConnections(t *testing.T) {
 				h2.IncrementActiveConnections()
 				h2.IncrementActiveConnections()
 
-				return &LoadBalancer{
-					hosts: []*upstream.TcpHost{h0, h1, h2},
-				}
+				return []*upstream.TcpHost{h0, h1, h2}
 			}(),
 			wantErr:         false,
 			wantHostAtIndex: 1,
 		},
 		{
 			name: "first host in slice is selected when all connection counts are equal",
-			l: func() *LoadBalancer {
+			hosts: func() []*upstream.TcpHost {
 				h0 := &upstream.TcpHost{}
 				h0.IncrementActiveConnections()
 
@@ -48,31 +46,40 @@ func TestLoadBalancer_LeastConnections(t *testing.T) {
 				h2 := &upstream.TcpHost{}
 				h2.IncrementActiveConnections()
 
-				return &LoadBalancer{
-					hosts: []*upstream.TcpHost{h0, h1, h2},
-				}
+				return []*upstream.TcpHost{h0, h1, h2}
 			}(),
 			wantErr:         false,
 			wantHostAtIndex: 0,
 		},
 		{
 			name:    "no hosts returns an error (and does not panic)",
-			l:       &LoadBalancer{},
+			hosts:   nil,
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.l.LeastConnections()
+			got, err := LeastConnections{}.Pick(tt.hosts, ConnInfo{})
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("LoadBalancer.LeastConnections() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("LeastConnections.Pick() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
-			if !tt.wantErr && !reflect.DeepEqual(got, tt.l.Hosts()[tt.wantHostAtIndex]) {
-				t.Errorf("LoadBalancer.LeastConnections() = %v, want %v", got, tt.l.Hosts()[tt.wantHostAtIndex])
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.hosts[tt.wantHostAtIndex]) {
+				t.Errorf("LeastConnections.Pick() = %v, want %v", got, tt.hosts[tt.wantHostAtIndex])
 			}
 		})
 	}
 }
+
+func TestNew(t *testing.T) {
+	for _, name := range Names() {
+		if b, err := New(name); err != nil || b == nil {
+			t.Errorf("New(%q) = %v, %v", name, b, err)
+		}
+	}
+	if _, err := New("fastest"); err == nil {
+		t.Error("New() of an unknown strategy did not return an error")
+	}
+}
@@ -0,0 +1,49 @@
+package balancer
+
+import (
+	"math/rand"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+// PeakEWMA picks the host with the lowest expected cost of a new connection, which is the host's latency
+// multiplied by its open connections plus the one being placed. Latency is the moving average of the dial latency
+// and first byte latency of the host, which jumps to the peak when a host slows down and decays while a host
+// receives no connections. Hosts without latency observations are only compared by their connections, so new and
+// recovered hosts are tried. Ties are broken at random.
+type PeakEWMA struct{}
+
+// Pick returns the candidate with the lowest (latency + 1ns) * (open connections + 1).
+func (PeakEWMA) Pick(candidates []*upstream.TcpHost, _ ConnInfo) (*upstream.TcpHost, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoHosts
+	}
+
+	var selectedHost *upstream.TcpHost
+	var selectedCost float64
+	ties := 0
+
+	for _, h := range candidates {
+		cost := expectedCost(h)
+		switch {
+		case selectedHost == nil || cost < selectedCost:
+			selectedHost, selectedCost = h, cost
+			ties = 1
+		case cost == selectedCost:
+			// Reservoir sampling gives each tied host an equal chance of being picked.
+			ties++
+			if rand.Intn(ties) == 0 {
+				selectedHost = h
+			}
+		}
+	}
+
+	return selectedHost, nil
+}
+
+// expectedCost returns the expected cost of a new connection to the host, as compared by PeakEWMA.
+func expectedCost(h *upstream.TcpHost) float64 {
+	// The nanosecond added to the latency keeps connections counting for hosts without latency observations.
+	latency := float64(h.DialLatency()+h.FirstByteLatency()) + 1
+	return latency * float64(h.ConnectionCount()+1)
+}
@@ -0,0 +1,124 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestPeakEWMA_Pick(t *testing.T) {
+	t.Run("faster host is selected when connections are equal", func(t *testing.T) {
+		_, hosts := newTimedHosts(t, 2)
+		hosts[0].ObserveDialLatency(time.Millisecond * 50)
+		hosts[1].ObserveDialLatency(time.Millisecond * 5)
+
+		got, err := PeakEWMA{}.Pick(hosts, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != hosts[1] {
+			t.Error("PeakEWMA.Pick() did not select the faster host")
+		}
+	})
+
+	t.Run("first byte latency counts towards latency", func(t *testing.T) {
+		_, hosts := newTimedHosts(t, 2)
+		hosts[0].ObserveDialLatency(time.Millisecond * 5)
+		hosts[0].ObserveFirstByteLatency(time.Millisecond * 100)
+		hosts[1].ObserveDialLatency(time.Millisecond * 10)
+
+		got, err := PeakEWMA{}.Pick(hosts, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != hosts[1] {
+			t.Error("PeakEWMA.Pick() did not select the host which responds faster")
+		}
+	})
+
+	t.Run("busy fast host loses to an idle slower host", func(t *testing.T) {
+		_, hosts := newTimedHosts(t, 2)
+		hosts[0].ObserveDialLatency(time.Millisecond * 10)
+		hosts[1].ObserveDialLatency(time.Millisecond * 30)
+		for i := 0; i < 5; i++ {
+			hosts[0].IncrementActiveConnections()
+		}
+
+		// The fast host costs 10ms * 6, while the slow host costs 30ms * 1.
+		got, err := PeakEWMA{}.Pick(hosts, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != hosts[1] {
+			t.Error("PeakEWMA.Pick() did not take active connections into account")
+		}
+	})
+
+	t.Run("hosts without latency observations are compared by connections", func(t *testing.T) {
+		_, hosts := newTimedHosts(t, 2)
+		hosts[0].IncrementActiveConnections()
+
+		got, err := PeakEWMA{}.Pick(hosts, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != hosts[1] {
+			t.Error("PeakEWMA.Pick() did not select the host with fewer connections")
+		}
+	})
+
+	t.Run("recovered host receives connections once its latency decays", func(t *testing.T) {
+		c, hosts := newTimedHosts(t, 2)
+		hosts[0].ObserveDialLatency(time.Second * 2)
+		hosts[1].ObserveDialLatency(time.Millisecond * 20)
+		hosts[1].IncrementActiveConnections()
+
+		if got, _ := (PeakEWMA{}).Pick(hosts, ConnInfo{}); got != hosts[1] {
+			t.Fatal("PeakEWMA.Pick() selected the slow host")
+		}
+
+		// hosts[1] keeps receiving connections so its latency stays fresh, while hosts[0] receives none.
+		for i := 0; i < 10; i++ {
+			c.Advance(upstream.DefaultLatencyDecay)
+			hosts[1].ObserveDialLatency(time.Millisecond * 20)
+		}
+
+		if got, _ := (PeakEWMA{}).Pick(hosts, ConnInfo{}); got != hosts[0] {
+			t.Errorf("PeakEWMA.Pick() did not select the idle host after its latency of %v decayed", hosts[0].DialLatency())
+		}
+	})
+
+	t.Run("ties are not always broken in favor of the first host", func(t *testing.T) {
+		_, hosts := newTimedHosts(t, 3)
+		counts := pickCounts(t, PeakEWMA{}, hosts, 3000)
+		for i, h := range hosts {
+			// Each host should get roughly a third of the picks; allow a generous margin to keep the test stable.
+			if counts[h] < 700 {
+				t.Errorf("host %d was picked %d of 3000 times, want roughly 1000", i, counts[h])
+			}
+		}
+	})
+
+	t.Run("no hosts returns an error (and does not panic)", func(t *testing.T) {
+		if _, err := (PeakEWMA{}).Pick(nil, ConnInfo{}); err == nil {
+			t.Error("PeakEWMA.Pick() did not return an error")
+		}
+	})
+}
+
+// newTimedHosts returns n hosts which time their latency observations with the returned fake clock.
+func newTimedHosts(t *testing.T, n int) (*clock.Fake, []*upstream.TcpHost) {
+	c := clock.NewFake(time.Unix(0, 0))
+	hosts := make([]*upstream.TcpHost, n)
+	for i := range hosts {
+		h, err := upstream.New(fmt.Sprintf("10.2.0.%d:8080", i+1), "tcp", upstream.WithClock(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hosts[i] = h
+	}
+	return c, hosts
+}
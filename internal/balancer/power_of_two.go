@@ -0,0 +1,40 @@
+package balancer
+
+import (
+	"math/rand"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+// PowerOfTwoChoices samples two distinct candidates at random and picks the one with fewer open connections.
+// It gets close to the balance of LeastConnections while doing a constant amount of work per connection,
+// and avoids every connection that arrives at once herding onto the same least loaded host.
+type PowerOfTwoChoices struct{}
+
+// SampleSize returns 2, since two candidates are compared.
+func (PowerOfTwoChoices) SampleSize() int {
+	return 2
+}
+
+// Pick returns the less loaded of two randomly sampled candidates.
+func (PowerOfTwoChoices) Pick(candidates []*upstream.TcpHost, _ ConnInfo) (*upstream.TcpHost, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, ErrNoHosts
+	case 1:
+		return candidates[0], nil
+	}
+
+	// Sample j from the remaining n-1 positions so that i and j are always distinct.
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := candidates[i], candidates[j]
+	if b.ConnectionCount() < a.ConnectionCount() {
+		return b, nil
+	}
+	return a, nil
+}
@@ -0,0 +1,109 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestPowerOfTwoChoices_Pick(t *testing.T) {
+	t.Run("single host is selected", func(t *testing.T) {
+		h := &upstream.TcpHost{}
+		got, err := PowerOfTwoChoices{}.Pick([]*upstream.TcpHost{h}, ConnInfo{})
+		if err != nil || got != h {
+			t.Errorf("PowerOfTwoChoices.Pick() = %v, %v, want the only host", got, err)
+		}
+	})
+
+	t.Run("less loaded of two hosts is always selected", func(t *testing.T) {
+		busy, idle := &upstream.TcpHost{}, &upstream.TcpHost{}
+		busy.IncrementActiveConnections()
+
+		for i := 0; i < 100; i++ {
+			got, err := PowerOfTwoChoices{}.Pick([]*upstream.TcpHost{busy, idle}, ConnInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != idle {
+				t.Fatal("PowerOfTwoChoices.Pick() selected the busier of two hosts")
+			}
+		}
+	})
+
+	t.Run("most loaded host is never selected", func(t *testing.T) {
+		hosts := []*upstream.TcpHost{{}, {}, {}, {}}
+		for i := 0; i < 10; i++ {
+			hosts[2].IncrementActiveConnections()
+		}
+
+		for i := 0; i < 1000; i++ {
+			got, err := PowerOfTwoChoices{}.Pick(hosts, ConnInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got == hosts[2] {
+				t.Fatal("PowerOfTwoChoices.Pick() selected the most loaded host")
+			}
+		}
+	})
+
+	t.Run("connections are spread evenly as they are placed", func(t *testing.T) {
+		hosts := make([]*upstream.TcpHost, 10)
+		for i := range hosts {
+			hosts[i] = &upstream.TcpHost{}
+		}
+
+		for i := 0; i < 1000; i++ {
+			got, err := PowerOfTwoChoices{}.Pick(hosts, ConnInfo{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.IncrementActiveConnections()
+		}
+
+		// With two choices the maximum load stays within a few connections of the mean of 100.
+		for i, h := range hosts {
+			if h.ConnectionCount() < 90 || h.ConnectionCount() > 110 {
+				t.Errorf("host %d has %d connections, want close to 100", i, h.ConnectionCount())
+			}
+		}
+	})
+
+	t.Run("no hosts returns an error (and does not panic)", func(t *testing.T) {
+		if _, err := (PowerOfTwoChoices{}).Pick(nil, ConnInfo{}); err == nil {
+			t.Error("PowerOfTwoChoices.Pick() did not return an error")
+		}
+	})
+}
+
+// BenchmarkPick compares the cost of picking a host with PowerOfTwoChoices and the LeastConnections scan.
+func BenchmarkPick(b *testing.B) {
+	strategies := []struct {
+		name     string
+		balancer Balancer
+	}{
+		{name: "LeastConnections", balancer: LeastConnections{}},
+		{name: "PowerOfTwoChoices", balancer: PowerOfTwoChoices{}},
+	}
+
+	for _, n := range []int{10, 100, 1000} {
+		hosts := make([]*upstream.TcpHost, n)
+		for i := range hosts {
+			hosts[i] = &upstream.TcpHost{}
+			for c := 0; c < i%7; c++ {
+				hosts[i].IncrementActiveConnections()
+			}
+		}
+
+		for _, s := range strategies {
+			b.Run(fmt.Sprintf("%s/hosts=%d", s.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := s.balancer.Pick(hosts, ConnInfo{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package balancer
+
+import (
+	"math/rand"
+	"sync"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+// WeightedRoundRobin distributes connections in proportion to host weights using the smooth weighted round-robin
+// algorithm, which interleaves hosts rather than sending runs of consecutive connections to the heaviest host.
+// Weights are read on every pick, so changes made with SetWeight take effect immediately.
+type WeightedRoundRobin struct {
+	// current holds the current weight of each host.
+	current map[*upstream.TcpHost]int64
+
+	// mu protects current from concurrent access.
+	mu sync.Mutex
+}
+
+// NewWeightedRoundRobin returns a WeightedRoundRobin balancer.
+func NewWeightedRoundRobin() *WeightedRoundRobin {
+	return &WeightedRoundRobin{current: make(map[*upstream.TcpHost]int64)}
+}
+
+// Pick adds each candidate's weight to its current weight, picks the candidate with the highest current weight,
+// and reduces the picked candidate's current weight by the total weight of all candidates.
+func (b *WeightedRoundRobin) Pick(candidates []*upstream.TcpHost, _ ConnInfo) (*upstream.TcpHost, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoHosts
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var selectedHost *upstream.TcpHost
+	var total int64
+
+	for _, h := range candidates {
+		w := int64(h.Weight())
+		total += w
+		b.current[h] += w
+		if selectedHost == nil || b.current[h] > b.current[selectedHost] {
+			selectedHost = h
+		}
+	}
+	b.current[selectedHost] -= total
+
+	// Forget hosts which are no longer candidates once they make up most of the state, so removed hosts do not leak.
+	if len(b.current) > 2*len(candidates) {
+		b.prune(candidates)
+	}
+
+	return selectedHost, nil
+}
+
+// prune removes the state of every host which is not a candidate.
+func (b *WeightedRoundRobin) prune(candidates []*upstream.TcpHost) {
+	keep := make(map[*upstream.TcpHost]bool, len(candidates))
+	for _, h := range candidates {
+		keep[h] = true
+	}
+	for h := range b.current {
+		if !keep[h] {
+			delete(b.current, h)
+		}
+	}
+}
+
+// WeightedLeastConnections picks the host with the fewest open connections relative to its weight.
+// Ties are broken at random, so equally loaded hosts share connections rather than favoring the first candidate.
+type WeightedLeastConnections struct{}
+
+// Pick returns the candidate with the lowest (open connections + 1) / weight. Counting the connection being
+// placed means an idle heavy host is preferred over an idle light host.
+func (WeightedLeastConnections) Pick(candidates []*upstream.TcpHost, _ ConnInfo) (*upstream.TcpHost, error) {
+	if len(candidates) == 0 {
+		return nil, ErrNoHosts
+	}
+
+	var selectedHost *upstream.TcpHost
+	var selectedLoad, selectedWeight uint64
+	ties := 0
+
+	for _, h := range candidates {
+		load, weight := h.ConnectionCount()+1, h.Weight()
+
+		// Compare load/weight ratios by cross multiplication to avoid floating point rounding.
+		switch {
+		case selectedHost == nil || load*selectedWeight < selectedLoad*weight:
+			selectedHost, selectedLoad, selectedWeight = h, load, weight
+			ties = 1
+		case load*selectedWeight == selectedLoad*weight:
+			// Reservoir sampling gives each tied host an equal chance of being picked.
+			ties++
+			if rand.Intn(ties) == 0 {
+				selectedHost, selectedLoad, selectedWeight = h, load, weight
+			}
+		}
+	}
+
+	return selectedHost, nil
+}
@@ -0,0 +1,106 @@
+package balancer
+
+import (
+	"testing"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestWeightedRoundRobin_Pick(t *testing.T) {
+	a, b, c := newWeightedHost(5), newWeightedHost(1), newWeightedHost(1)
+	hosts := []*upstream.TcpHost{a, b, c}
+	wrr := NewWeightedRoundRobin()
+
+	// The smooth algorithm produces a a b a c a a for weights 5, 1, 1.
+	want := []*upstream.TcpHost{a, a, b, a, c, a, a}
+	for i, w := range want {
+		got, err := wrr.Pick(hosts, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != w {
+			t.Errorf("pick %d = host with weight %d, want host with weight %d", i, got.Weight(), w.Weight())
+		}
+	}
+
+	t.Run("weight changes take effect at runtime", func(t *testing.T) {
+		b.SetWeight(5)
+		counts := pickCounts(t, wrr, hosts, 1100)
+		if counts[a] != 500 || counts[b] != 500 || counts[c] != 100 {
+			t.Errorf("pick counts after weight change = %d, %d, %d, want 500, 500, 100", counts[a], counts[b], counts[c])
+		}
+	})
+
+	t.Run("no hosts returns an error (and does not panic)", func(t *testing.T) {
+		if _, err := wrr.Pick(nil, ConnInfo{}); err == nil {
+			t.Error("WeightedRoundRobin.Pick() did not return an error")
+		}
+	})
+}
+
+func TestWeightedLeastConnections_Pick(t *testing.T) {
+	t.Run("host with the lowest connections per weight is selected", func(t *testing.T) {
+		heavy, light := newWeightedHost(4), newWeightedHost(1)
+		for i := 0; i < 3; i++ {
+			heavy.IncrementActiveConnections()
+		}
+		// heavy has (3+1)/4 = 1 and light has (0+1)/1 = 1, so one more connection on heavy tips the balance.
+		heavy.IncrementActiveConnections()
+
+		got, err := WeightedLeastConnections{}.Pick([]*upstream.TcpHost{heavy, light}, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != light {
+			t.Error("WeightedLeastConnections.Pick() did not select the host with the lowest connections per weight")
+		}
+	})
+
+	t.Run("idle heavier host is preferred", func(t *testing.T) {
+		light, heavy := newWeightedHost(1), newWeightedHost(3)
+		got, err := WeightedLeastConnections{}.Pick([]*upstream.TcpHost{light, heavy}, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != heavy {
+			t.Error("WeightedLeastConnections.Pick() did not prefer the idle heavier host")
+		}
+	})
+
+	t.Run("ties are not always broken in favor of the first host", func(t *testing.T) {
+		hosts := []*upstream.TcpHost{newWeightedHost(2), newWeightedHost(2), newWeightedHost(2)}
+		counts := pickCounts(t, WeightedLeastConnections{}, hosts, 3000)
+		for i, h := range hosts {
+			// Each host should get roughly a third of the picks; allow a generous margin to keep the test stable.
+			if counts[h] < 700 {
+				t.Errorf("host %d was picked %d of 3000 times, want roughly 1000", i, counts[h])
+			}
+		}
+	})
+
+	t.Run("no hosts returns an error (and does not panic)", func(t *testing.T) {
+		if _, err := (WeightedLeastConnections{}).Pick(nil, ConnInfo{}); err == nil {
+			t.Error("WeightedLeastConnections.Pick() did not return an error")
+		}
+	})
+}
+
+// newWeightedHost is a helper to create a host with the given weight.
+func newWeightedHost(weight uint64) *upstream.TcpHost {
+	h := &upstream.TcpHost{}
+	h.SetWeight(weight)
+	return h
+}
+
+// pickCounts picks n times without changing connection counts, and returns how often each host was picked.
+func pickCounts(t *testing.T, b Balancer, hosts []*upstream.TcpHost, n int) map[*upstream.TcpHost]int {
+	counts := make(map[*upstream.TcpHost]int)
+	for i := 0; i < n; i++ {
+		h, err := b.Pick(hosts, ConnInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[h]++
+	}
+	return counts
+}
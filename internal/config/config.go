@@ -1,16 +1,65 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"net"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+var (
+	// ErrConflictingFlags is returned when flags which the configuration file replaces are set along with -config.
+	ErrConflictingFlags = errors.New("flags cannot be used with -config")
+
+	// ErrAdminNotLoopback is returned when the admin API, which is served without authentication over plain HTTP
+	// unless TLS is configured, would listen on an address other clients can reach.
+	ErrAdminNotLoopback = errors.New("the admin API must listen on a loopback address unless it requires TLS")
+)
+
 const (
 	// selectOpenPort will pick an available random port for TCP connections.
 	SelectOpenPort = ":0"
 	// UpstreamHostTimeout gives the upstream hosts an alloted time to respond before returning an error.
 	UpstreamHostTimeout = time.Second * 2
+	// MaxConnectionsPerClient limits the number of connections each client may have open at once.
+	MaxConnectionsPerClient = 10
+	// ClientConnectionsPerSecond and ClientConnectionBurst limit how often each client may open new connections.
+	ClientConnectionsPerSecond = 5
+	ClientConnectionBurst      = 10
+	// GlobalConnectionsPerSecond and GlobalConnectionBurst limit how often new connections are accepted in total.
+	GlobalConnectionsPerSecond = 1000
+	GlobalConnectionBurst      = 2000
+	// HandshakeTimeout gives clients an alloted time to complete the TLS handshake.
+	HandshakeTimeout = time.Second * 5
+	// DialTimeout bounds the total time spent dialing upstream hosts for a single client connection.
+	DialTimeout = time.Second * 10
+	// DialAttempts is the maximum number of upstream hosts dialed for a single client connection.
+	DialAttempts = 3
+	// RateLimiterIdleTTL controls how long the rate limiter remembers a client after its last connection.
+	RateLimiterIdleTTL = time.Minute
+	// HealthCheckInterval controls how often upstream hosts are actively probed.
+	HealthCheckInterval = time.Second * 5
+	// HealthCheckTimeout gives each health check probe an alloted time to succeed.
+	HealthCheckTimeout = time.Second * 2
+	// HealthCheckJitter is the maximum random delay added to each health check interval.
+	HealthCheckJitter = time.Millisecond * 500
+	// HealthyThreshold and UnhealthyThreshold are the number of consecutive probe results which change the health of a host.
+	HealthyThreshold   = 2
+	UnhealthyThreshold = 3
+	// ShutdownTimeout gives open connections an alloted time to finish after the load balancer is told to stop.
+	ShutdownTimeout = time.Second * 30
+	// ConfigPollInterval controls how often the configuration file is checked for changes.
+	ConfigPollInterval = time.Second * 2
+	// DrainTimeout gives open connections to hosts removed from the configuration an alloted time to finish.
+	DrainTimeout = time.Minute * 5
+	// AccessLogMaxSizeMB is the size in megabytes above which the access log file is rotated.
+	AccessLogMaxSizeMB = 100
+	// AccessLogMaxBackups is the number of rotated access log files which are kept.
+	AccessLogMaxBackups = 5
 	// tcpNetwork could eventually be one of "tcp", "tcp4", "tcp6", but this project currently only supports "tcp".
 	TCPNetwork = "tcp"
 
@@ -25,9 +74,105 @@ const (
 	// ------ End Static Host/Client Config ------
 )
 
-// GetPort returns the port number to listen on. If no port flag is set, it returns default for finding an available port, which is ":0"
-func GetPort() string {
-	port := flag.Int("p", 0, "Port for the load balancer to listen on")
-	flag.Parse()
-	return ":" + strconv.Itoa(*port)
+// Flags holds the command line flags of the load balancer.
+type Flags struct {
+	// Port is the address to listen on. If no port flag is set, it is the default for finding an available port, which is ":0"
+	Port string
+
+	// PolicyPath is the path of the authorization policy file. If empty, every client may reach every upstream host.
+	PolicyPath string
+
+	// Strategy is the name of the balancing strategy used to pick a host for each connection.
+	Strategy string
+
+	// StickyTTL is how long a client stays pinned to the host it was last sent to. Zero disables sticky sessions.
+	StickyTTL time.Duration
+
+	// ConfigPath is the path of the JSON configuration file. When set, it replaces every other flag except Demo, and
+	// setting any of them is an error.
+	ConfigPath string
+
+	// AdminAddress is the address of the HTTP admin API. If empty, the API is not served.
+	AdminAddress string
+
+	// AccessLogPath is the path of the file which records every connection as JSON lines. If empty, connections are not recorded.
+	AccessLogPath string
+
+	// LogLevel is the least severe level of messages which are logged, and LogFormat is how they are encoded.
+	LogLevel  string
+	LogFormat string
+
+	// Demo starts static hosts and clients which send traffic through the load balancer, using generated certificates.
+	Demo bool
+}
+
+// replacedFlags are the names of the flags which the configuration file replaces.
+var replacedFlags = []string{"p", "policy", "strategy", "sticky-ttl", "admin", "access-log", "log-level", "log-format"}
+
+// ParseFlags parses the command line flags of the load balancer. It returns ErrConflictingFlags if -config is set
+// along with flags which the configuration file replaces, rather than ignoring them.
+func ParseFlags() (Flags, error) {
+	return parseFlags(flag.CommandLine, os.Args[1:])
+}
+
+// parseFlags parses the arguments with the flag set.
+func parseFlags(fs *flag.FlagSet, args []string) (Flags, error) {
+	port := fs.Int("p", 0, "Port for the load balancer to listen on")
+	policyPath := fs.String("policy", "", "Path of the JSON authorization policy file")
+	strategy := fs.String("strategy", "least_connections", "Balancing strategy used to pick a host for each connection")
+	stickyTTL := fs.Duration("sticky-ttl", 0, "How long a client stays pinned to the host it was last sent to after its last connection; 0 disables sticky sessions")
+	configPath := fs.String("config", "", "Path of the JSON configuration file, which replaces -"+strings.Join(replacedFlags, ", -")+"; those flags cannot be set along with it")
+	adminAddress := fs.String("admin", "", "Address of the HTTP admin API, e.g. 127.0.0.1:9090; the API is not served unless set")
+	accessLogPath := fs.String("access-log", "", "Path of the file which records every connection as JSON lines; connections are not recorded unless set")
+	logLevel := fs.String("log-level", "info", "Least severe level of messages which are logged: debug, info, warn or error")
+	logFormat := fs.String("log-format", "text", "Encoding of logged messages: text or json")
+	demo := fs.Bool("demo", false, "Start static hosts and clients which send traffic through the load balancer over mTLS with generated certificates")
+	if err := fs.Parse(args); err != nil {
+		return Flags{}, err
+	}
+
+	if *adminAddress != "" && !IsLoopback(*adminAddress) {
+		return Flags{}, fmt.Errorf("%w: -admin %s; configure admin.tls in a configuration file to serve it elsewhere", ErrAdminNotLoopback, *adminAddress)
+	}
+
+	if *configPath != "" {
+		var conflicting []string
+		fs.Visit(func(f *flag.Flag) {
+			for _, name := range replacedFlags {
+				if f.Name == name {
+					conflicting = append(conflicting, "-"+name)
+				}
+			}
+		})
+		if len(conflicting) > 0 {
+			return Flags{}, fmt.Errorf("%w: %s; set them in the configuration file instead", ErrConflictingFlags, strings.Join(conflicting, ", "))
+		}
+	}
+
+	return Flags{
+		Port:          ":" + strconv.Itoa(*port),
+		PolicyPath:    *policyPath,
+		Strategy:      *strategy,
+		StickyTTL:     *stickyTTL,
+		ConfigPath:    *configPath,
+		AdminAddress:  *adminAddress,
+		AccessLogPath: *accessLogPath,
+		LogLevel:      *logLevel,
+		LogFormat:     *logFormat,
+		Demo:          *demo,
+	}, nil
+}
+
+// IsLoopback reports whether the address, such as "127.0.0.1:9090" or "localhost:9090", only accepts connections from
+// the same machine. An address without a host, such as ":9090", listens on every interface.
+func IsLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
 }
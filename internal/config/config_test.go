@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name: "flags without a configuration file",
+			args: []string{"-p", "5000", "-admin", "127.0.0.1:9090", "-log-level", "debug"},
+		},
+		{
+			name: "configuration file with the demo",
+			args: []string{"-config", "config.json", "-demo"},
+		},
+		{
+			name:    "admin API on every interface",
+			args:    []string{"-admin", ":9090"},
+			wantErr: ErrAdminNotLoopback,
+			wantMsg: ":9090",
+		},
+		{
+			name:    "configuration file with flags it replaces",
+			args:    []string{"-admin", "127.0.0.1:9090", "-config", "config.json", "-log-format", "json"},
+			wantErr: ErrConflictingFlags,
+			wantMsg: "-admin, -log-format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("lb", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			_, err := parseFlags(fs, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseFlags() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("parseFlags() error = %q, want it to name %s", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:9090": true,
+		"[::1]:9090":     true,
+		"localhost:9090": true,
+		":9090":          false,
+		"0.0.0.0:9090":   false,
+		"10.0.0.1:9090":  false,
+		"localhost":      false,
+	}
+	for address, want := range tests {
+		if got := IsLoopback(address); got != want {
+			t.Errorf("IsLoopback(%q) = %v, want %v", address, got, want)
+		}
+	}
+}
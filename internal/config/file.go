@@ -0,0 +1,536 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/policy"
+)
+
+// DefaultStrategy is the balancing strategy of a listener which does not set one.
+const DefaultStrategy = "least_connections"
+
+// DefaultPool is the name of the pool used when the configuration comes from command line flags.
+const DefaultPool = "default"
+
+// File is the declarative configuration of the load balancer, read from a JSON file.
+type File struct {
+	// Listeners are the frontends of the load balancer: the addresses it accepts connections on, and how each is served.
+	Listeners []Listener `json:"listeners"`
+
+	// Pools are named groups of upstream hosts which listeners forward to.
+	Pools []Pool `json:"pools"`
+
+	// Timeouts bound how long the load balancer waits for clients and hosts.
+	Timeouts Timeouts `json:"timeouts"`
+
+	// Retry controls failover to other hosts when dialing a host fails.
+	Retry Retry `json:"retry"`
+
+	// Limits restrict how many connections clients may open. They are shared by every listener without limits of
+	// its own, so a client's connections to all of those listeners count towards the same limits.
+	Limits Limits `json:"limits"`
+
+	// HealthCheck controls active health checks of upstream hosts.
+	HealthCheck HealthCheck `json:"healthCheck"`
+
+	// Policy decides which clients may reach which upstream hosts. When neither Policy nor PolicyFile is set,
+	// every client may reach every host.
+	Policy *Policy `json:"policy,omitempty"`
+
+	// PolicyFile is the path of a JSON policy file, used instead of an inline Policy.
+	PolicyFile string `json:"policyFile,omitempty"`
+
+	// Admin enables the HTTP admin API. When nil, the API is not served.
+	Admin *Admin `json:"admin,omitempty"`
+
+	// AccessLog records every connection proxied by the load balancer. When nil, connections are not recorded.
+	AccessLog *AccessLog `json:"accessLog,omitempty"`
+
+	// Logging controls the messages the load balancer logs to stderr.
+	Logging Logging `json:"logging"`
+}
+
+// Logging controls the messages the load balancer logs to stderr.
+type Logging struct {
+	// Level is the least severe level of messages which are logged: "debug", "info", "warn" or "error".
+	// Defaults to "info".
+	Level string `json:"level,omitempty"`
+
+	// Format is "text" for a line of text per message, or "json" for a JSON object per line. Defaults to "text".
+	Format string `json:"format,omitempty"`
+}
+
+// AccessLog is the file which records every connection proxied by the load balancer, one record per line.
+type AccessLog struct {
+	// Path is the path of the file.
+	Path string `json:"path"`
+
+	// Format is "json" for JSON lines, or "logfmt". Defaults to "json".
+	Format string `json:"format,omitempty"`
+
+	// MaxSizeMB is the size in megabytes above which the file is rotated. Defaults to AccessLogMaxSizeMB.
+	MaxSizeMB int64 `json:"maxSizeMB,omitempty"`
+
+	// MaxBackups is the number of rotated files which are kept. Defaults to AccessLogMaxBackups.
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// Admin is the HTTP API used to inspect and manage the running load balancer.
+type Admin struct {
+	// Address is the address the API listens on, e.g. "127.0.0.1:9090". It must differ from the listeners.
+	Address string `json:"address"`
+
+	// TLS requires clients of the API to present a certificate signed by the client CA. Its identity source names
+	// the actor of each change in the audit log. When nil, the API is served over plain HTTP.
+	TLS *TLS `json:"tls,omitempty"`
+
+	// AuditLog is the path of the file which records changes made through the API, one JSON record per line.
+	// When empty, changes are recorded in the log.
+	AuditLog string `json:"auditLog,omitempty"`
+}
+
+// Listener is an address the load balancer accepts connections on.
+type Listener struct {
+	// Name identifies the listener in logs and errors.
+	Name string `json:"name"`
+
+	// Address is the address to listen on, e.g. ":50043". Port 0 selects an available port.
+	Address string `json:"address"`
+
+	// Network is one of "tcp", "tcp4" or "tcp6". Defaults to "tcp".
+	Network string `json:"network,omitempty"`
+
+	// Pool is the name of the pool connections are forwarded to.
+	Pool string `json:"pool"`
+
+	// Strategy is the name of the balancing strategy used to pick a host from the pool. Defaults to DefaultStrategy.
+	Strategy string `json:"strategy,omitempty"`
+
+	// StickyTTL is how long a client stays pinned to the host it was last sent to. Zero disables sticky sessions.
+	StickyTTL Duration `json:"stickyTTL,omitempty"`
+
+	// TLS enables mutual TLS on the listener. When nil, connections are accepted without TLS.
+	TLS *TLS `json:"tls,omitempty"`
+
+	// Limits restrict how many connections clients may open to this listener. When nil, the listener shares the
+	// top-level limits with other listeners.
+	Limits *Limits `json:"limits,omitempty"`
+}
+
+// TLS is the certificate material used to terminate mutual TLS.
+type TLS struct {
+	// CertFile and KeyFile are the paths of the PEM encoded server certificate and private key.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+
+	// ClientCAFile is the path of the PEM encoded certificates of the CAs which sign client certificates.
+	ClientCAFile string `json:"clientCAFile"`
+
+	// IdentitySource selects which field of the client certificate identifies the client, e.g. "cn" or "spiffe".
+	// Defaults to "cn".
+	IdentitySource string `json:"identitySource,omitempty"`
+}
+
+// Pool is a named group of upstream hosts.
+type Pool struct {
+	// Name identifies the pool. It is also the pool name matched by authorization policies.
+	Name string `json:"name"`
+
+	// Hosts are the upstream hosts in the pool.
+	Hosts []Host `json:"hosts"`
+}
+
+// Host is an upstream host.
+type Host struct {
+	// Address is the address of the host, e.g. "10.0.0.1:8080".
+	Address string `json:"address"`
+
+	// Weight is the relative capacity of the host, at most upstream.MaxWeight. Zero means the default weight of 1.
+	Weight uint64 `json:"weight,omitempty"`
+
+	// Labels are matched by authorization policies.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Timeouts bound how long the load balancer waits for clients and hosts. Zero fields take their default.
+type Timeouts struct {
+	// Host is how long the load balancer waits for a response from a host.
+	Host Duration `json:"host,omitempty"`
+
+	// Handshake is how long a client has to complete the TLS handshake.
+	Handshake Duration `json:"handshake,omitempty"`
+
+	// Dial bounds the total time spent dialing hosts for a single client connection.
+	Dial Duration `json:"dial,omitempty"`
+
+	// Shutdown is how long open connections have to finish when the load balancer stops.
+	Shutdown Duration `json:"shutdown,omitempty"`
+
+	// Drain is how long open connections to a host removed from the configuration have to finish.
+	Drain Duration `json:"drain,omitempty"`
+}
+
+// Retry controls failover to other hosts when dialing a host fails.
+type Retry struct {
+	// MaxAttempts is the maximum number of hosts dialed for a single client connection. Zero means the default.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+}
+
+// Limits restrict how many connections clients may open.
+type Limits struct {
+	// MaxConnectionsPerClient is the number of connections each client may have open at once. Zero is unlimited.
+	MaxConnectionsPerClient uint64 `json:"maxConnectionsPerClient,omitempty"`
+
+	// ClientConnectionOverrides override MaxConnectionsPerClient for clients with the given names.
+	ClientConnectionOverrides map[string]uint64 `json:"clientConnectionOverrides,omitempty"`
+
+	// PerClientRate limits how often each client may open new connections. When nil, clients are not rate limited.
+	PerClientRate *Rate `json:"perClientRate,omitempty"`
+
+	// GlobalRate limits how often new connections are accepted in total. When nil, there is no global rate limit.
+	GlobalRate *Rate `json:"globalRate,omitempty"`
+
+	// RateLimiterIdleTTL is how long the rate limiter remembers a client after its last connection.
+	RateLimiterIdleTTL Duration `json:"rateLimiterIdleTTL,omitempty"`
+}
+
+// Rate is a sustained number of new connections per second, and the burst allowed above that rate.
+type Rate struct {
+	PerSecond float64 `json:"perSecond"`
+	Burst     int     `json:"burst"`
+}
+
+// HealthCheck controls active health checks of upstream hosts. Zero fields take their default.
+type HealthCheck struct {
+	// Disabled turns off active health checks. Hosts are still marked unhealthy by failed connections.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Interval is the time between rounds of probes.
+	Interval Duration `json:"interval,omitempty"`
+
+	// Timeout bounds each probe.
+	Timeout Duration `json:"timeout,omitempty"`
+
+	// HealthyThreshold and UnhealthyThreshold are the number of consecutive probe results which change the health of a host.
+	HealthyThreshold   int `json:"healthyThreshold,omitempty"`
+	UnhealthyThreshold int `json:"unhealthyThreshold,omitempty"`
+
+	// Jitter is the maximum random delay added to each interval, so that load balancers do not probe in lockstep.
+	// Zero means the default of 500ms, and a negative jitter, such as "-1s", probes at exactly the interval.
+	Jitter Duration `json:"jitter,omitempty"`
+
+	// Probe is how each host is checked: ProbeTCP, ProbeSendExpect or ProbeHTTP. Defaults to ProbeTCP.
+	Probe string `json:"probe,omitempty"`
+
+	// Send is written to each host by the send/expect probe, and Expect must appear in its response.
+	Send   string `json:"send,omitempty"`
+	Expect string `json:"expect,omitempty"`
+
+	// Path is requested by the HTTP probe, and ExpectedStatus is the status it requires. When zero, any 2xx status
+	// is accepted.
+	Path           string `json:"path,omitempty"`
+	ExpectedStatus int    `json:"expectedStatus,omitempty"`
+}
+
+// Probes of active health checks.
+const (
+	// ProbeTCP considers a host healthy if it accepts a TCP connection.
+	ProbeTCP = "tcp"
+
+	// ProbeSendExpect considers a host healthy if its response to HealthCheck.Send contains HealthCheck.Expect.
+	ProbeSendExpect = "send_expect"
+
+	// ProbeHTTP considers a host healthy if a GET request for HealthCheck.Path returns the expected status.
+	ProbeHTTP = "http"
+)
+
+// Policy is an inline authorization policy, in the same format as a policy file.
+type Policy struct {
+	Rules []policy.Rule `json:"rules"`
+}
+
+// Duration is a time.Duration written as a string such as "1m30s".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return &durationError{raw: data}
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return &durationError{raw: data}
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// durationError is returned for a value which is not a duration string. encoding/json does not say where the value
+// was, so it is located by its raw text.
+type durationError struct {
+	raw []byte
+}
+
+func (e *durationError) Error() string {
+	return fmt.Sprintf("expected a duration such as \"30s\", got %s", e.raw)
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Default returns the configuration used when no file is given: a single listener on an available port,
+// forwarding to an empty pool, with the limits and timeouts of the constants in this package.
+func Default() *File {
+	return &File{
+		Listeners: []Listener{{Name: "default", Address: SelectOpenPort, Network: TCPNetwork, Pool: DefaultPool, Strategy: DefaultStrategy}},
+		Pools:     []Pool{{Name: DefaultPool}},
+		Timeouts: Timeouts{
+			Host:      Duration(UpstreamHostTimeout),
+			Handshake: Duration(HandshakeTimeout),
+			Dial:      Duration(DialTimeout),
+			Shutdown:  Duration(ShutdownTimeout),
+			Drain:     Duration(DrainTimeout),
+		},
+		Retry: Retry{MaxAttempts: DialAttempts},
+		Limits: Limits{
+			MaxConnectionsPerClient: MaxConnectionsPerClient,
+			PerClientRate:           &Rate{PerSecond: ClientConnectionsPerSecond, Burst: ClientConnectionBurst},
+			GlobalRate:              &Rate{PerSecond: GlobalConnectionsPerSecond, Burst: GlobalConnectionBurst},
+			RateLimiterIdleTTL:      Duration(RateLimiterIdleTTL),
+		},
+		HealthCheck: HealthCheck{
+			Interval:           Duration(HealthCheckInterval),
+			Timeout:            Duration(HealthCheckTimeout),
+			HealthyThreshold:   HealthyThreshold,
+			UnhealthyThreshold: UnhealthyThreshold,
+			Jitter:             Duration(HealthCheckJitter),
+			Probe:              ProbeTCP,
+		},
+		Logging: Logging{
+			Level:  logging.LevelInfo.String(),
+			Format: string(logging.Text),
+		},
+	}
+}
+
+// FromFlags returns the default configuration, modified by the command line flags.
+func FromFlags(flags Flags) *File {
+	f := Default()
+	f.Listeners[0].Address = flags.Port
+	f.Listeners[0].Strategy = flags.Strategy
+	f.Listeners[0].StickyTTL = Duration(flags.StickyTTL)
+	f.PolicyFile = flags.PolicyPath
+	if flags.AdminAddress != "" {
+		f.Admin = &Admin{Address: flags.AdminAddress}
+	}
+	if flags.AccessLogPath != "" {
+		f.AccessLog = &AccessLog{Path: flags.AccessLogPath, Format: string(accesslog.JSON), MaxSizeMB: AccessLogMaxSizeMB, MaxBackups: AccessLogMaxBackups}
+	}
+	f.Logging = Logging{Level: flags.LogLevel, Format: flags.LogFormat}
+	return f
+}
+
+// Load reads, parses and validates the configuration file at path. Relative paths in the file, such as certificate
+// files, are relative to the directory of the file. Errors locate each problem by the line and column in the file.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration file: %w", err)
+	}
+
+	f, err := parse(data, filepath.Dir(path))
+	if err != nil {
+		var errs Errors
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				e.File = path
+			}
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Parse decodes and validates a JSON configuration. Unknown fields are rejected, and fields which are not set take
+// their defaults. The returned error is an Errors listing every problem found.
+func Parse(data []byte) (*File, error) {
+	return parse(data, "")
+}
+
+// parse decodes and validates a JSON configuration, resolving relative paths against dir.
+func parse(data []byte, dir string) (*File, error) {
+	positions, err := indexPositions(data)
+	if err != nil {
+		return nil, Errors{decodeError(data, positions, err)}
+	}
+
+	var f File
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&f); err != nil {
+		return nil, Errors{decodeError(data, positions, err)}
+	}
+
+	f.applyDefaults()
+	f.resolvePaths(dir)
+	if errs := f.validate(newLocator(data, positions)); len(errs) > 0 {
+		return nil, errs
+	}
+	return &f, nil
+}
+
+// resolvePaths makes the relative file paths of the configuration relative to dir.
+func (f *File) resolvePaths(dir string) {
+	resolve := func(path *string) {
+		if dir != "" && *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	for i := range f.Listeners {
+		if t := f.Listeners[i].TLS; t != nil {
+			resolve(&t.CertFile)
+			resolve(&t.KeyFile)
+			resolve(&t.ClientCAFile)
+		}
+	}
+	resolve(&f.PolicyFile)
+	if f.Admin != nil {
+		if t := f.Admin.TLS; t != nil {
+			resolve(&t.CertFile)
+			resolve(&t.KeyFile)
+			resolve(&t.ClientCAFile)
+		}
+		resolve(&f.Admin.AuditLog)
+	}
+	if f.AccessLog != nil {
+		resolve(&f.AccessLog.Path)
+	}
+}
+
+// applyDefaults sets every field which was left as zero to its default.
+func (f *File) applyDefaults() {
+	defaults := Default()
+	for i := range f.Listeners {
+		if f.Listeners[i].Network == "" {
+			f.Listeners[i].Network = TCPNetwork
+		}
+		if f.Listeners[i].Strategy == "" {
+			f.Listeners[i].Strategy = DefaultStrategy
+		}
+	}
+
+	setDuration := func(d *Duration, def Duration) {
+		if *d == 0 {
+			*d = def
+		}
+	}
+	setDuration(&f.Timeouts.Host, defaults.Timeouts.Host)
+	setDuration(&f.Timeouts.Handshake, defaults.Timeouts.Handshake)
+	setDuration(&f.Timeouts.Dial, defaults.Timeouts.Dial)
+	setDuration(&f.Timeouts.Shutdown, defaults.Timeouts.Shutdown)
+	setDuration(&f.Timeouts.Drain, defaults.Timeouts.Drain)
+	setDuration(&f.Limits.RateLimiterIdleTTL, defaults.Limits.RateLimiterIdleTTL)
+	for i := range f.Listeners {
+		if limits := f.Listeners[i].Limits; limits != nil {
+			setDuration(&limits.RateLimiterIdleTTL, defaults.Limits.RateLimiterIdleTTL)
+		}
+	}
+	setDuration(&f.HealthCheck.Interval, defaults.HealthCheck.Interval)
+	setDuration(&f.HealthCheck.Timeout, defaults.HealthCheck.Timeout)
+	setDuration(&f.HealthCheck.Jitter, defaults.HealthCheck.Jitter)
+	if f.HealthCheck.Probe == "" {
+		f.HealthCheck.Probe = defaults.HealthCheck.Probe
+	}
+
+	if f.Retry.MaxAttempts == 0 {
+		f.Retry.MaxAttempts = defaults.Retry.MaxAttempts
+	}
+	if f.HealthCheck.HealthyThreshold == 0 {
+		f.HealthCheck.HealthyThreshold = defaults.HealthCheck.HealthyThreshold
+	}
+	if f.HealthCheck.UnhealthyThreshold == 0 {
+		f.HealthCheck.UnhealthyThreshold = defaults.HealthCheck.UnhealthyThreshold
+	}
+
+	if f.Logging.Level == "" {
+		f.Logging.Level = defaults.Logging.Level
+	}
+	if f.Logging.Format == "" {
+		f.Logging.Format = defaults.Logging.Format
+	}
+
+	if a := f.AccessLog; a != nil {
+		if a.Format == "" {
+			a.Format = string(accesslog.JSON)
+		}
+		if a.MaxSizeMB == 0 {
+			a.MaxSizeMB = AccessLogMaxSizeMB
+		}
+		if a.MaxBackups == 0 {
+			a.MaxBackups = AccessLogMaxBackups
+		}
+	}
+}
+
+// Listener returns the listener with the given name.
+func (f *File) Listener(name string) (Listener, bool) {
+	for _, l := range f.Listeners {
+		if l.Name == name {
+			return l, true
+		}
+	}
+	return Listener{}, false
+}
+
+// Pool returns the pool with the given name.
+func (f *File) Pool(name string) (Pool, bool) {
+	for _, p := range f.Pools {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Pool{}, false
+}
+
+// LoadPolicy returns the authorization policy of the configuration, or nil if every client may reach every host.
+func (f *File) LoadPolicy() (*policy.Policy, error) {
+	switch {
+	case f.Policy != nil:
+		return policy.New(f.Policy.Rules)
+	case f.PolicyFile != "":
+		return policy.Load(f.PolicyFile)
+	default:
+		return nil, nil
+	}
+}
+
+// Load reads the certificate material from disk.
+func (t *TLS) Load() (tls.Certificate, *x509.CertPool, error) {
+	certificate, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("unable to load certificate and key: %w", err)
+	}
+
+	pem, err := os.ReadFile(t.ClientCAFile)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("unable to read client CA file: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return tls.Certificate{}, nil, fmt.Errorf("no PEM encoded certificates found in %s", t.ClientCAFile)
+	}
+	return certificate, clientCAs, nil
+}
@@ -0,0 +1,322 @@
+package config_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/config"
+	"tcp-load-balancer/test"
+)
+
+func TestParse_Defaults(t *testing.T) {
+	f, err := config.Parse([]byte(`{
+  "listeners": [{"name": "public", "address": ":0", "pool": "web"}],
+  "pools": [{"name": "web", "hosts": [{"address": "127.0.0.1:8080"}]}]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := f.Listeners[0]
+	if l.Network != config.TCPNetwork || l.Strategy != config.DefaultStrategy {
+		t.Errorf("listener network = %q, strategy = %q, want %q and %q", l.Network, l.Strategy, config.TCPNetwork, config.DefaultStrategy)
+	}
+	if got := time.Duration(f.Timeouts.Shutdown); got != config.ShutdownTimeout {
+		t.Errorf("shutdown timeout = %s, want %s", got, config.ShutdownTimeout)
+	}
+	if f.Retry.MaxAttempts != config.DialAttempts {
+		t.Errorf("retry attempts = %d, want %d", f.Retry.MaxAttempts, config.DialAttempts)
+	}
+	if f.Limits.PerClientRate != nil || f.Limits.MaxConnectionsPerClient != 0 {
+		t.Error("limits which are not configured should be unlimited")
+	}
+	if _, ok := f.Pool("web"); !ok {
+		t.Error("pool web was not found")
+	}
+	if got := time.Duration(f.HealthCheck.Jitter); got != config.HealthCheckJitter {
+		t.Errorf("health check jitter = %s, want %s", got, config.HealthCheckJitter)
+	}
+}
+
+func TestParse_HealthCheckJitterDisabled(t *testing.T) {
+	f, err := config.Parse([]byte(`{
+  "listeners": [{"name": "public", "address": ":0", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "healthCheck": {"jitter": "-1s"}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.HealthCheck.Jitter >= 0 {
+		t.Errorf("health check jitter = %s, want a negative jitter, which disables it", time.Duration(f.HealthCheck.Jitter))
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "empty",
+			config: " \n",
+			want:   []string{"configuration is empty"},
+		},
+		{
+			name: "syntax error",
+			config: `{
+  "listeners": [
+    {"name": "public" "address": ":0"}
+  ]
+}`,
+			want: []string{"3:23: invalid JSON"},
+		},
+		{
+			name:   "truncated",
+			config: "{\n  \"listeners\": [\n",
+			want:   []string{"3:1: unexpected end of configuration"},
+		},
+		{
+			name: "unknown field",
+			config: `{
+  "listeners": [{"name": "public", "address": ":0", "pool": "web"}],
+  "pools": [{
+    "name": "web",
+    "hots": []
+  }]
+}`,
+			want: []string{"5:5: pools[0].hots: unknown field"},
+		},
+		{
+			name: "unknown field declared elsewhere",
+			config: `{
+  "pools": [{"name": "web", "hosts": [{"address": "127.0.0.1:8080", "weight": 2}]}],
+  "listeners": [{"name": "public", "address": ":0", "pool": "web", "weight": 2}]
+}`,
+			want: []string{"3:68: listeners[0].weight: unknown field"},
+		},
+		{
+			name: "wrong type",
+			config: `{
+  "listeners": [{"name": "public", "address": ":0", "pool": "web"}],
+  "pools": [{"name": "web", "hosts": [
+    {"address": "127.0.0.1:8080"},
+    {"address": "127.0.0.1:8081", "weight": -2}
+  ]}]
+}`,
+			want: []string{"5:35: pools[0].hosts[1].weight: expected a non-negative integer, got number -2"},
+		},
+		{
+			name: "weight too large",
+			config: `{
+  "listeners": [{"name": "public", "address": ":0", "pool": "web"}],
+  "pools": [{"name": "web", "hosts": [{"address": "127.0.0.1:8080", "weight": 1000000}]}]
+}`,
+			want: []string{"3:69: pools[0].hosts[0].weight: must be at most 1000"},
+		},
+		{
+			name: "invalid duration",
+			config: `{
+  "listeners": [{"name": "public", "address": ":0", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "timeouts": {
+    "host": "2s",
+    "shutdown": "soon"
+  }
+}`,
+			want: []string{`6:5: timeouts.shutdown: expected a duration such as "30s", got "soon"`},
+		},
+		{
+			name: "every validation error is reported",
+			config: `{
+  "listeners": [
+    {
+      "name": "public",
+      "pool": "api",
+      "strategy": "random"
+    }
+  ],
+  "pools": [
+    {"name": "web", "hosts": [{"address": "localhost"}]}
+  ],
+  "limits": {"perClientRate": {"perSecond": 0, "burst": 1}},
+  "policy": {"rules": [{"name": "everyone", "effect": "permit"}]}
+}`,
+			want: []string{
+				"3:5: listeners[0].address: is required",
+				`5:7: listeners[0].pool: unknown pool "api"`,
+				`6:7: listeners[0].strategy: unknown strategy "random"`,
+				`10:32: pools[0].hosts[0].address: invalid address "localhost": missing port in address`,
+				"12:32: limits.perClientRate.perSecond: must be positive",
+				`13:24: policy.rules[0]: effect must be "allow" or "deny", got "permit"`,
+			},
+		},
+		{
+			name: "conflicting listeners",
+			config: `{
+  "listeners": [
+    {"name": "public", "address": ":5000", "pool": "web"},
+    {"name": "public", "address": ":5000", "pool": "web"},
+    {"name": "internal", "address": ":0", "pool": "web", "limits": {"globalRate": {"perSecond": 1, "burst": 0}}}
+  ],
+  "pools": [{"name": "web"}]
+}`,
+			want: []string{
+				`4:6: listeners[1].name: listener "public" is declared more than once`,
+				`4:24: listeners[1].address: another listener already listens on ":5000"`,
+				"5:100: listeners[2].limits.globalRate.burst: must be at least 1",
+			},
+		},
+		{
+			name: "admin API on a listener address",
+			config: `{
+  "listeners": [{"name": "public", "address": ":5000", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "admin": {"address": ":5000", "tls": {"certFile": "admin.pem"}}
+}`,
+			want: []string{
+				`4:13: admin.address: a listener already listens on ":5000"`,
+				"4:33: admin.tls.keyFile: is required",
+				"4:33: admin.tls.clientCAFile: is required",
+			},
+		},
+		{
+			name: "invalid access log",
+			config: `{
+  "listeners": [{"name": "public", "address": ":5000", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "accessLog": {"format": "text", "maxBackups": -1}
+}`,
+			want: []string{
+				"4:3: accessLog.path: is required",
+				`4:17: accessLog.format: unknown format "text", must be json or logfmt`,
+				"4:35: accessLog.maxBackups: must be at least 1",
+			},
+		},
+		{
+			name: "send/expect probe without an expectation",
+			config: `{
+  "listeners": [{"name": "public", "address": ":5000", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "healthCheck": {"probe": "send_expect", "send": "PING"}
+}`,
+			want: []string{"4:3: healthCheck.expect: is required by the send_expect probe"},
+		},
+		{
+			name: "admin API without TLS on every interface",
+			config: `{
+  "listeners": [{"name": "public", "address": ":5000", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "admin": {"address": ":9090"}
+}`,
+			want: []string{`4:13: admin.address: must be a loopback address such as 127.0.0.1 unless admin.tls is set, got ":9090"`},
+		},
+		{
+			name: "unknown probe",
+			config: `{
+  "listeners": [{"name": "public", "address": ":5000", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "healthCheck": {"probe": "udp"}
+}`,
+			want: []string{
+				`4:19: healthCheck.probe: unknown probe "udp", must be tcp, send_expect or http`,
+			},
+		},
+		{
+			name: "invalid logging",
+			config: `{
+  "listeners": [{"name": "public", "address": ":5000", "pool": "web"}],
+  "pools": [{"name": "web"}],
+  "logging": {"level": "verbose", "format": "logfmt"}
+}`,
+			want: []string{
+				`4:15: logging.level: unknown level "verbose", must be debug, info, warn or error`,
+				`4:35: logging.format: unknown format "logfmt", must be text or json`,
+			},
+		},
+		{
+			name: "incomplete TLS",
+			config: `{
+  "listeners": [{"name": "public", "address": ":0", "pool": "web", "tls": {
+    "certFile": "server.pem",
+    "identitySource": "serial"
+  }}],
+  "pools": [{"name": "web"}]
+}`,
+			want: []string{
+				"2:68: listeners[0].tls.keyFile: is required",
+				"2:68: listeners[0].tls.clientCAFile: is required",
+				`4:5: listeners[0].tls.identitySource: unknown identity source "serial"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.Parse([]byte(tt.config))
+			var errs config.Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Parse() error = %v, want config.Errors", err)
+			}
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Parse() returned %d error(s), want %d:\n%s", len(errs), len(tt.want), err)
+			}
+			for i, want := range tt.want {
+				if got := errs[i].Error(); !strings.HasPrefix(got, want) {
+					t.Errorf("error %d = %q, want prefix %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_Example(t *testing.T) {
+	dir := t.TempDir()
+	example, err := os.ReadFile(filepath.Join("..", "..", "config.example.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, example, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The example refers to certificates relative to its own directory.
+	pki, err := test.NewPKI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "certs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pki.WriteFiles(filepath.Join(dir, "certs")); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := f.Listeners[0].TLS.Load(); err != nil {
+		t.Errorf("unable to load the certificates of the example: %s", err)
+	}
+	if p, err := f.LoadPolicy(); err != nil || p == nil {
+		t.Errorf("LoadPolicy() = %v, %v, want the inline policy", p, err)
+	}
+	pool, _ := f.Pool(f.Listeners[0].Pool)
+	if len(pool.Hosts) != 3 || pool.Hosts[0].Weight != 2 {
+		t.Errorf("pool hosts = %+v, want 3 hosts with the first weighted 2", pool.Hosts)
+	}
+
+	// Errors name the file they were found in.
+	if err := os.RemoveAll(filepath.Join(dir, "certs")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Load(path); err == nil || !strings.HasPrefix(err.Error(), path+":9:") {
+		t.Errorf("Load() error = %v, want an error located at %s:9", err, path)
+	}
+}
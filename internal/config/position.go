@@ -0,0 +1,449 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Error is a problem with a configuration file, located by the line and column it was found at.
+type Error struct {
+	// File is the path of the configuration file, or empty if the configuration was not read from a file.
+	File string
+
+	// Path locates the offending field, e.g. "listeners[0].tls.certFile". Empty for problems with the file as a whole.
+	Path string
+
+	// Line and Column are 1-based. Zero when the problem could not be located.
+	Line   int
+	Column int
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		b.WriteString(":")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, "%d:%d:", e.Line, e.Column)
+	}
+	if b.Len() > 0 {
+		b.WriteString(" ")
+	}
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// Errors lists every problem found in a configuration, in the order they appear in the file.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// positions maps the path of each field and array element in a JSON document to where it begins.
+type positions struct {
+	// starts are the offsets of the key of each field, and of the value of each array element.
+	starts map[string]int64
+
+	// values are the offsets of the value of each field and array element.
+	values map[string]int64
+
+	// order lists the paths in the order they appear in the document.
+	order []string
+}
+
+// indexPositions walks the tokens of a JSON document, recording where each field and array element begins.
+// It returns a *json.SyntaxError if the document is not valid JSON.
+func indexPositions(data []byte) (*positions, error) {
+	w := &walker{
+		data:      data,
+		d:         json.NewDecoder(bytes.NewReader(data)),
+		positions: &positions{starts: map[string]int64{}, values: map[string]int64{}},
+	}
+	w.d.UseNumber()
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errEmpty
+	}
+	if err := w.value(""); err != nil {
+		return nil, err
+	}
+	if _, err := w.d.Token(); !errors.Is(err, io.EOF) {
+		return nil, &trailingDataError{offset: w.next()}
+	}
+	return w.positions, nil
+}
+
+// errEmpty is returned for a configuration which contains nothing but whitespace.
+var errEmpty = errors.New("configuration is empty")
+
+// trailingDataError reports data after the end of the configuration object.
+type trailingDataError struct {
+	offset int64
+}
+
+func (e *trailingDataError) Error() string {
+	return "unexpected data after the end of the configuration"
+}
+
+// walker records the positions of the values of a JSON document as it reads them.
+type walker struct {
+	data      []byte
+	d         *json.Decoder
+	positions *positions
+}
+
+// value reads the value at path, and every value nested within it.
+func (w *walker) value(path string) error {
+	w.positions.values[path] = w.next()
+	tok, err := w.token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for w.d.More() {
+			start := w.next()
+			key, err := w.token()
+			if err != nil {
+				return err
+			}
+			field := joinPath(path, key.(string))
+			w.record(field, start)
+			if err := w.value(field); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for i := 0; w.d.More(); i++ {
+			element := fmt.Sprintf("%s[%d]", path, i)
+			w.record(element, w.next())
+			if err := w.value(element); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+
+	// Read the closing delimiter.
+	_, err = w.token()
+	return err
+}
+
+// token reads the next token of a value. The document ending before the value does is reported as io.ErrUnexpectedEOF.
+func (w *walker) token() (json.Token, error) {
+	tok, err := w.d.Token()
+	if errors.Is(err, io.EOF) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return tok, err
+}
+
+func (w *walker) record(path string, start int64) {
+	if _, ok := w.positions.starts[path]; !ok {
+		w.positions.order = append(w.positions.order, path)
+	}
+	w.positions.starts[path] = start
+}
+
+// next returns the offset of the next token, skipping whitespace and the separators the decoder has not yet consumed.
+func (w *walker) next() int64 {
+	offset := w.d.InputOffset()
+	for offset < int64(len(w.data)) && strings.IndexByte(" \t\r\n,:", w.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// joinPath appends a field name to a path.
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// locator converts paths and offsets into lines and columns.
+type locator struct {
+	data      []byte
+	positions *positions
+}
+
+func newLocator(data []byte, p *positions) *locator {
+	return &locator{data: data, positions: p}
+}
+
+// at returns an error located at the path. If the path is not in the document, such as a required field which is
+// missing, the error is located at the closest parent which is.
+func (l *locator) at(path, message string) *Error {
+	e := &Error{Path: path, Message: message}
+	for p := path; ; p = parentPath(p) {
+		if offset, ok := l.positions.starts[p]; ok {
+			e.Line, e.Column = l.lineColumn(offset)
+			return e
+		}
+		if p == "" {
+			if offset, ok := l.positions.values[""]; ok {
+				e.Line, e.Column = l.lineColumn(offset)
+			}
+			return e
+		}
+	}
+}
+
+// atOffset returns an error located at the offset.
+func (l *locator) atOffset(path string, offset int64, message string) *Error {
+	e := &Error{Path: path, Message: message}
+	e.Line, e.Column = l.lineColumn(offset)
+	return e
+}
+
+// lineColumn returns the 1-based line and column of the offset.
+func (l *locator) lineColumn(offset int64) (int, int) {
+	if offset > int64(len(l.data)) {
+		offset = int64(len(l.data))
+	}
+	before := l.data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// indexPattern matches the array indexes of a path.
+var indexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// parentPath removes the last field or array index from a path.
+func parentPath(path string) string {
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// unknownFieldPattern matches the error returned by a json.Decoder which disallows unknown fields.
+var unknownFieldPattern = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+
+// decodeError converts an error returned while decoding a configuration into an Error located in the document.
+func decodeError(data []byte, p *positions, err error) *Error {
+	if p == nil {
+		p = &positions{}
+	}
+	l := newLocator(data, p)
+
+	var syntaxErr *json.SyntaxError
+	var trailingErr *trailingDataError
+	var typeErr *json.UnmarshalTypeError
+	var durationErr *durationError
+	switch {
+	case errors.Is(err, errEmpty):
+		return &Error{Message: err.Error()}
+	case errors.Is(err, io.ErrUnexpectedEOF) || (errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(len(data))):
+		return l.atOffset("", int64(len(data)), "unexpected end of configuration")
+	case errors.As(err, &syntaxErr):
+		// The offset is just past the character which could not be parsed.
+		offset := syntaxErr.Offset - 1
+		if offset < 0 {
+			offset = 0
+		}
+		return l.atOffset("", offset, "invalid JSON: "+strings.TrimPrefix(syntaxErr.Error(), "json: "))
+	case errors.As(err, &trailingErr):
+		return l.atOffset("", trailingErr.offset, trailingErr.Error())
+	case errors.As(err, &typeErr):
+		path := p.find(typeErr.Field, typeErr.Offset)
+		return l.at(path, fmt.Sprintf("expected %s, got %s", typeName(typeErr), typeErr.Value))
+	case errors.As(err, &durationErr):
+		return l.at(p.findDuration(data, durationErr.raw), durationErr.Error())
+	}
+
+	if m := unknownFieldPattern.FindStringSubmatch(err.Error()); m != nil {
+		// The error only names the field, which may be declared elsewhere too, so the field is the first path in the
+		// document which is named so and is not a field of the configuration.
+		for _, path := range p.order {
+			if (path == m[1] || strings.HasSuffix(path, "."+m[1])) && !knownPath(reflect.TypeOf(File{}), path) {
+				return l.at(path, "unknown field")
+			}
+		}
+		return l.at("", fmt.Sprintf("unknown field %q", m[1]))
+	}
+	return l.at("", err.Error())
+}
+
+// pathSegmentPattern matches the field names and array indexes of a path.
+var pathSegmentPattern = regexp.MustCompile(`[^.\[\]]+|\[\d+\]`)
+
+// knownPath reports whether every field of the path is a field of t, named as encoding/json names it. Values which
+// decode themselves, and those of maps and interfaces, are not looked into.
+func knownPath(t reflect.Type, path string) bool {
+	unmarshaler := reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	for _, segment := range pathSegmentPattern.FindAllString(path, -1) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if reflect.PtrTo(t).Implements(unmarshaler) {
+			return true
+		}
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+			if !strings.HasPrefix(segment, "[") {
+				return false
+			}
+			t = t.Elem()
+		case reflect.Struct:
+			field, ok := jsonField(t, segment)
+			if !ok {
+				return false
+			}
+			t = field.Type
+		default:
+			return true
+		}
+	}
+	return true
+}
+
+// jsonField returns the field of the struct which encoding/json decodes the key into, preferring an exact match of
+// its name to one which only differs in case, as encoding/json does.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			return f, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = &f
+		}
+	}
+	if folded != nil {
+		return *folded, true
+	}
+	return reflect.StructField{}, false
+}
+
+// find returns the path in the document of a field reported by encoding/json. Depending on the version of Go, the
+// reported field either names array elements by index, e.g. "pools.0.name", or omits array indexes altogether,
+// in which case the last matching path before the offset of the error is returned.
+func (p *positions) find(field string, offset int64) string {
+	var b strings.Builder
+	for i, segment := range strings.Split(field, ".") {
+		switch {
+		case isIndex(segment):
+			fmt.Fprintf(&b, "[%s]", segment)
+		case i > 0:
+			b.WriteString("." + segment)
+		default:
+			b.WriteString(segment)
+		}
+	}
+	if path := b.String(); p.starts[path] > 0 {
+		return path
+	}
+
+	found := ""
+	for _, path := range p.order {
+		if indexPattern.ReplaceAllString(path, "") == field && p.values[path] < offset {
+			found = path
+		}
+	}
+	if found == "" {
+		return field
+	}
+	return found
+}
+
+// findDuration returns the path of the first duration field in the document with the raw value. encoding/json decodes
+// fields in the order they appear and stops at the first error, so this is the field which failed to decode.
+func (p *positions) findDuration(data, raw []byte) string {
+	for _, path := range p.order {
+		name := path[strings.LastIndexAny(path, ".]")+1:]
+		if durationFields[name] && bytes.HasPrefix(data[p.values[path]:], raw) {
+			return path
+		}
+	}
+	return ""
+}
+
+// durationFields are the names of the fields of a File which hold a Duration.
+var durationFields = fieldsOfType(reflect.TypeOf(File{}), reflect.TypeOf(Duration(0)), map[string]bool{})
+
+// fieldsOfType adds the JSON names of the fields of t, and of the structs nested within it, which have type want.
+func fieldsOfType(t, want reflect.Type, names map[string]bool) map[string]bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map:
+		return fieldsOfType(t.Elem(), want, names)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Type == want {
+				names[strings.Split(field.Tag.Get("json"), ",")[0]] = true
+				continue
+			}
+			fieldsOfType(field.Type, want, names)
+		}
+	}
+	return names
+}
+
+// isIndex reports whether a segment of a field path is an array index.
+func isIndex(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for _, c := range segment {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// typeName describes the type a value was expected to have.
+func typeName(err *json.UnmarshalTypeError) string {
+	switch err.Type.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint64:
+		return "a non-negative integer"
+	case reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "an array"
+	case reflect.Map, reflect.Struct, reflect.Ptr:
+		return "an object"
+	default:
+		return err.Type.String()
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// Reload returns the configuration which takes effect when next replaces f on a running load balancer: the listeners,
+// pools, limits, retries, dial, shutdown and drain timeouts and the policy of next, and everything else from f,
+// including the admin API and the access log.
+// A listener which is still running keeps its address, TLS settings, strategy and sticky sessions, and whether it
+// shares the top-level limits, until it is restarted. Reload also returns the paths of the fields which differ in
+// next but only take effect after a restart.
+func (f *File) Reload(next *File) (*File, []string) {
+	merged := *next
+	var restart []string
+
+	merged.Listeners = make([]Listener, len(next.Listeners))
+	for i, l := range next.Listeners {
+		merged.Listeners[i] = l
+		running, ok := f.Listener(l.Name)
+		if !ok {
+			continue
+		}
+
+		kept := running
+		kept.Pool = l.Pool
+		if running.Limits != nil && l.Limits != nil {
+			limits := *l.Limits
+			limits.RateLimiterIdleTTL = running.Limits.RateLimiterIdleTTL
+			kept.Limits = &limits
+		}
+		if !reflect.DeepEqual(kept, l) {
+			restart = append(restart, fmt.Sprintf("listeners[%d]", i))
+		}
+		merged.Listeners[i] = kept
+	}
+
+	keep := func(path string, current, changed interface{}, restore func()) {
+		if !reflect.DeepEqual(current, changed) {
+			restart = append(restart, path)
+			restore()
+		}
+	}
+	keep("timeouts.host", f.Timeouts.Host, next.Timeouts.Host, func() { merged.Timeouts.Host = f.Timeouts.Host })
+	keep("timeouts.handshake", f.Timeouts.Handshake, next.Timeouts.Handshake, func() { merged.Timeouts.Handshake = f.Timeouts.Handshake })
+	keep("limits.rateLimiterIdleTTL", f.Limits.RateLimiterIdleTTL, next.Limits.RateLimiterIdleTTL, func() { merged.Limits.RateLimiterIdleTTL = f.Limits.RateLimiterIdleTTL })
+	keep("healthCheck", f.HealthCheck, next.HealthCheck, func() { merged.HealthCheck = f.HealthCheck })
+	keep("admin", f.Admin, next.Admin, func() { merged.Admin = f.Admin })
+	keep("accessLog", f.AccessLog, next.AccessLog, func() { merged.AccessLog = f.AccessLog })
+	keep("logging", f.Logging, next.Logging, func() { merged.Logging = f.Logging })
+
+	return &merged, restart
+}
+
+// Watch calls onChange whenever the modification time or size of the file at path changes, checking every interval
+// until the context is done. While the file cannot be read, such as when it is being replaced, it is not considered changed.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+			last = info
+			onChange()
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/config"
+)
+
+func TestFile_Reload(t *testing.T) {
+	current := mustParse(t, `{
+  "listeners": [{"name": "public", "address": ":5000", "pool": "web"}],
+  "pools": [{"name": "web", "hosts": [{"address": "127.0.0.1:8080"}]}]
+}`)
+	next := mustParse(t, `{
+  "listeners": [{"name": "public", "address": ":6000", "pool": "web"}],
+  "pools": [{"name": "web", "hosts": [{"address": "127.0.0.1:8080", "weight": 3}, {"address": "127.0.0.1:8081"}]}],
+  "limits": {"maxConnectionsPerClient": 4},
+  "healthCheck": {"interval": "1s"}
+}`)
+
+	merged, restart := current.Reload(next)
+	if want := []string{"listeners[0]", "healthCheck"}; !reflect.DeepEqual(restart, want) {
+		t.Errorf("fields which need a restart = %v, want %v", restart, want)
+	}
+	if merged.Listeners[0].Address != ":5000" || merged.HealthCheck != current.HealthCheck {
+		t.Error("fields which need a restart were taken from the new configuration")
+	}
+	if len(merged.Pools[0].Hosts) != 2 || merged.Limits.MaxConnectionsPerClient != 4 {
+		t.Error("pools and limits were not taken from the new configuration")
+	}
+}
+
+func TestFile_Reload_Listeners(t *testing.T) {
+	current := mustParse(t, `{
+  "listeners": [
+    {"name": "public", "address": ":5000", "pool": "web"},
+    {"name": "internal", "address": ":5001", "pool": "web", "limits": {"maxConnectionsPerClient": 1}}
+  ],
+  "pools": [{"name": "web"}, {"name": "api"}]
+}`)
+	next := mustParse(t, `{
+  "listeners": [
+    {"name": "public", "address": ":5000", "pool": "api"},
+    {"name": "internal", "address": ":5001", "pool": "web", "limits": {"maxConnectionsPerClient": 2, "rateLimiterIdleTTL": "1h"}},
+    {"name": "admin", "address": ":5002", "pool": "web", "strategy": "weighted_round_robin"}
+  ],
+  "pools": [{"name": "web"}, {"name": "api"}]
+}`)
+
+	merged, restart := current.Reload(next)
+	if want := []string{"listeners[1]"}; !reflect.DeepEqual(restart, want) {
+		t.Errorf("fields which need a restart = %v, want %v", restart, want)
+	}
+	if len(merged.Listeners) != 3 || !reflect.DeepEqual(merged.Listeners[2], next.Listeners[2]) {
+		t.Error("added listener was not taken from the new configuration")
+	}
+	if merged.Listeners[0].Pool != "api" {
+		t.Errorf("pool of a running listener = %q, want the pool of the new configuration", merged.Listeners[0].Pool)
+	}
+	limits := merged.Listeners[1].Limits
+	if limits.MaxConnectionsPerClient != 2 || limits.RateLimiterIdleTTL != current.Listeners[1].Limits.RateLimiterIdleTTL {
+		t.Errorf("limits of a running listener = %+v, want the new limits with the running idle TTL", limits)
+	}
+
+	// A listener which is no longer listed is not part of the merged configuration.
+	merged, _ = next.Reload(current)
+	if _, ok := merged.Listener("admin"); ok {
+		t.Error("removed listener is still part of the configuration")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 10)
+	go config.Watch(ctx, path, time.Millisecond*5, func() { changed <- struct{}{} })
+
+	select {
+	case <-changed:
+		t.Fatal("unchanged file was reported as changed")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// The modification time is set explicitly, since the file system may not record a change within the test.
+	if err := os.WriteFile(path, []byte(`{"listeners": []}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("changed file was not reported")
+	}
+
+	// While the file is missing it is not reported as changed.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("missing file was reported as changed")
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func mustParse(t *testing.T, data string) *config.File {
+	t.Helper()
+	f, err := config.Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
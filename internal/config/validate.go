@@ -0,0 +1,278 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/balancer"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/policy"
+	"tcp-load-balancer/internal/upstream"
+)
+
+// validator collects every problem with a configuration, rather than stopping at the first.
+type validator struct {
+	locate *locator
+	errs   Errors
+}
+
+// errorf records a problem with the field at path.
+func (v *validator) errorf(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, v.locate.at(path, fmt.Sprintf(format, args...)))
+}
+
+// validate returns every problem with the configuration, sorted by where they appear in the file.
+func (f *File) validate(locate *locator) Errors {
+	v := &validator{locate: locate}
+
+	pools := map[string]bool{}
+	for i, p := range f.Pools {
+		path := fmt.Sprintf("pools[%d]", i)
+		switch {
+		case p.Name == "":
+			v.errorf(path+".name", "is required")
+		case pools[p.Name]:
+			v.errorf(path+".name", "pool %q is declared more than once", p.Name)
+		}
+		pools[p.Name] = true
+		v.validateHosts(path, p.Hosts)
+	}
+
+	if len(f.Listeners) == 0 {
+		v.errorf("listeners", "at least one listener is required")
+	}
+	names := map[string]bool{}
+	addresses := map[string]bool{}
+	for i, l := range f.Listeners {
+		path := fmt.Sprintf("listeners[%d]", i)
+		v.validateListener(path, l, pools)
+		if l.Name != "" && names[l.Name] {
+			v.errorf(path+".name", "listener %q is declared more than once", l.Name)
+		}
+		names[l.Name] = true
+		if _, port, err := net.SplitHostPort(l.Address); err == nil && port != "0" {
+			if addresses[l.Address] {
+				v.errorf(path+".address", "another listener already listens on %q", l.Address)
+			}
+			addresses[l.Address] = true
+		}
+	}
+
+	v.nonNegative("timeouts.host", f.Timeouts.Host)
+	v.nonNegative("timeouts.handshake", f.Timeouts.Handshake)
+	v.nonNegative("timeouts.dial", f.Timeouts.Dial)
+	v.nonNegative("timeouts.shutdown", f.Timeouts.Shutdown)
+	v.nonNegative("timeouts.drain", f.Timeouts.Drain)
+	if f.Retry.MaxAttempts < 0 {
+		v.errorf("retry.maxAttempts", "must be at least 1")
+	}
+
+	v.validateLimits("limits", f.Limits)
+
+	v.nonNegative("healthCheck.interval", f.HealthCheck.Interval)
+	v.nonNegative("healthCheck.timeout", f.HealthCheck.Timeout)
+	if f.HealthCheck.HealthyThreshold < 0 {
+		v.errorf("healthCheck.healthyThreshold", "must be at least 1")
+	}
+	if f.HealthCheck.UnhealthyThreshold < 0 {
+		v.errorf("healthCheck.unhealthyThreshold", "must be at least 1")
+	}
+	switch f.HealthCheck.Probe {
+	case ProbeTCP, ProbeHTTP:
+	case ProbeSendExpect:
+		if f.HealthCheck.Expect == "" {
+			v.errorf("healthCheck.expect", "is required by the %s probe", ProbeSendExpect)
+		}
+	default:
+		v.errorf("healthCheck.probe", "unknown probe %q, must be %s, %s or %s", f.HealthCheck.Probe, ProbeTCP, ProbeSendExpect, ProbeHTTP)
+	}
+
+	v.validatePolicy(f)
+
+	if f.Admin != nil {
+		v.validateAddress("admin.address", f.Admin.Address)
+		if addresses[f.Admin.Address] {
+			v.errorf("admin.address", "a listener already listens on %q", f.Admin.Address)
+		}
+		if f.Admin.TLS == nil && !IsLoopback(f.Admin.Address) {
+			v.errorf("admin.address", "must be a loopback address such as 127.0.0.1 unless admin.tls is set, got %q", f.Admin.Address)
+		}
+		if f.Admin.TLS != nil {
+			v.validateTLS("admin.tls", f.Admin.TLS)
+		}
+	}
+
+	if a := f.AccessLog; a != nil {
+		if a.Path == "" {
+			v.errorf("accessLog.path", "is required")
+		}
+		if _, err := accesslog.ParseFormat(a.Format); err != nil {
+			v.errorf("accessLog.format", "unknown format %q, must be json or logfmt", a.Format)
+		}
+		if a.MaxSizeMB < 0 {
+			v.errorf("accessLog.maxSizeMB", "must be at least 1")
+		}
+		if a.MaxBackups < 0 {
+			v.errorf("accessLog.maxBackups", "must be at least 1")
+		}
+	}
+
+	if _, err := logging.ParseLevel(f.Logging.Level); err != nil {
+		v.errorf("logging.level", "unknown level %q, must be debug, info, warn or error", f.Logging.Level)
+	}
+	if _, err := logging.ParseFormat(f.Logging.Format); err != nil {
+		v.errorf("logging.format", "unknown format %q, must be text or json", f.Logging.Format)
+	}
+
+	sort.SliceStable(v.errs, func(i, j int) bool {
+		if v.errs[i].Line != v.errs[j].Line {
+			return v.errs[i].Line < v.errs[j].Line
+		}
+		return v.errs[i].Column < v.errs[j].Column
+	})
+	return v.errs
+}
+
+// validateListener checks the listener at path, whose pool must be one of pools.
+func (v *validator) validateListener(path string, l Listener, pools map[string]bool) {
+	if l.Name == "" {
+		v.errorf(path+".name", "is required")
+	}
+	v.validateAddress(path+".address", l.Address)
+	switch l.Network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		v.errorf(path+".network", "must be one of \"tcp\", \"tcp4\" or \"tcp6\", got %q", l.Network)
+	}
+
+	switch {
+	case l.Pool == "":
+		v.errorf(path+".pool", "is required")
+	case !pools[l.Pool]:
+		v.errorf(path+".pool", "unknown pool %q", l.Pool)
+	}
+	if _, err := balancer.New(l.Strategy); err != nil {
+		v.errorf(path+".strategy", "unknown strategy %q, must be one of %s", l.Strategy, strings.Join(balancer.Names(), ", "))
+	}
+	v.nonNegative(path+".stickyTTL", l.StickyTTL)
+
+	if l.TLS != nil {
+		v.validateTLS(path+".tls", l.TLS)
+	}
+	if l.Limits != nil {
+		v.validateLimits(path+".limits", *l.Limits)
+	}
+}
+
+// validateTLS checks that the TLS settings at path name every file, and that the certificates load.
+func (v *validator) validateTLS(path string, t *TLS) {
+	complete := true
+	for _, field := range []struct{ name, value string }{
+		{"certFile", t.CertFile},
+		{"keyFile", t.KeyFile},
+		{"clientCAFile", t.ClientCAFile},
+	} {
+		if field.value == "" {
+			v.errorf(path+"."+field.name, "is required")
+			complete = false
+		}
+	}
+	if t.IdentitySource != "" {
+		if _, err := identity.ParseSource(t.IdentitySource); err != nil {
+			v.errorf(path+".identitySource", "%s", err)
+		}
+	}
+	if complete {
+		if _, _, err := t.Load(); err != nil {
+			v.errorf(path, "%s", err)
+		}
+	}
+}
+
+// validateHosts checks the hosts of the pool at path, whose addresses must be distinct.
+func (v *validator) validateHosts(path string, hosts []Host) {
+	addresses := map[string]bool{}
+	for i, h := range hosts {
+		hostPath := fmt.Sprintf("%s.hosts[%d]", path, i)
+		v.validateAddress(hostPath+".address", h.Address)
+		if addresses[h.Address] {
+			v.errorf(hostPath+".address", "host %q is declared more than once in the pool", h.Address)
+		}
+		addresses[h.Address] = true
+		if h.Weight > upstream.MaxWeight {
+			v.errorf(hostPath+".weight", "must be at most %d", upstream.MaxWeight)
+		}
+		for key := range h.Labels {
+			if key == "" {
+				v.errorf(hostPath+".labels", "label names must not be empty")
+			}
+		}
+	}
+}
+
+// validateAddress checks that the address at path is set and has a host and port.
+func (v *validator) validateAddress(path, address string) {
+	if address == "" {
+		v.errorf(path, "is required")
+		return
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		v.errorf(path, "invalid address %q: %s", address, strings.TrimPrefix(err.Error(), "address "+address+": "))
+	}
+}
+
+// validateLimits checks the connection and rate limits at path.
+func (v *validator) validateLimits(path string, l Limits) {
+	for name := range l.ClientConnectionOverrides {
+		if name == "" {
+			v.errorf(path+".clientConnectionOverrides", "client names must not be empty")
+		}
+	}
+	v.validateRate(path+".perClientRate", l.PerClientRate)
+	v.validateRate(path+".globalRate", l.GlobalRate)
+	v.nonNegative(path+".rateLimiterIdleTTL", l.RateLimiterIdleTTL)
+}
+
+// validateRate checks the rate at path, if it is set.
+func (v *validator) validateRate(path string, r *Rate) {
+	if r == nil {
+		return
+	}
+	if r.PerSecond <= 0 {
+		v.errorf(path+".perSecond", "must be positive")
+	}
+	if r.Burst < 1 {
+		v.errorf(path+".burst", "must be at least 1")
+	}
+}
+
+// validatePolicy checks the inline policy or the policy file, of which at most one may be set.
+func (v *validator) validatePolicy(f *File) {
+	if f.Policy != nil && f.PolicyFile != "" {
+		v.errorf("policyFile", "policy and policyFile cannot both be set")
+		return
+	}
+	if f.Policy != nil {
+		for i, r := range f.Policy.Rules {
+			if err := r.Validate(); err != nil {
+				v.errorf(fmt.Sprintf("policy.rules[%d]", i), "%s", err)
+			}
+		}
+	}
+	if f.PolicyFile != "" {
+		if _, err := policy.Load(f.PolicyFile); err != nil {
+			v.errorf("policyFile", "%s", err)
+		}
+	}
+}
+
+// nonNegative checks that the duration at path is not negative.
+func (v *validator) nonNegative(path string, d Duration) {
+	if d < 0 {
+		v.errorf(path, "must not be negative")
+	}
+}
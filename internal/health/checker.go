@@ -0,0 +1,197 @@
+package health
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+// Config controls how often hosts are probed, and how many consecutive results change their health.
+type Config struct {
+	// Interval is the time between rounds of probes.
+	Interval time.Duration
+
+	// Timeout bounds each probe.
+	Timeout time.Duration
+
+	// HealthyThreshold is the number of consecutive successful probes after which an unhealthy host is marked healthy.
+	HealthyThreshold int
+
+	// UnhealthyThreshold is the number of consecutive failed probes after which a healthy host is marked unhealthy.
+	UnhealthyThreshold int
+
+	// Jitter is the maximum random delay added to each interval, so that many load balancers do not probe in lockstep.
+	// A negative jitter adds no delay.
+	Jitter time.Duration
+}
+
+// DefaultConfig is used for any field of Config which is left as zero.
+var DefaultConfig = Config{
+	Interval:           time.Second * 5,
+	Timeout:            time.Second * 2,
+	HealthyThreshold:   2,
+	UnhealthyThreshold: 3,
+	Jitter:             time.Millisecond * 500,
+}
+
+// streak tracks the consecutive probe results of a host.
+type streak struct {
+	successes int
+	failures  int
+}
+
+// Checker periodically probes upstream hosts on its own goroutine, and marks them healthy or unhealthy.
+type Checker struct {
+	// hosts returns the hosts to probe. It is called every round, so hosts added or removed are picked up.
+	hosts func() []*upstream.TcpHost
+
+	// probe checks each host.
+	probe Probe
+
+	// config controls the interval, timeout and thresholds of probes.
+	config Config
+
+	// streaks tracks the consecutive results of each host.
+	streaks map[*upstream.TcpHost]*streak
+
+	// mu serializes rounds of probes, and protects streaks.
+	mu sync.Mutex
+
+	// rand generates jitter. It is only used by the checker goroutine.
+	rand *rand.Rand
+
+	// stop is closed to stop the checker goroutine, which closes done when it returns.
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewChecker returns a Checker which probes the hosts returned by hosts. Zero fields of config are taken from DefaultConfig.
+func NewChecker(hosts func() []*upstream.TcpHost, probe Probe, config Config) *Checker {
+	if config.Interval <= 0 {
+		config.Interval = DefaultConfig.Interval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultConfig.Timeout
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = DefaultConfig.HealthyThreshold
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = DefaultConfig.UnhealthyThreshold
+	}
+	if config.Jitter == 0 {
+		config.Jitter = DefaultConfig.Jitter
+	}
+	if config.Jitter < 0 {
+		config.Jitter = 0
+	}
+
+	return &Checker{
+		hosts:   hosts,
+		probe:   probe,
+		config:  config,
+		streaks: make(map[*upstream.TcpHost]*streak),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start begins probing hosts on a new goroutine until Stop is called.
+func (c *Checker) Start() {
+	go c.run()
+}
+
+// Stop stops probing hosts, and waits for the current round of probes to finish.
+// It must only be called after Start.
+func (c *Checker) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+}
+
+// run probes hosts every interval until stopped.
+func (c *Checker) run() {
+	defer close(c.done)
+
+	for {
+		c.RunOnce()
+
+		wait := c.config.Interval
+		if c.config.Jitter > 0 {
+			wait += time.Duration(c.rand.Int63n(int64(c.config.Jitter)))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// RunOnce probes every host concurrently, and updates the health of hosts which crossed a threshold.
+func (c *Checker) RunOnce() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hosts := c.hosts()
+	results := make([]error, len(hosts))
+
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h *upstream.TcpHost) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+			defer cancel()
+			results[i] = c.probe.Check(ctx, h)
+		}(i, h)
+	}
+	wg.Wait()
+
+	seen := make(map[*upstream.TcpHost]bool, len(hosts))
+	for i, h := range hosts {
+		seen[h] = true
+		c.record(h, results[i])
+	}
+
+	// Forget hosts which are no longer load balanced.
+	for h := range c.streaks {
+		if !seen[h] {
+			delete(c.streaks, h)
+		}
+	}
+}
+
+// record updates the streak of the host with a probe result, and changes its health once a threshold is reached.
+func (c *Checker) record(h *upstream.TcpHost, err error) {
+	s := c.streaks[h]
+	if s == nil {
+		s = &streak{}
+		c.streaks[h] = s
+	}
+
+	if err == nil {
+		s.failures = 0
+		s.successes++
+		if !h.Healthy() && s.successes >= c.config.HealthyThreshold {
+			h.SetHealthy(true)
+		}
+		return
+	}
+
+	s.successes = 0
+	s.failures++
+	if h.Healthy() && s.failures >= c.config.UnhealthyThreshold {
+		h.Logger().Warn("Health check failed", "consecutive_failures", s.failures, "error", err)
+		h.SetHealthy(false)
+	}
+}
@@ -0,0 +1,204 @@
+package health_test
+
+// Using separate _test package to avoid circular dependency with import of "tcp-load-balancer/test" package.
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/health"
+	"tcp-load-balancer/internal/upstream"
+	"tcp-load-balancer/test"
+)
+
+func TestProbes(t *testing.T) {
+	live, err := test.InitializeHost("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	refusing, err := test.InitializeHost("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = refusing.RefuseConnections(true); err != nil {
+		t.Fatal(err)
+	}
+
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ok.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	tests := []struct {
+		name    string
+		probe   health.Probe
+		address string
+		wantErr bool
+	}{
+		{
+			name:    "tcp probe succeeds when the host accepts connections",
+			probe:   health.TCPProbe{},
+			address: live.Addr().String(),
+			wantErr: false,
+		},
+		{
+			name:    "tcp probe fails when the host refuses connections",
+			probe:   health.TCPProbe{},
+			address: refusing.Addr().String(),
+			wantErr: true,
+		},
+		{
+			name:    "send/expect probe succeeds when the response contains the expected bytes",
+			probe:   health.SendExpectProbe{Send: []byte("ping"), Expect: []byte("'ping' was received")},
+			address: live.Addr().String(),
+			wantErr: false,
+		},
+		{
+			name:    "send/expect probe fails when the response does not contain the expected bytes",
+			probe:   health.SendExpectProbe{Send: []byte("ping"), Expect: []byte("pong")},
+			address: live.Addr().String(),
+			wantErr: true,
+		},
+		{
+			name:    "send/expect probe fails when nothing is expected",
+			probe:   health.SendExpectProbe{Send: []byte("ping")},
+			address: live.Addr().String(),
+			wantErr: true,
+		},
+		{
+			name:    "http probe succeeds on a 2xx status",
+			probe:   health.HTTPProbe{Path: "/healthz"},
+			address: ok.Listener.Addr().String(),
+			wantErr: false,
+		},
+		{
+			name:    "http probe fails on an unexpected status",
+			probe:   health.HTTPProbe{Path: "/healthz"},
+			address: unavailable.Listener.Addr().String(),
+			wantErr: true,
+		},
+		{
+			name:    "http probe succeeds when the status matches the expected status",
+			probe:   health.HTTPProbe{Path: "/missing", ExpectedStatus: http.StatusNotFound},
+			address: ok.Listener.Addr().String(),
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := upstream.New(tt.address, "tcp")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			if err := tt.probe.Check(ctx, host); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChecker(t *testing.T) {
+	h, err := test.InitializeHost("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	host, err := upstream.New(h.Addr().String(), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := health.NewChecker(func() []*upstream.TcpHost { return []*upstream.TcpHost{host} }, health.TCPProbe{}, health.Config{
+		Interval:           time.Millisecond * 10,
+		Timeout:            time.Millisecond * 500,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+		Jitter:             time.Millisecond * 5,
+	})
+	checker.Start()
+	defer checker.Stop()
+
+	if err = h.RefuseConnections(true); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(time.Second*5, func() bool { return !host.Healthy() }) {
+		t.Fatal("host was not marked unhealthy while refusing connections")
+	}
+
+	if err = h.RefuseConnections(false); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(time.Second*5, host.Healthy) {
+		t.Fatal("host did not return to health once it accepted connections again")
+	}
+}
+
+func TestChecker_Thresholds(t *testing.T) {
+	// A listener which is never accepted from still completes TCP handshakes, so the probe succeeds.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+
+	host, err := upstream.New(address, "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checker := health.NewChecker(func() []*upstream.TcpHost { return []*upstream.TcpHost{host} }, health.TCPProbe{}, health.Config{
+		Timeout:            time.Millisecond * 500,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+	})
+
+	ln.Close()
+	for i := 1; i <= 3; i++ {
+		checker.RunOnce()
+		if wantHealthy := i < 3; host.Healthy() != wantHealthy {
+			t.Fatalf("after %d failed probes Healthy() = %v, want %v", i, host.Healthy(), wantHealthy)
+		}
+	}
+
+	ln, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	for i := 1; i <= 2; i++ {
+		checker.RunOnce()
+		if wantHealthy := i >= 2; host.Healthy() != wantHealthy {
+			t.Fatalf("after %d successful probes Healthy() = %v, want %v", i, host.Healthy(), wantHealthy)
+		}
+	}
+}
+
+// eventually polls the condition until it returns true or the timeout elapses.
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return condition()
+}
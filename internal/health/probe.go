@@ -0,0 +1,148 @@
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+var (
+	ErrUnexpectedResponse = errors.New("unexpected probe response")
+	ErrNoExpectation      = errors.New("send/expect probe has nothing to expect")
+)
+
+// maxExpectBytes bounds how much of a response is read while waiting for an expected pattern.
+const maxExpectBytes = 64 * 1024
+
+// Probe checks whether an upstream host is able to serve connections.
+type Probe interface {
+	// Check returns an error if the host is unhealthy. It must give up when the context is done.
+	Check(ctx context.Context, host *upstream.TcpHost) error
+}
+
+// TCPProbe considers a host healthy if it accepts a TCP connection.
+type TCPProbe struct{}
+
+// Check connects to the host and immediately closes the connection.
+func (TCPProbe) Check(ctx context.Context, host *upstream.TcpHost) error {
+	conn, err := dial(ctx, host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// SendExpectProbe considers a host healthy if, after Send is written, the response contains Expect.
+type SendExpectProbe struct {
+	// Send is written to the host once connected. It may be empty for protocols where the host speaks first.
+	Send []byte
+
+	// Expect must appear in the response from the host. It must not be empty, since every response contains it.
+	Expect []byte
+}
+
+// Check connects to the host, writes Send, and reads until Expect is found or the context is done.
+func (p SendExpectProbe) Check(ctx context.Context, host *upstream.TcpHost) error {
+	if len(p.Expect) == 0 {
+		return ErrNoExpectation
+	}
+
+	conn, err := dial(ctx, host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Send) > 0 {
+		if _, err = conn.Write(p.Send); err != nil {
+			return fmt.Errorf("unable to write probe: %w", err)
+		}
+	}
+
+	var response []byte
+	buf := make([]byte, 2048)
+	for len(response) < maxExpectBytes {
+		n, err := conn.Read(buf)
+		response = append(response, buf[:n]...)
+		if bytes.Contains(response, p.Expect) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %q does not contain %q: %s", ErrUnexpectedResponse, response, p.Expect, err)
+		}
+	}
+
+	return fmt.Errorf("%w: no %q in the first %d bytes", ErrUnexpectedResponse, p.Expect, maxExpectBytes)
+}
+
+// HTTPProbe considers a host healthy if an HTTP GET request returns the expected status.
+type HTTPProbe struct {
+	// Path is the request path, e.g. "/healthz". Defaults to "/".
+	Path string
+
+	// ExpectedStatus is the required response status. When zero, any 2xx status is accepted.
+	ExpectedStatus int
+}
+
+// Check sends an HTTP GET request to the host and checks the response status.
+func (p HTTPProbe) Check(ctx context.Context, host *upstream.TcpHost) error {
+	path := p.Path
+	if path == "" {
+		path = "/"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host.Address().String()+path, nil)
+	if err != nil {
+		return err
+	}
+
+	// A dedicated transport dials through the host, and does not keep idle connections open between probes.
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx, host)
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxExpectBytes))
+
+	if p.ExpectedStatus == 0 && resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if resp.StatusCode == p.ExpectedStatus {
+		return nil
+	}
+	return fmt.Errorf("%w: status %d", ErrUnexpectedResponse, resp.StatusCode)
+}
+
+// dial connects to the host without recording the outcome as a passive failure of the host,
+// since the checker applies its own thresholds to probe results.
+func dial(ctx context.Context, host *upstream.TcpHost) (net.Conn, error) {
+	if host.Address() == nil {
+		return nil, upstream.ErrNoAddress
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, host.Network(), host.Address().String())
+}
@@ -0,0 +1,187 @@
+package identity
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoVerifiedCertificate = errors.New("no verified client certificate presented")
+	ErrFieldNotPresent       = errors.New("client certificate does not contain the authoritative identity field")
+)
+
+// spiffeScheme is the URI scheme of SPIFFE IDs, e.g. spiffe://example.org/workload.
+const spiffeScheme = "spiffe"
+
+// Source selects which certificate field is authoritative for the name of a client.
+type Source int
+
+const (
+	// SourceCommonName uses the subject common name of the certificate.
+	SourceCommonName Source = iota
+	// SourceDNSName uses the first DNS subject alternative name of the certificate.
+	SourceDNSName
+	// SourceURI uses the first URI subject alternative name of the certificate.
+	SourceURI
+	// SourceSPIFFE uses the first URI subject alternative name with the spiffe scheme.
+	SourceSPIFFE
+	// SourceAddress uses the IP address of the client, and is used when connections are accepted without TLS.
+	SourceAddress
+)
+
+// sourceNames maps each Source to the name used in configuration.
+var sourceNames = map[Source]string{
+	SourceCommonName: "cn",
+	SourceDNSName:    "dns",
+	SourceURI:        "uri",
+	SourceSPIFFE:     "spiffe",
+	SourceAddress:    "address",
+}
+
+// String returns the configuration name of the source.
+func (s Source) String() string {
+	if name, ok := sourceNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Source(%d)", int(s))
+}
+
+// ParseSource returns the Source with the given configuration name, e.g. "cn" or "spiffe".
+func ParseSource(name string) (Source, error) {
+	for s, n := range sourceNames {
+		if strings.EqualFold(n, name) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown identity source %q", name)
+}
+
+// ClientIdentity describes the client on the other end of a connection.
+type ClientIdentity struct {
+	// ID is a V5 UUID derived from Name, so a client keeps the same ID across connections.
+	ID uuid.UUID
+
+	// Name is the value of the authoritative field selected by Source.
+	Name string
+
+	// Source is the field that Name was taken from.
+	Source Source
+
+	// CommonName is the subject common name of the client certificate.
+	CommonName string
+
+	// DNSNames are the DNS subject alternative names of the client certificate.
+	DNSNames []string
+
+	// URIs are the URI subject alternative names of the client certificate.
+	URIs []string
+
+	// SPIFFEID is the first URI subject alternative name with the spiffe scheme, if any.
+	SPIFFEID string
+
+	// Organizations are the subject organizations of the client certificate.
+	Organizations []string
+
+	// OrganizationalUnits are the subject organizational units of the client certificate.
+	OrganizationalUnits []string
+
+	// Addr is the remote address of the client.
+	Addr net.Addr
+}
+
+// FromConnectionState builds the identity of a client from the verified peer certificate of a completed TLS handshake.
+// The field selected by source is used as the name of the client, and an error is returned if it is not present.
+func FromConnectionState(state tls.ConnectionState, source Source, addr net.Addr) (ClientIdentity, error) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ClientIdentity{}, ErrNoVerifiedCertificate
+	}
+
+	// The first certificate of a verified chain is the leaf certificate presented by the client.
+	leaf := state.VerifiedChains[0][0]
+
+	c := ClientIdentity{
+		Source:              source,
+		CommonName:          leaf.Subject.CommonName,
+		DNSNames:            leaf.DNSNames,
+		Organizations:       leaf.Subject.Organization,
+		OrganizationalUnits: leaf.Subject.OrganizationalUnit,
+		Addr:                addr,
+	}
+	for _, u := range leaf.URIs {
+		c.URIs = append(c.URIs, u.String())
+		if c.SPIFFEID == "" && u.Scheme == spiffeScheme {
+			c.SPIFFEID = u.String()
+		}
+	}
+
+	switch source {
+	case SourceCommonName:
+		c.Name = c.CommonName
+	case SourceDNSName:
+		if len(c.DNSNames) > 0 {
+			c.Name = c.DNSNames[0]
+		}
+	case SourceURI:
+		if len(c.URIs) > 0 {
+			c.Name = c.URIs[0]
+		}
+	case SourceSPIFFE:
+		c.Name = c.SPIFFEID
+	case SourceAddress:
+		c.Name = hostFromAddr(addr)
+	default:
+		return ClientIdentity{}, fmt.Errorf("unknown identity source %s", source)
+	}
+
+	if c.Name == "" {
+		return ClientIdentity{}, fmt.Errorf("%w: %s", ErrFieldNotPresent, source)
+	}
+	c.ID = newID(source, c.Name)
+
+	return c, nil
+}
+
+// FromAddr builds the identity of a client from its IP address, for connections accepted without TLS.
+func FromAddr(addr net.Addr) ClientIdentity {
+	name := hostFromAddr(addr)
+	return ClientIdentity{
+		ID:     newID(SourceAddress, name),
+		Name:   name,
+		Source: SourceAddress,
+		Addr:   addr,
+	}
+}
+
+// String returns a short description of the client for logging.
+func (c ClientIdentity) String() string {
+	if c.Name == "" {
+		return "unknown client"
+	}
+	return fmt.Sprintf("%s=%s", c.Source, c.Name)
+}
+
+// newID derives a stable V5 UUID from the source and name of a client.
+// The source is included so that, for example, a common name cannot collide with an IP address.
+func newID(source Source, name string) uuid.UUID {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(source.String()+":"+name))
+}
+
+// hostFromAddr returns the IP address of addr without its port.
+func hostFromAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,138 @@
+package identity_test
+
+// Using separate _test package to avoid circular dependency with import of "tcp-load-balancer/test" package.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/test"
+)
+
+func TestFromConnectionState(t *testing.T) {
+	ca, err := test.NewCertificateAuthority("identity test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spiffeID, _ := url.Parse("spiffe://example.org/billing/api")
+	uri, _ := url.Parse("https://clients.example.org/billing")
+	certificate, err := ca.Issue(&x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "billing-client",
+			Organization:       []string{"example"},
+			OrganizationalUnit: []string{"billing"},
+		},
+		DNSNames:    []string{"billing.example.org"},
+		URIs:        []*url.URL{uri, spiffeID},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{certificate.Leaf}}}
+
+	commonNameOnly, err := ca.IssueClient("cn-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}
+
+	tests := []struct {
+		name     string
+		state    tls.ConnectionState
+		source   identity.Source
+		wantName string
+		wantErr  error
+	}{
+		{
+			name:     "common name is used as the name",
+			state:    state,
+			source:   identity.SourceCommonName,
+			wantName: "billing-client",
+		},
+		{
+			name:     "first DNS SAN is used as the name",
+			state:    state,
+			source:   identity.SourceDNSName,
+			wantName: "billing.example.org",
+		},
+		{
+			name:     "first URI SAN is used as the name",
+			state:    state,
+			source:   identity.SourceURI,
+			wantName: "https://clients.example.org/billing",
+		},
+		{
+			name:     "SPIFFE ID is used as the name even when it is not the first URI SAN",
+			state:    state,
+			source:   identity.SourceSPIFFE,
+			wantName: "spiffe://example.org/billing/api",
+		},
+		{
+			name:    "missing authoritative field results in error",
+			state:   tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{commonNameOnly.Leaf}}},
+			source:  identity.SourceSPIFFE,
+			wantErr: identity.ErrFieldNotPresent,
+		},
+		{
+			name:    "unverified connection results in error",
+			state:   tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate.Leaf}},
+			source:  identity.SourceCommonName,
+			wantErr: identity.ErrNoVerifiedCertificate,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := identity.FromConnectionState(tt.state, tt.source, addr)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FromConnectionState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.Name != tt.wantName {
+				t.Errorf("FromConnectionState().Name = %q, want %q", got.Name, tt.wantName)
+			}
+			if got.Addr != addr {
+				t.Errorf("FromConnectionState().Addr = %v, want %v", got.Addr, addr)
+			}
+			if got.SPIFFEID != "spiffe://example.org/billing/api" {
+				t.Errorf("FromConnectionState().SPIFFEID = %q, want spiffe://example.org/billing/api", got.SPIFFEID)
+			}
+			if len(got.OrganizationalUnits) != 1 || got.OrganizationalUnits[0] != "billing" {
+				t.Errorf("FromConnectionState().OrganizationalUnits = %v, want [billing]", got.OrganizationalUnits)
+			}
+
+			// The ID must be stable across connections from the same client.
+			again, _ := identity.FromConnectionState(tt.state, tt.source, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 6000})
+			if got.ID != again.ID {
+				t.Errorf("FromConnectionState().ID changed between connections: %s != %s", got.ID, again.ID)
+			}
+		})
+	}
+}
+
+func TestFromAddr(t *testing.T) {
+	a := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+	b := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6000})
+	c := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5000})
+
+	if a.Name != "10.0.0.1" {
+		t.Errorf("FromAddr().Name = %q, want 10.0.0.1", a.Name)
+	}
+	if a.ID != b.ID {
+		t.Error("FromAddr() returned different IDs for the same IP address")
+	}
+	if a.ID == c.ID {
+		t.Error("FromAddr() returned the same ID for different IP addresses")
+	}
+}
@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// textTimeFormat is the time format of the Text format, which matches the standard log package.
+const textTimeFormat = "2006/01/02 15:04:05"
+
+// message is a message being encoded.
+type message struct {
+	time   time.Time
+	level  Level
+	msg    string
+	fields []interface{}
+}
+
+// encodeText writes the message as its time, level and message followed by key=value fields, on one line.
+func (m message) encodeText(buf *bytes.Buffer) {
+	buf.WriteString(m.time.Format(textTimeFormat))
+	buf.WriteByte(' ')
+	buf.WriteString(strings.ToUpper(m.level.String()))
+	buf.WriteByte(' ')
+	buf.WriteString(m.msg)
+	m.eachField(func(key string, value interface{}) {
+		buf.WriteByte(' ')
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(textValue(value))
+	})
+	buf.WriteByte('\n')
+}
+
+// encodeJSON writes the message as a JSON object with time, level and msg keys along with the fields, on one line.
+func (m message) encodeJSON(buf *bytes.Buffer) {
+	buf.WriteString(`{"time":`)
+	writeJSON(buf, m.time.Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(buf, m.level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(buf, m.msg)
+	m.eachField(func(key string, value interface{}) {
+		buf.WriteByte(',')
+		writeJSON(buf, key)
+		buf.WriteByte(':')
+		writeJSON(buf, jsonValue(value))
+	})
+	buf.WriteString("}\n")
+}
+
+// eachField calls f with each key and its value. A key without a value has a nil value.
+func (m message) eachField(f func(key string, value interface{})) {
+	for i := 0; i < len(m.fields); i += 2 {
+		key := fmt.Sprint(m.fields[i])
+		var value interface{}
+		if i+1 < len(m.fields) {
+			value = m.fields[i+1]
+		}
+		f(key, value)
+	}
+}
+
+// textValue formats the value of a field in the Text format, quoting it if it is empty, or contains spaces, quotes,
+// equals signs or unprintable characters.
+func textValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		s = "<nil>"
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" {
+		return `""`
+	}
+	for _, r := range s {
+		if r == ' ' || r == '"' || r == '=' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+// jsonValue returns the value of a field as it is encoded in the JSON format. Errors and values which are not
+// encoded by encoding/json, but which describe themselves with a String method, are written as strings.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case json.Marshaler:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// writeJSON writes the value as JSON, or as a JSON string of its default format if it cannot be encoded.
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(data)
+}
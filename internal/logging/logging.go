@@ -0,0 +1,227 @@
+// Package logging writes leveled, structured logs. Each message has a level and key-value fields, and is encoded as
+// text or as a JSON object, one per line.
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownLevel  = errors.New("unknown log level")
+	ErrUnknownFormat = errors.New("unknown log format")
+)
+
+// Level is the severity of a message. Messages below the level of a logger are discarded.
+type Level int
+
+const (
+	// LevelDebug is detail which is only useful when diagnosing a problem, such as the data of every connection.
+	LevelDebug Level = iota
+
+	// LevelInfo is a change in the state of the load balancer, such as a host being added.
+	LevelInfo
+
+	// LevelWarn is a problem which the load balancer recovered from, such as a rejected connection.
+	LevelWarn
+
+	// LevelError is a problem which needs attention, such as a host which cannot be dialed.
+	LevelError
+)
+
+// String returns the name of the level, such as "info".
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+}
+
+// ParseLevel returns the level with the given name: "debug", "info", "warn" or "error".
+func ParseLevel(name string) (Level, error) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		if l.String() == name {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q, must be debug, info, warn or error", ErrUnknownLevel, name)
+}
+
+// Format is the encoding of logged messages.
+type Format string
+
+const (
+	// Text writes each message as its time, level and message followed by key=value fields.
+	Text Format = "text"
+
+	// JSON writes each message as a JSON object with time, level and msg keys along with the fields.
+	JSON Format = "json"
+)
+
+// ParseFormat returns the format with the given name, "text" or "json".
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case Text, JSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w %q, must be text or json", ErrUnknownFormat, name)
+	}
+}
+
+// output is where a logger and every logger derived from it with With write.
+type output struct {
+	w      io.Writer
+	level  Level
+	format Format
+
+	// now tells the time of messages.
+	now func() time.Time
+
+	// mu serializes writes to w, so that messages are never interleaved.
+	mu sync.Mutex
+}
+
+// Logger writes leveled messages with key-value fields. It is safe for concurrent use.
+// A nil *Logger writes to the default logger, which can be replaced with SetDefault.
+type Logger struct {
+	// out is where messages are written. When nil, they are written to the default logger.
+	out *output
+
+	// fields are the key-value pairs added to every message, as alternating keys and values.
+	fields []interface{}
+}
+
+// Option configures optional behavior of a Logger during New.
+type Option func(*output)
+
+// WithLevel discards messages below the level. The default level is LevelInfo.
+func WithLevel(level Level) Option {
+	return func(o *output) {
+		o.level = level
+	}
+}
+
+// WithFormat encodes messages in the format. The default format is Text.
+func WithFormat(format Format) Option {
+	return func(o *output) {
+		o.format = format
+	}
+}
+
+// New returns a logger which writes to w.
+func New(w io.Writer, opts ...Option) *Logger {
+	o := &output{w: w, level: LevelInfo, format: Text, now: time.Now}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Logger{out: o}
+}
+
+var (
+	// defaultLogger is used by nil loggers.
+	defaultLogger = New(os.Stderr)
+
+	// defaultMu protects defaultLogger from concurrent access.
+	defaultMu sync.RWMutex
+)
+
+// Default returns the default logger, which writes text to stderr unless replaced with SetDefault.
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault replaces the default logger, which is used by nil loggers and by loggers derived from them with With,
+// including those derived before it was replaced.
+func SetDefault(l *Logger) {
+	if l == nil || l.out == nil {
+		return
+	}
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = l
+}
+
+// With returns a logger which adds the key-value pairs to every message, after the fields of l.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	derived := &Logger{}
+	if l != nil {
+		derived.out = l.out
+		derived.fields = append(derived.fields, l.fields...)
+	}
+	derived.fields = append(derived.fields, keyvals...)
+	return derived
+}
+
+// Enabled reports whether messages at the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	out, _ := l.resolve()
+	return level >= out.level
+}
+
+// Debug writes a debug message with the key-value pairs, which alternate between keys and values.
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info writes an info message with the key-value pairs, which alternate between keys and values.
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn writes a warning with the key-value pairs, which alternate between keys and values.
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error writes an error message with the key-value pairs, which alternate between keys and values.
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+// resolve returns the output of the logger and its fields, which include those of the default logger when l does
+// not have an output of its own.
+func (l *Logger) resolve() (*output, []interface{}) {
+	if l != nil && l.out != nil {
+		return l.out, l.fields
+	}
+	d := Default()
+	if l == nil {
+		return d.out, d.fields
+	}
+	return d.out, append(append([]interface{}{}, d.fields...), l.fields...)
+}
+
+// log encodes the message and writes it with a single Write.
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	out, fields := l.resolve()
+	if level < out.level {
+		return
+	}
+
+	var buf bytes.Buffer
+	m := message{time: out.now(), level: level, msg: msg, fields: append(append([]interface{}{}, fields...), keyvals...)}
+	if out.format == JSON {
+		m.encodeJSON(&buf)
+	} else {
+		m.encodeText(&buf)
+	}
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	out.w.Write(buf.Bytes())
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// fixedTime is the time of every message in the tests.
+var fixedTime = time.Date(2024, 3, 1, 12, 0, 0, 500000000, time.UTC)
+
+func newTestLogger(buf *bytes.Buffer, opts ...Option) *Logger {
+	l := New(buf, opts...)
+	l.out.now = func() time.Time { return fixedTime }
+	return l
+}
+
+func TestLogger(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 8080}
+
+	tests := []struct {
+		name string
+		opts []Option
+		log  func(l *Logger)
+		want string
+	}{
+		{
+			name: "text",
+			log: func(l *Logger) {
+				l.With("connection_id", 7, "client", "cn=billing").Info("Forwarding connection", "host", addr)
+			},
+			want: `2024/03/01 12:00:00 INFO Forwarding connection connection_id=7 client="cn=billing" host=10.0.0.2:8080` + "\n",
+		},
+		{
+			name: "text quotes errors and empty values",
+			log: func(l *Logger) {
+				l.Error("Unable to dial", "error", errors.New("connection refused"), "host_id", "")
+			},
+			want: `2024/03/01 12:00:00 ERROR Unable to dial error="connection refused" host_id=""` + "\n",
+		},
+		{
+			name: "json",
+			opts: []Option{WithFormat(JSON)},
+			log: func(l *Logger) {
+				l.With("connection_id", 7).Warn("Error forwarding data", "host", addr, "error", errors.New("reset"), "bytes", 12)
+			},
+			want: `{"time":"2024-03-01T12:00:00.5Z","level":"warn","msg":"Error forwarding data","connection_id":7,` +
+				`"host":"10.0.0.2:8080","error":"reset","bytes":12}` + "\n",
+		},
+		{
+			name: "key without a value",
+			opts: []Option{WithFormat(JSON)},
+			log: func(l *Logger) {
+				l.Info("Shut down", "forced")
+			},
+			want: `{"time":"2024-03-01T12:00:00.5Z","level":"info","msg":"Shut down","forced":null}` + "\n",
+		},
+		{
+			name: "below the level",
+			log: func(l *Logger) {
+				l.Debug("Client received response")
+			},
+			want: "",
+		},
+		{
+			name: "at the level",
+			opts: []Option{WithLevel(LevelDebug)},
+			log: func(l *Logger) {
+				l.Debug("Client received response")
+			},
+			want: "2024/03/01 12:00:00 DEBUG Client received response\n",
+		},
+		{
+			name: "above the level",
+			opts: []Option{WithLevel(LevelWarn)},
+			log: func(l *Logger) {
+				l.Info("Frontend listening")
+				l.Error("Frontend stopped")
+			},
+			want: "2024/03/01 12:00:00 ERROR Frontend stopped\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(newTestLogger(&buf, tt.opts...))
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogger_nil(t *testing.T) {
+	var buf bytes.Buffer
+	previous := Default()
+	SetDefault(newTestLogger(&buf, WithLevel(LevelDebug)))
+	defer SetDefault(previous)
+
+	var l *Logger
+	l.With("host_id", "a").Debug("Dial failed")
+	if want := "2024/03/01 12:00:00 DEBUG Dial failed host_id=a\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Level
+		wantErr error
+	}{
+		{name: "debug", want: LevelDebug},
+		{name: "info", want: LevelInfo},
+		{name: "warn", want: LevelWarn},
+		{name: "error", want: LevelError},
+		{name: "verbose", wantErr: ErrUnknownLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLevel(tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets of a latency histogram, from 1ms to 10s.
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observed durations in buckets, as a Prometheus histogram. It is safe for concurrent use, and the
+// zero value uses DefaultLatencyBuckets.
+type Histogram struct {
+	// bounds are the upper bounds of the buckets in seconds, in increasing order. Nil means DefaultLatencyBuckets.
+	bounds []float64
+
+	// counts holds the number of observations in each bucket, followed by those above every bound.
+	// It is allocated on the first observation.
+	counts []uint64
+
+	// sum is the total of every observation, and count is the number of observations.
+	sum   time.Duration
+	count uint64
+
+	// mu protects the counts, sum and count from concurrent access.
+	mu sync.Mutex
+}
+
+// NewHistogram returns a histogram with buckets of the given upper bounds in seconds, which must be increasing.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds}
+}
+
+// HistogramSnapshot is the state of a Histogram at one moment.
+type HistogramSnapshot struct {
+	// Bounds are the upper bounds of the buckets in seconds.
+	Bounds []float64
+
+	// Counts are the cumulative number of observations at or below each bound.
+	Counts []uint64
+
+	// Sum is the total of every observation in seconds, and Count is the number of observations.
+	Sum   float64
+	Count uint64
+}
+
+// Observe adds an observation.
+func (h *Histogram) Observe(d time.Duration) {
+	bounds := h.bucketBounds()
+	seconds := d.Seconds()
+	i := 0
+	for i < len(bounds) && seconds > bounds[i] {
+		i++
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(bounds)+1)
+	}
+	h.counts[i]++
+	h.sum += d
+	h.count++
+}
+
+// Snapshot returns the cumulative counts of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	bounds := h.bucketBounds()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := HistogramSnapshot{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)),
+		Sum:    h.sum.Seconds(),
+		Count:  h.count,
+	}
+	var total uint64
+	for i := range bounds {
+		if h.counts != nil {
+			total += h.counts[i]
+		}
+		s.Counts[i] = total
+	}
+	return s
+}
+
+// bucketBounds returns the upper bounds of the buckets.
+func (h *Histogram) bucketBounds() []float64 {
+	if h.bounds == nil {
+		return DefaultLatencyBuckets
+	}
+	return h.bounds
+}
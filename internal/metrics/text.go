@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric types of the Prometheus text format.
+const (
+	Counter = "counter"
+	Gauge   = "gauge"
+)
+
+// ContentType is the content type of the Prometheus text format written by TextWriter.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Labels name the series of a metric.
+type Labels map[string]string
+
+// TextWriter writes metrics in the Prometheus text exposition format. Every sample of a metric must be written before
+// the next metric is declared. The first write error is kept, and returned by Flush.
+type TextWriter struct {
+	w *bufio.Writer
+
+	// err is the first error returned by w.
+	err error
+}
+
+// NewTextWriter returns a writer of metrics to w.
+func NewTextWriter(w io.Writer) *TextWriter {
+	return &TextWriter{w: bufio.NewWriter(w)}
+}
+
+// Declare writes the help text and type of the metric, which is Counter, Gauge or histogram.
+func (t *TextWriter) Declare(name, kind, help string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	t.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Sample writes a sample of the metric with the given labels.
+func (t *TextWriter) Sample(name string, labels Labels, value float64) {
+	t.printf("%s%s %s\n", name, formatLabels(labels, "", ""), formatFloat(value))
+}
+
+// Histogram declares the histogram and writes the snapshot of each series of it, given by its labels.
+func (t *TextWriter) Histogram(name, help string, series []Labels, snapshots []HistogramSnapshot) {
+	t.printf("# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, s := range snapshots {
+		for j, bound := range s.Bounds {
+			t.printf("%s_bucket%s %d\n", name, formatLabels(series[i], "le", formatFloat(bound)), s.Counts[j])
+		}
+		t.printf("%s_bucket%s %d\n", name, formatLabels(series[i], "le", "+Inf"), s.Count)
+		t.printf("%s_sum%s %s\n", name, formatLabels(series[i], "", ""), formatFloat(s.Sum))
+		t.printf("%s_count%s %d\n", name, formatLabels(series[i], "", ""), s.Count)
+	}
+}
+
+// Flush writes any buffered metrics, and returns the first error met.
+func (t *TextWriter) Flush() error {
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
+
+func (t *TextWriter) printf(format string, args ...interface{}) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = fmt.Fprintf(t.w, format, args...)
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels returns the labels sorted by name, and the extra label if it is named, as {name="value",...}.
+func formatLabels(labels Labels, extraName, extraValue string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(labels)+1)
+	for _, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(labels[name])+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+labelEscaper.Replace(extraValue)+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat formats a sample value as the text format requires.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,71 @@
+package metrics_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/metrics"
+)
+
+func TestTextWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*metrics.TextWriter)
+		want  string
+	}{
+		{
+			name: "counter",
+			write: func(w *metrics.TextWriter) {
+				w.Declare("requests_total", metrics.Counter, "Requests served.")
+				w.Sample("requests_total", metrics.Labels{"path": "/", "method": "GET"}, 3)
+			},
+			want: "# HELP requests_total Requests served.\n# TYPE requests_total counter\nrequests_total{method=\"GET\",path=\"/\"} 3\n",
+		},
+		{
+			name: "escaped label values",
+			write: func(w *metrics.TextWriter) {
+				w.Sample("up", metrics.Labels{"name": "a\"b\\c\nd"}, 1)
+			},
+			want: "up{name=\"a\\\"b\\\\c\\nd\"} 1\n",
+		},
+		{
+			name: "special values",
+			write: func(w *metrics.TextWriter) {
+				w.Sample("up", nil, math.Inf(1))
+				w.Sample("up", nil, 0.25)
+			},
+			want: "up +Inf\nup 0.25\n",
+		},
+		{
+			name: "histogram",
+			write: func(w *metrics.TextWriter) {
+				h := metrics.NewHistogram([]float64{0.1, 1})
+				h.Observe(time.Millisecond * 50)
+				h.Observe(time.Millisecond * 500)
+				h.Observe(time.Second * 2)
+				w.Histogram("dial_seconds", "Dials.", []metrics.Labels{{"host": "a"}}, []metrics.HistogramSnapshot{h.Snapshot()})
+			},
+			want: "# HELP dial_seconds Dials.\n# TYPE dial_seconds histogram\n" +
+				"dial_seconds_bucket{host=\"a\",le=\"0.1\"} 1\n" +
+				"dial_seconds_bucket{host=\"a\",le=\"1\"} 2\n" +
+				"dial_seconds_bucket{host=\"a\",le=\"+Inf\"} 3\n" +
+				"dial_seconds_sum{host=\"a\"} 2.55\n" +
+				"dial_seconds_count{host=\"a\"} 3\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := metrics.NewTextWriter(&buf)
+			tt.write(w)
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("wrote\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+// Effect is the outcome of a rule which matches a client and upstream host.
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Client attribute names which may be used in ClientSelector.Attributes.
+const (
+	AttributeName               = "name"
+	AttributeCommonName         = "cn"
+	AttributeDNSName            = "dns"
+	AttributeURI                = "uri"
+	AttributeSPIFFEID           = "spiffe"
+	AttributeOrganization       = "o"
+	AttributeOrganizationalUnit = "ou"
+	AttributeAddress            = "address"
+)
+
+// Rule allows or denies a set of clients access to a set of upstream hosts.
+type Rule struct {
+	// Name identifies the rule in logs and errors.
+	Name string `json:"name"`
+
+	// Effect is either "allow" or "deny".
+	Effect Effect `json:"effect"`
+
+	// Priority orders rules; the matching rule with the highest priority decides. At equal priority, deny wins over allow.
+	Priority int `json:"priority"`
+
+	// Clients selects the clients the rule applies to.
+	Clients ClientSelector `json:"clients"`
+
+	// Upstreams selects the upstream hosts the rule applies to.
+	Upstreams UpstreamSelector `json:"upstreams"`
+}
+
+// ClientSelector matches clients. Every non-empty field must match, and a field matches if any of its values match.
+// An empty selector matches every client.
+type ClientSelector struct {
+	// Names match the authoritative name of the client identity.
+	Names []string `json:"names,omitempty"`
+
+	// IDs match the V5 UUID of the client identity.
+	IDs []string `json:"ids,omitempty"`
+
+	// Groups match any organization or organizational unit of the client certificate.
+	Groups []string `json:"groups,omitempty"`
+
+	// Attributes match certificate attributes, keyed by one of the Attribute constants. Every attribute must match.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// UpstreamSelector matches upstream hosts. Every non-empty field must match, and a field matches if any of its values match.
+// An empty selector matches every host.
+type UpstreamSelector struct {
+	// HostIDs match the ID of the host.
+	HostIDs []string `json:"hostIds,omitempty"`
+
+	// Pools match the pool name of the host.
+	Pools []string `json:"pools,omitempty"`
+
+	// Labels match the labels of the host. Every label must match.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Decision is the result of evaluating a policy for a client and upstream host.
+type Decision struct {
+	// Allowed reports whether the client may connect to the host.
+	Allowed bool
+
+	// Rule is the name of the rule which made the decision, or empty when no rule matched and access was denied by default.
+	Rule string
+}
+
+// Policy is an ordered set of rules which decides which clients may reach which upstream hosts.
+// Access is denied unless a rule allows it. A Policy is immutable and safe for concurrent use.
+type Policy struct {
+	// rules are sorted so that the first matching rule decides.
+	rules []Rule
+}
+
+// file is the on-disk format of a policy.
+type file struct {
+	Rules []Rule `json:"rules"`
+}
+
+// New validates the rules and returns a Policy which evaluates them.
+func New(rules []Rule) (*Policy, error) {
+	sorted := make([]Rule, len(rules))
+	copy(sorted, rules)
+
+	for i, r := range sorted {
+		if err := r.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d (%q): %w", i, r.Name, err)
+		}
+	}
+
+	// Higher priorities are evaluated first, and deny rules are evaluated before allow rules of the same priority.
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		return sorted[i].Effect == Deny && sorted[j].Effect != Deny
+	})
+
+	return &Policy{rules: sorted}, nil
+}
+
+// Parse decodes a JSON policy of the form {"rules": [...]}. Unknown fields are rejected.
+func Parse(data []byte) (*Policy, error) {
+	var f file
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&f); err != nil {
+		return nil, fmt.Errorf("unable to decode policy: %w", err)
+	}
+	return New(f.Rules)
+}
+
+// Load reads and parses the JSON policy file at path.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policy file: %w", err)
+	}
+
+	p, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Rules returns a copy of the rules in evaluation order.
+func (p *Policy) Rules() []Rule {
+	rules := make([]Rule, len(p.rules))
+	copy(rules, p.rules)
+	return rules
+}
+
+// Authorize decides whether the client may connect to the host.
+func (p *Policy) Authorize(client identity.ClientIdentity, host *upstream.TcpHost) Decision {
+	for _, r := range p.rules {
+		if r.Clients.matches(client) && r.Upstreams.matches(host) {
+			return Decision{Allowed: r.Effect == Allow, Rule: r.Name}
+		}
+	}
+	return Decision{Allowed: false}
+}
+
+// Validate returns an error if the rule cannot be evaluated.
+func (r Rule) Validate() error {
+	if r.Effect != Allow && r.Effect != Deny {
+		return fmt.Errorf("effect must be %q or %q, got %q", Allow, Deny, r.Effect)
+	}
+	for key := range r.Clients.Attributes {
+		if _, ok := attributeValues(identity.ClientIdentity{}, key); !ok {
+			return fmt.Errorf("unknown client attribute %q", key)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the selector matches the client.
+func (s ClientSelector) matches(client identity.ClientIdentity) bool {
+	if len(s.Names) > 0 && !containsAny(s.Names, client.Name) {
+		return false
+	}
+	if len(s.IDs) > 0 && !containsAny(s.IDs, client.ID.String()) {
+		return false
+	}
+	if len(s.Groups) > 0 && !containsAny(s.Groups, client.Organizations...) && !containsAny(s.Groups, client.OrganizationalUnits...) {
+		return false
+	}
+	for key, want := range s.Attributes {
+		values, _ := attributeValues(client, key)
+		if !containsAny([]string{want}, values...) {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether the selector matches the host.
+func (s UpstreamSelector) matches(host *upstream.TcpHost) bool {
+	if len(s.HostIDs) > 0 && !containsAny(s.HostIDs, host.ID().String()) {
+		return false
+	}
+	if len(s.Pools) > 0 && !containsAny(s.Pools, host.Pool()) {
+		return false
+	}
+	labels := host.Labels()
+	for key, want := range s.Labels {
+		if got, ok := labels[key]; !ok || got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// attributeValues returns the values of the named certificate attribute of the client, and false if the attribute is unknown.
+func attributeValues(client identity.ClientIdentity, key string) ([]string, bool) {
+	switch strings.ToLower(key) {
+	case AttributeName:
+		return []string{client.Name}, true
+	case AttributeCommonName:
+		return []string{client.CommonName}, true
+	case AttributeDNSName:
+		return client.DNSNames, true
+	case AttributeURI:
+		return client.URIs, true
+	case AttributeSPIFFEID:
+		return []string{client.SPIFFEID}, true
+	case AttributeOrganization:
+		return client.Organizations, true
+	case AttributeOrganizationalUnit:
+		return client.OrganizationalUnits, true
+	case AttributeAddress:
+		if client.Addr == nil {
+			return nil, true
+		}
+		return []string{identity.FromAddr(client.Addr).Name}, true
+	default:
+		return nil, false
+	}
+}
+
+// containsAny reports whether any of the values is in the list.
+func containsAny(list []string, values ...string) bool {
+	for _, v := range values {
+		for _, l := range list {
+			if l == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	billing := identity.ClientIdentity{Name: "billing-client", CommonName: "billing-client", OrganizationalUnits: []string{"billing"}}
+	reporting := identity.ClientIdentity{Name: "reporting-client", CommonName: "reporting-client", Organizations: []string{"analytics"}}
+
+	payments := newHost(t, "127.0.0.1:9000", upstream.WithPool("payments"), upstream.WithLabels(map[string]string{"env": "prod"}))
+	paymentsStaging := newHost(t, "127.0.0.1:9001", upstream.WithPool("payments"), upstream.WithLabels(map[string]string{"env": "staging"}))
+	warehouse := newHost(t, "127.0.0.1:9002", upstream.WithPool("warehouse"))
+
+	rules := []Rule{
+		{
+			Name:      "billing reaches payments",
+			Effect:    Allow,
+			Clients:   ClientSelector{Groups: []string{"billing"}},
+			Upstreams: UpstreamSelector{Pools: []string{"payments"}},
+		},
+		{
+			Name:      "nobody reaches staging",
+			Effect:    Deny,
+			Upstreams: UpstreamSelector{Labels: map[string]string{"env": "staging"}},
+		},
+		{
+			Name:      "analytics reaches everything",
+			Effect:    Allow,
+			Clients:   ClientSelector{Attributes: map[string]string{AttributeOrganization: "analytics"}},
+			Priority:  -1,
+			Upstreams: UpstreamSelector{},
+		},
+		{
+			Name:      "reporting never reaches the warehouse host",
+			Effect:    Deny,
+			Clients:   ClientSelector{Names: []string{"reporting-client"}},
+			Upstreams: UpstreamSelector{HostIDs: []string{warehouse.ID().String()}},
+			Priority:  -1,
+		},
+	}
+
+	p, err := New(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		client      identity.ClientIdentity
+		host        *upstream.TcpHost
+		wantAllowed bool
+		wantRule    string
+	}{
+		{
+			name:        "allow rule matching group and pool allows access",
+			client:      billing,
+			host:        payments,
+			wantAllowed: true,
+			wantRule:    "billing reaches payments",
+		},
+		{
+			name:        "deny wins over allow at equal priority",
+			client:      billing,
+			host:        paymentsStaging,
+			wantAllowed: false,
+			wantRule:    "nobody reaches staging",
+		},
+		{
+			name:        "higher priority deny wins over lower priority allow",
+			client:      reporting,
+			host:        paymentsStaging,
+			wantAllowed: false,
+			wantRule:    "nobody reaches staging",
+		},
+		{
+			name:        "deny wins over allow at equal lower priority",
+			client:      reporting,
+			host:        warehouse,
+			wantAllowed: false,
+			wantRule:    "reporting never reaches the warehouse host",
+		},
+		{
+			name:        "lower priority allow applies when no higher rule matches",
+			client:      reporting,
+			host:        payments,
+			wantAllowed: true,
+			wantRule:    "analytics reaches everything",
+		},
+		{
+			name:        "access is denied by default",
+			client:      billing,
+			host:        warehouse,
+			wantAllowed: false,
+			wantRule:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.Authorize(tt.client, tt.host)
+			if got.Allowed != tt.wantAllowed || got.Rule != tt.wantRule {
+				t.Errorf("Policy.Authorize() = %+v, want {Allowed:%v Rule:%s}", got, tt.wantAllowed, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "valid policy file is loaded",
+			content: `{
+				"rules": [
+					{"name": "billing", "effect": "allow", "clients": {"groups": ["billing"]}, "upstreams": {"pools": ["payments"]}},
+					{"name": "staging", "effect": "deny", "priority": 10, "upstreams": {"labels": {"env": "staging"}}}
+				]
+			}`,
+			wantErr: false,
+		},
+		{
+			name:    "unknown effect is rejected",
+			content: `{"rules": [{"name": "typo", "effect": "permit"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown client attribute is rejected",
+			content: `{"rules": [{"name": "typo", "effect": "allow", "clients": {"attributes": {"email": "a@example.org"}}}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field is rejected",
+			content: `{"rules": [{"name": "typo", "effect": "allow", "client": {}}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Load(path); (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// newHost is a helper to create an upstream host with the given options.
+func newHost(t *testing.T, address string, opts ...upstream.Option) *upstream.TcpHost {
+	h, err := upstream.New(address, "tcp", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// AcceptPolicy controls how Run recovers when accepting a connection fails.
+type AcceptPolicy struct {
+	// InitialBackoff is the delay before retrying after the first failure. The delay doubles after each
+	// consecutive failure, up to MaxBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration
+
+	// RelistenAttempts is the number of times Run tries to listen on its address again after the listener fails,
+	// before giving up and returning the error.
+	RelistenAttempts int
+}
+
+// DefaultAcceptPolicy is used unless overridden with WithAcceptPolicy.
+var DefaultAcceptPolicy = AcceptPolicy{
+	InitialBackoff:   time.Millisecond * 5,
+	MaxBackoff:       time.Second,
+	RelistenAttempts: 5,
+}
+
+// WithAcceptPolicy overrides the default recovery from failures to accept connections.
+func WithAcceptPolicy(policy AcceptPolicy) Option {
+	return func(l *LoadBalancer) {
+		if policy.InitialBackoff <= 0 {
+			policy.InitialBackoff = DefaultAcceptPolicy.InitialBackoff
+		}
+		if policy.MaxBackoff < policy.InitialBackoff {
+			policy.MaxBackoff = policy.InitialBackoff
+		}
+		l.acceptPolicy = policy
+	}
+}
+
+// AcceptRetries returns the number of temporary errors Run recovered from by retrying Accept.
+func (l *LoadBalancer) AcceptRetries() uint64 {
+	return atomic.LoadUint64(&l.acceptRetries)
+}
+
+// Relistens returns the number of times Run recovered from a failed listener by listening again.
+func (l *LoadBalancer) Relistens() uint64 {
+	return atomic.LoadUint64(&l.relistens)
+}
+
+// isTemporaryAcceptError reports whether an error returned by Accept is expected to clear up on its own, such as
+// running out of file descriptors, or a client aborting its connection before it was accepted.
+func isTemporaryAcceptError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ECONNABORTED, syscall.ENOBUFS, syscall.ENOMEM} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// nextBackoff doubles the previous backoff within the bounds of the policy.
+func nextBackoff(previous time.Duration, policy AcceptPolicy) time.Duration {
+	if previous <= 0 {
+		return policy.InitialBackoff
+	}
+	if next := previous * 2; next < policy.MaxBackoff {
+		return next
+	}
+	return policy.MaxBackoff
+}
+
+// sleep waits for the duration, returning false if the context is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// relisten replaces a failed listener with a new listener on the same address, trying up to the number of times
+// allowed by the accept policy. The cause is the error the listener failed with, which is returned if no attempts are allowed.
+func (l *LoadBalancer) relisten(ctx context.Context, cause error) error {
+	l.listenerMu.Lock()
+	failed := l.listener
+	l.listenerMu.Unlock()
+
+	address := failed.Addr().String()
+	failed.Close()
+
+	var backoff time.Duration
+	err := cause
+	for attempt := 1; attempt <= l.acceptPolicy.RelistenAttempts; attempt++ {
+		backoff = nextBackoff(backoff, l.acceptPolicy)
+		if !sleep(ctx, backoff) {
+			return ctx.Err()
+		}
+
+		var ln net.Listener
+		ln, err = l.listen(l.network, address)
+		if err != nil {
+			l.log.Warn("Unable to listen again", "address", address, "attempt", attempt, "error", err)
+			continue
+		}
+
+		l.listenerMu.Lock()
+		if l.listenerClosed {
+			// The load balancer was shut down while listening again.
+			l.listenerMu.Unlock()
+			ln.Close()
+			return ErrServerClosed
+		}
+		l.listener = ln
+		l.listenerMu.Unlock()
+
+		atomic.AddUint64(&l.relistens, 1)
+		l.log.Info("Listening again", "address", address, "attempts", attempt)
+		return nil
+	}
+	return fmt.Errorf("unable to listen on %s again after %d attempt(s): %w", address, l.acceptPolicy.RelistenAttempts, err)
+}
+
+// listen opens a listener, using the listen function set for testing if there is one.
+func (l *LoadBalancer) listen(network, address string) (net.Listener, error) {
+	if l.listenFunc != nil {
+		return l.listenFunc(network, address)
+	}
+	return net.Listen(network, address)
+}
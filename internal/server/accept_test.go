@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// scriptedListener is a listener which returns scripted errors from Accept, and then blocks until it is closed.
+type scriptedListener struct {
+	errs   chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newScriptedListener(errs ...error) *scriptedListener {
+	l := &scriptedListener{errs: make(chan error, len(errs)), closed: make(chan struct{})}
+	for _, err := range errs {
+		l.errs <- err
+	}
+	return l
+}
+
+func (l *scriptedListener) Accept() (net.Conn, error) {
+	select {
+	case err := <-l.errs:
+		return nil, err
+	default:
+	}
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *scriptedListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *scriptedListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4000}
+}
+
+func TestLoadBalancer_Run_AcceptRecovery(t *testing.T) {
+	policy := AcceptPolicy{InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond * 4, RelistenAttempts: 3}
+	temporary := &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept4", syscall.EMFILE)}
+	permanent := errors.New("listener failed")
+
+	tests := []struct {
+		name          string
+		errs          []error
+		listenErrs    int
+		wantRetries   uint64
+		wantRelistens uint64
+		wantRunErr    bool
+	}{
+		{
+			name:        "temporary errors are retried",
+			errs:        []error{temporary, temporary, &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.ECONNABORTED)}},
+			wantRetries: 3,
+		},
+		{
+			name:          "permanent error is recovered by listening again",
+			errs:          []error{permanent},
+			listenErrs:    2,
+			wantRelistens: 1,
+		},
+		{
+			name:       "listening again gives up after the allowed attempts",
+			errs:       []error{permanent},
+			listenErrs: 3,
+			wantRunErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replacement := newScriptedListener()
+			var listenAddresses []string
+			listenErrs := tt.listenErrs
+
+			l := &LoadBalancer{
+				listener:     newScriptedListener(tt.errs...),
+				network:      "tcp",
+				acceptPolicy: policy,
+				listenFunc: func(network, address string) (net.Listener, error) {
+					listenAddresses = append(listenAddresses, address)
+					if listenErrs > 0 {
+						listenErrs--
+						return nil, fmt.Errorf("address in use")
+					}
+					return replacement, nil
+				},
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ran := make(chan error, 1)
+			go func() {
+				ran <- l.Run(ctx)
+			}()
+
+			if tt.wantRunErr {
+				select {
+				case err := <-ran:
+					if err == nil || errors.Is(err, context.Canceled) {
+						t.Errorf("Run() error = %v, want the listen error", err)
+					}
+				case <-time.After(time.Second * 5):
+					t.Fatal("Run() did not give up listening again")
+				}
+				if len(listenAddresses) != policy.RelistenAttempts {
+					t.Errorf("listened %d times, want %d", len(listenAddresses), policy.RelistenAttempts)
+				}
+				return
+			}
+
+			done := func() bool { return l.AcceptRetries() == tt.wantRetries && l.Relistens() == tt.wantRelistens }
+			deadline := time.Now().Add(time.Second * 5)
+			for !done() && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond * 5)
+			}
+			if !done() {
+				t.Fatalf("AcceptRetries() = %d, Relistens() = %d, want %d and %d", l.AcceptRetries(), l.Relistens(), tt.wantRetries, tt.wantRelistens)
+			}
+
+			for _, address := range listenAddresses {
+				if address != "127.0.0.1:4000" {
+					t.Errorf("listened again on %s, want the original address 127.0.0.1:4000", address)
+				}
+			}
+
+			// Run keeps running until its context is done, and then closes the current listener.
+			cancel()
+			select {
+			case err := <-ran:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("Run() did not return after its context was done")
+			}
+			if tt.wantRelistens > 0 {
+				select {
+				case <-replacement.closed:
+				default:
+					t.Error("replacement listener was not closed")
+				}
+			}
+		})
+	}
+}
+
+func Test_nextBackoff(t *testing.T) {
+	policy := AcceptPolicy{InitialBackoff: time.Millisecond * 5, MaxBackoff: time.Millisecond * 30}
+	want := []time.Duration{5, 10, 20, 30, 30}
+
+	var backoff time.Duration
+	for i, w := range want {
+		backoff = nextBackoff(backoff, policy)
+		if backoff != w*time.Millisecond {
+			t.Errorf("backoff %d = %v, want %v", i, backoff, w*time.Millisecond)
+		}
+	}
+}
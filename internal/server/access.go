@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net"
+	"time"
+
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/identity"
+)
+
+// newAccessRecord starts the access log record of a connection from the client, assigning the connection its ID.
+func (l *LoadBalancer) newAccessRecord(client identity.ClientIdentity, clientConn net.Conn) accesslog.Record {
+	return accesslog.Record{
+		Start:         time.Now(),
+		Frontend:      l.name,
+		ConnectionID:  l.sessions.newID(),
+		ClientAddress: clientConn.RemoteAddr().String(),
+		Client:        client.String(),
+	}
+}
+
+// logAccess completes the record of a connection which ended with the termination and error, and writes it to the
+// access log, if there is one.
+func (l *LoadBalancer) logAccess(record accesslog.Record, termination accesslog.Termination, err error) {
+	if l.accessLog == nil {
+		return
+	}
+
+	record.Duration = time.Since(record.Start)
+	record.Termination = termination
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if err := l.accessLog.Log(record); err != nil {
+		l.log.Error("Unable to write access log", "error", err)
+	}
+}
+
+// termination returns why a connection ended, given the error returned by ForwardData.
+func termination(err error) accesslog.Termination {
+	if err == nil {
+		return accesslog.ClientClosed
+	}
+	switch ForwardErrorCauseOf(err) {
+	case CauseHostClosed:
+		return accesslog.HostClosed
+	case CauseTimeout:
+		return accesslog.TimedOut
+	default:
+		return accesslog.Failed
+	}
+}
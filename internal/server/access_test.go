@@ -0,0 +1,154 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestLoadBalancer_AccessLog(t *testing.T) {
+	tests := []struct {
+		name string
+		// connect hands a connection to the load balancer and ends it.
+		connect         func(t *testing.T, l *server.LoadBalancer, hosts []*upstream.TcpHost)
+		hosts           int
+		deadHost        bool
+		wantTermination accesslog.Termination
+		wantUpstream    bool
+		wantBytes       bool
+		wantRetries     int
+	}{
+		{
+			name:  "client closes the connection",
+			hosts: 1,
+			connect: func(t *testing.T, l *server.LoadBalancer, hosts []*upstream.TcpHost) {
+				conn := openSession(t, l, 1)
+				writeAndReadResponse(t, conn, "hello")
+				conn.Close()
+			},
+			wantTermination: accesslog.ClientClosed,
+			wantUpstream:    true,
+			wantBytes:       true,
+		},
+		{
+			name:  "host is removed",
+			hosts: 1,
+			connect: func(t *testing.T, l *server.LoadBalancer, hosts []*upstream.TcpHost) {
+				conn := openSession(t, l, 1)
+				defer conn.Close()
+				if err := l.RemoveUpstream(hosts[0].ID()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantTermination: accesslog.Closed,
+			wantUpstream:    true,
+		},
+		{
+			name:  "no host is available",
+			hosts: 0,
+			connect: func(t *testing.T, l *server.LoadBalancer, hosts []*upstream.TcpHost) {
+				clientConn, serverConn := net.Pipe()
+				defer clientConn.Close()
+				if err := l.HandleConnection(serverConn, identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})); err == nil {
+					t.Fatal("HandleConnection() succeeded without hosts")
+				}
+			},
+			wantTermination: accesslog.Failed,
+		},
+		{
+			name:     "host refuses the connection",
+			hosts:    0,
+			deadHost: true,
+			connect: func(t *testing.T, l *server.LoadBalancer, hosts []*upstream.TcpHost) {
+				clientConn, serverConn := net.Pipe()
+				defer clientConn.Close()
+				if err := l.HandleConnection(serverConn, identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantTermination: accesslog.Failed,
+			wantRetries:     1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf lockedBuffer
+			l, hosts := newLoadBalancerWithHosts(t, tt.hosts, server.WithName("api"), server.WithAccessLog(accesslog.New(&buf, accesslog.JSON)))
+			if tt.deadHost {
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				ln.Close()
+				host, err := upstream.New(ln.Addr().String(), "tcp")
+				if err != nil {
+					t.Fatal(err)
+				}
+				l.AddUpstream(host)
+			}
+
+			tt.connect(t, l, hosts)
+			if !eventually(time.Second*5, func() bool { return strings.Count(buf.String(), "\n") == 1 }) {
+				t.Fatalf("access log = %q, want one record", buf.String())
+			}
+
+			var record struct {
+				Frontend      string                `json:"frontend"`
+				ConnectionID  uint64                `json:"connection_id"`
+				ClientAddress string                `json:"client_address"`
+				Client        string                `json:"client"`
+				Upstream      string                `json:"upstream"`
+				BytesIn       uint64                `json:"bytes_in"`
+				BytesOut      uint64                `json:"bytes_out"`
+				Termination   accesslog.Termination `json:"termination"`
+				Retries       int                   `json:"retries"`
+				Error         string                `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(buf.String()), &record); err != nil {
+				t.Fatal(err)
+			}
+			if record.Frontend != "api" || record.ConnectionID == 0 || record.ClientAddress == "" || record.Client != "address=10.0.0.1" {
+				t.Errorf("record = %+v, want the frontend, connection ID and client", record)
+			}
+			if record.Termination != tt.wantTermination || record.Retries != tt.wantRetries {
+				t.Errorf("record ended with %q after %d retries, want %q after %d", record.Termination, record.Retries, tt.wantTermination, tt.wantRetries)
+			}
+			if (record.Upstream != "") != tt.wantUpstream {
+				t.Errorf("record upstream = %q, want one: %t", record.Upstream, tt.wantUpstream)
+			}
+			if (record.BytesIn == 5 && record.BytesOut > 0) != tt.wantBytes {
+				t.Errorf("record has %d bytes in and %d out, want the bytes forwarded: %t", record.BytesIn, record.BytesOut, tt.wantBytes)
+			}
+			if (record.Error != "") != (tt.wantTermination == accesslog.Failed) {
+				t.Errorf("record error = %q", record.Error)
+			}
+		})
+	}
+}
+
+// lockedBuffer is a bytes.Buffer which is safe for concurrent use.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,173 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+
+	"github.com/google/uuid"
+)
+
+func TestLoadBalancer_DrainUpstream(t *testing.T) {
+	t.Run("existing connections finish while new connections go to other hosts", func(t *testing.T) {
+		l, hosts := newLoadBalancerWithHosts(t, 2)
+
+		clientConn := openSession(t, l, 1)
+		draining := sessionHost(t, l)
+
+		drained := make(chan error, 1)
+		go func() {
+			drained <- l.DrainUpstream(context.Background(), draining.ID())
+		}()
+		if !eventually(time.Second*5, func() bool { return l.Draining(draining) }) {
+			t.Fatal("host was not marked as draining")
+		}
+
+		// New connections are sent to the other host, even though it now has more connections.
+		other := hosts[0]
+		if other == draining {
+			other = hosts[1]
+		}
+		secondClientConn := openSession(t, l, 2)
+		if response := writeAndReadResponse(t, secondClientConn, "new"); !strings.Contains(response, other.Address().String()) {
+			t.Errorf("new connection was answered by %q, want host %s", response, other.Address())
+		}
+
+		// The existing connection is still forwarded to the draining host.
+		if _, err := clientConn.Write([]byte("existing")); err != nil {
+			t.Fatal(err)
+		}
+		response := make([]byte, 1024)
+		n, err := clientConn.Read(response)
+		if err != nil {
+			t.Fatalf("existing connection was closed while draining: %s", err)
+		}
+		if !strings.Contains(string(response[:n]), draining.Address().String()) {
+			t.Errorf("existing connection was answered by %q, want host %s", response[:n], draining.Address())
+		}
+
+		select {
+		case <-drained:
+			t.Fatal("DrainUpstream() returned before the existing connection ended")
+		case <-time.After(time.Millisecond * 50):
+		}
+
+		clientConn.Close()
+		select {
+		case err := <-drained:
+			if err != nil {
+				t.Fatalf("DrainUpstream() error = %v", err)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("DrainUpstream() did not return after the existing connection ended")
+		}
+		if _, ok := l.Host(draining.ID()); ok || len(l.Hosts()) != 1 {
+			t.Error("drained host is still load balanced")
+		}
+	})
+
+	t.Run("connections are closed once the deadline passes", func(t *testing.T) {
+		l, _ := newLoadBalancerWithHosts(t, 1)
+
+		clientConn := openSession(t, l, 1)
+		host := sessionHost(t, l)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		if err := l.DrainUpstream(ctx, host.ID()); err != nil {
+			t.Fatalf("DrainUpstream() error = %v", err)
+		}
+
+		if !connectionIsClosed(clientConn) {
+			t.Error("connection which outlived the deadline was not closed")
+		}
+		if len(l.Sessions()) != 0 || len(l.Hosts()) != 0 {
+			t.Errorf("after draining, %d sessions and %d hosts remain, want none", len(l.Sessions()), len(l.Hosts()))
+		}
+	})
+
+	t.Run("unknown host returns an error", func(t *testing.T) {
+		l, _ := newLoadBalancerWithHosts(t, 1)
+		if err := l.DrainUpstream(context.Background(), uuid.New()); !errors.Is(err, server.ErrUnknownUpstream) {
+			t.Errorf("DrainUpstream() error = %v, want %v", err, server.ErrUnknownUpstream)
+		}
+	})
+}
+
+func TestLoadBalancer_RemoveUpstream(t *testing.T) {
+	l, _ := newLoadBalancerWithHosts(t, 1)
+
+	clientConn := openSession(t, l, 1)
+	host := sessionHost(t, l)
+
+	if err := l.RemoveUpstream(host.ID()); err != nil {
+		t.Fatalf("RemoveUpstream() error = %v", err)
+	}
+	if !connectionIsClosed(clientConn) {
+		t.Error("connection to the removed host was not closed")
+	}
+	if len(l.Hosts()) != 0 {
+		t.Errorf("Hosts() returned %d hosts after the only host was removed, want 0", len(l.Hosts()))
+	}
+	if !eventually(time.Second*5, func() bool { return host.ConnectionCount() == 0 }) {
+		t.Errorf("ConnectionCount() of the removed host = %d, want 0", host.ConnectionCount())
+	}
+
+	if err := l.RemoveUpstream(host.ID()); !errors.Is(err, server.ErrUnknownUpstream) {
+		t.Errorf("RemoveUpstream() of a removed host error = %v, want %v", err, server.ErrUnknownUpstream)
+	}
+}
+
+func TestLoadBalancer_Hosts_ReturnsCopy(t *testing.T) {
+	l, hosts := newLoadBalancerWithHosts(t, 2)
+
+	got := l.Hosts()
+	got[0] = nil
+	if l.Hosts()[0] != hosts[0] {
+		t.Error("modifying the slice returned by Hosts() changed the hosts of the load balancer")
+	}
+}
+
+// newLoadBalancerWithHosts returns a load balancer which forwards to n test hosts.
+func newLoadBalancerWithHosts(t *testing.T, n int, opts ...server.Option) (*server.LoadBalancer, []*upstream.TcpHost) {
+	l, err := server.New("tcp", ":0", time.Second*1, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := make([]*upstream.TcpHost, n)
+	for i := range hosts {
+		hosts[i] = newTestHost(t)
+		l.AddUpstream(hosts[i])
+	}
+	return l, hosts
+}
+
+// openSession hands a new client connection to the load balancer, and waits until it is forwarded to a host.
+func openSession(t *testing.T, l *server.LoadBalancer, client byte) net.Conn {
+	before := len(l.Sessions())
+	clientConn, serverConn := net.Pipe()
+	if err := l.HandleConnection(serverConn, identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, client)})); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(time.Second*5, func() bool { return len(l.Sessions()) > before }) {
+		t.Fatal("connection was not forwarded to a host")
+	}
+	return clientConn
+}
+
+// sessionHost returns the host of the most recent session.
+func sessionHost(t *testing.T, l *server.LoadBalancer) *upstream.TcpHost {
+	sessions := l.Sessions()
+	if len(sessions) == 0 {
+		t.Fatal("no sessions are being forwarded")
+	}
+	return sessions[len(sessions)-1].Host
+}
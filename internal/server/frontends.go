@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+var (
+	ErrDuplicateFrontend = errors.New("frontend is already running")
+	ErrUnknownFrontend   = errors.New("frontend is not running")
+)
+
+// Frontends runs several load balancers in one process. Each frontend is a LoadBalancer with its own listener,
+// TLS settings, balancing strategy and upstream hosts, identified by its name. Frontends are started and stopped
+// independently; limits are shared between frontends by passing them the same ConnectionLimiter and RateLimiter.
+// The zero value is ready to use.
+type Frontends struct {
+	// running maps the name of each running frontend to it.
+	running map[string]*frontend
+
+	// mu protects running from concurrent access.
+	mu sync.Mutex
+}
+
+// frontend is a load balancer which is running.
+type frontend struct {
+	lb *LoadBalancer
+
+	// done is closed once Run returns.
+	done chan struct{}
+}
+
+// Start runs the load balancer as a frontend, until it is stopped or its listener fails beyond recovery.
+// It returns ErrDuplicateFrontend if a frontend with the same name is running.
+func (f *Frontends) Start(lb *LoadBalancer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.running[lb.Name()]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateFrontend, lb.Name())
+	}
+	if f.running == nil {
+		f.running = make(map[string]*frontend)
+	}
+
+	fe := &frontend{lb: lb, done: make(chan struct{})}
+	f.running[lb.Name()] = fe
+	go func() {
+		defer close(fe.done)
+		err := lb.Run(context.Background())
+		if errors.Is(err, ErrServerClosed) {
+			return
+		}
+
+		// The listener failed and could not be replaced, so the frontend can no longer accept connections.
+		lb.Logger().Error("Frontend stopped", "error", err)
+		f.mu.Lock()
+		if f.running[lb.Name()] == fe {
+			delete(f.running, lb.Name())
+		}
+		f.mu.Unlock()
+	}()
+
+	lb.Logger().Info("Frontend listening", "address", lb.Address())
+	return nil
+}
+
+// Stop shuts down the named frontend as LoadBalancer.Shutdown does, and returns once its connections have ended.
+// The frontend stops accepting connections immediately, and another frontend may then be started with its name.
+func (f *Frontends) Stop(ctx context.Context, name string) error {
+	stopped, err := f.Remove(ctx, name)
+	if err != nil {
+		return err
+	}
+	return <-stopped
+}
+
+// Remove stops the named frontend in the background as Stop does. The frontend is removed before Remove returns,
+// so another frontend may be started with its name at once. The returned channel receives the result of shutting
+// it down once its connections have ended.
+func (f *Frontends) Remove(ctx context.Context, name string) (<-chan error, error) {
+	f.mu.Lock()
+	fe, ok := f.running[name]
+	if ok {
+		delete(f.running, name)
+	}
+	f.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFrontend, name)
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		err := fe.lb.Shutdown(ctx)
+		<-fe.done
+		fe.lb.Logger().Info("Frontend stopped")
+		stopped <- err
+	}()
+	return stopped, nil
+}
+
+// Shutdown stops every frontend at once, and returns once all of their connections have ended. It returns the
+// context's error if connections had to be closed.
+func (f *Frontends) Shutdown(ctx context.Context) error {
+	names := f.Names()
+	errs := make(chan error, len(names))
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := f.Stop(ctx, name); err != nil && !errors.Is(err, ErrUnknownFrontend) {
+				errs <- err
+			}
+		}(name)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// Get returns the running frontend with the given name.
+func (f *Frontends) Get(name string) (*LoadBalancer, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fe, ok := f.running[name]
+	if !ok {
+		return nil, false
+	}
+	return fe.lb, true
+}
+
+// Names returns the names of the running frontends, in order.
+func (f *Frontends) Names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.running))
+	for name := range f.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List returns the running frontends, ordered by name.
+func (f *Frontends) List() []*LoadBalancer {
+	var frontends []*LoadBalancer
+	for _, name := range f.Names() {
+		if lb, ok := f.Get(name); ok {
+			frontends = append(frontends, lb)
+		}
+	}
+	return frontends
+}
+
+// Hosts returns the hosts of every running frontend.
+func (f *Frontends) Hosts() []*upstream.TcpHost {
+	var hosts []*upstream.TcpHost
+	for _, lb := range f.List() {
+		hosts = append(hosts, lb.Hosts()...)
+	}
+	return hosts
+}
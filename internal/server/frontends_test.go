@@ -0,0 +1,121 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestFrontends(t *testing.T) {
+	var frontends server.Frontends
+	defer frontends.Shutdown(context.Background())
+
+	api, apiHosts := newFrontend(t, "api")
+	web, webHosts := newFrontend(t, "web")
+	for _, lb := range []*server.LoadBalancer{web, api} {
+		if err := frontends.Start(lb); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names := frontends.Names(); len(names) != 2 || names[0] != "api" || names[1] != "web" {
+		t.Errorf("Names() = %v, want [api web]", names)
+	}
+	if len(frontends.Hosts()) != 2 {
+		t.Errorf("Hosts() returned %d hosts, want the host of each frontend", len(frontends.Hosts()))
+	}
+
+	// Each frontend forwards to its own pool.
+	assertForwardedTo(t, api, apiHosts[0])
+	assertForwardedTo(t, web, webHosts[0])
+
+	duplicate, _ := newFrontend(t, "api")
+	if err := frontends.Start(duplicate); !errors.Is(err, server.ErrDuplicateFrontend) {
+		t.Errorf("Start() of a duplicate name error = %v, want %v", err, server.ErrDuplicateFrontend)
+	}
+
+	// Stopping one frontend leaves the other running.
+	if err := frontends.Stop(context.Background(), "api"); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if _, err := net.Dial("tcp", api.Address().String()); err == nil {
+		t.Error("stopped frontend still accepts connections")
+	}
+	if _, ok := frontends.Get("api"); ok {
+		t.Error("stopped frontend is still listed")
+	}
+	assertForwardedTo(t, web, webHosts[0])
+
+	if err := frontends.Stop(context.Background(), "api"); !errors.Is(err, server.ErrUnknownFrontend) {
+		t.Errorf("Stop() of a stopped frontend error = %v, want %v", err, server.ErrUnknownFrontend)
+	}
+
+	// A frontend may be started again under the name of a stopped frontend.
+	restarted, restartedHosts := newFrontend(t, "api")
+	if err := frontends.Start(restarted); err != nil {
+		t.Fatalf("Start() after Stop() error = %v", err)
+	}
+	assertForwardedTo(t, restarted, restartedHosts[0])
+
+	if err := frontends.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if len(frontends.Names()) != 0 {
+		t.Errorf("frontends %v are still running after Shutdown()", frontends.Names())
+	}
+}
+
+func TestFrontends_SharedLimits(t *testing.T) {
+	var frontends server.Frontends
+	defer frontends.Shutdown(context.Background())
+
+	// Both frontends share a limit of one connection per client.
+	limiter := server.NewConnectionLimiter(1, nil)
+	api, _ := newFrontend(t, "api", server.WithConnectionLimiter(limiter))
+	web, _ := newFrontend(t, "web", server.WithConnectionLimiter(limiter))
+	for _, lb := range []*server.LoadBalancer{api, web} {
+		if err := frontends.Start(lb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	open, err := net.Dial("tcp", api.Address().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	if !eventually(time.Second*5, func() bool { return len(api.Sessions()) == 1 }) {
+		t.Fatal("connection was not forwarded to a host")
+	}
+
+	rejected, err := net.Dial("tcp", web.Address().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rejected.Close()
+	if !closedByPeer(rejected) {
+		t.Error("connection to another frontend was accepted although the client was at the shared limit")
+	}
+}
+
+// newFrontend returns a load balancer with the given name, which forwards to a test host of its own.
+func newFrontend(t *testing.T, name string, opts ...server.Option) (*server.LoadBalancer, []*upstream.TcpHost) {
+	return newLoadBalancerWithHosts(t, 1, append(opts, server.WithName(name))...)
+}
+
+// assertForwardedTo checks that a connection to the load balancer is answered by the host.
+func assertForwardedTo(t *testing.T, lb *server.LoadBalancer, host *upstream.TcpHost) {
+	t.Helper()
+	conn, err := net.Dial("tcp", lb.Address().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := writeAndReadResponse(t, conn, "payload"); !strings.Contains(response, host.Address().String()) {
+		t.Errorf("connection to %s was answered by %q, want host %s", lb.Name(), response, host.Address())
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+// firstByteBufferSize is the size of the buffer used to copy data until the first byte latency is recorded.
+const firstByteBufferSize = 32 * 1024
+
+// firstByteConn wraps a connection to an upstream host, and records the time between the first data written to
+// the host and the first data read back from it as the first byte latency of the host. Once recorded, ReadFrom and
+// WriteTo hand copies to the wrapped connection, so that a *net.TCPConn can still splice data between sockets.
+type firstByteConn struct {
+	net.Conn
+
+	// host receives the first byte latency observation.
+	host *upstream.TcpHost
+
+	// written is when data was first written to the host. It is zero until then.
+	written time.Time
+
+	// observed is set once the latency has been recorded, after which the connection is a plain passthrough.
+	observed bool
+
+	// mu protects written and observed, since reads and writes happen on different goroutines.
+	mu sync.Mutex
+}
+
+// measureFirstByte returns the host connection wrapped so that its first byte latency is recorded.
+func measureFirstByte(conn net.Conn, host *upstream.TcpHost) net.Conn {
+	return &firstByteConn{Conn: conn, host: host}
+}
+
+// Write writes data to the host, noting when the first data was written.
+func (c *firstByteConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.written.IsZero() && len(b) > 0 {
+		c.written = time.Now()
+	}
+	c.mu.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+// Read reads data from the host, recording the first byte latency on the first read after data was written.
+// Data the host sends before the client has written anything, such as a banner, is not a response and is ignored.
+func (c *firstByteConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n == 0 {
+		return n, err
+	}
+
+	c.mu.Lock()
+	if !c.observed && !c.written.IsZero() {
+		c.observed = true
+		c.host.ObserveFirstByteLatency(time.Since(c.written))
+	}
+	c.mu.Unlock()
+
+	return n, err
+}
+
+// ReadFrom copies data from r to the host until r returns io.EOF. The first data is written with Write, so that
+// its time is noted, and the rest is copied straight to the host connection.
+func (c *firstByteConn) ReadFrom(r io.Reader) (int64, error) {
+	return copyUntil(c, r, c.hasWritten, c.Conn, r)
+}
+
+// WriteTo copies data from the host to w until the host closes the connection. Data is read with Read until the
+// first byte latency is recorded, and the rest is copied straight from the host connection.
+func (c *firstByteConn) WriteTo(w io.Writer) (int64, error) {
+	return copyUntil(w, c, c.hasObserved, w, c.Conn)
+}
+
+// hasWritten reports whether data was written to the host.
+func (c *firstByteConn) hasWritten() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.written.IsZero()
+}
+
+// hasObserved reports whether the first byte latency was recorded.
+func (c *firstByteConn) hasObserved() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.observed
+}
+
+// copyUntil copies from src to dst one read at a time until done reports true, and then copies the rest from
+// restSrc to restDst with io.Copy, so that those can use their own ReadFrom or WriteTo. Like io.Copy, reaching
+// io.EOF is not an error.
+func copyUntil(dst io.Writer, src io.Reader, done func() bool, restDst io.Writer, restSrc io.Reader) (int64, error) {
+	var copied int64
+	buf := make([]byte, firstByteBufferSize)
+	for !done() {
+		n, err := src.Read(buf)
+		if n > 0 {
+			written, writeErr := dst.Write(buf[:n])
+			copied += int64(written)
+			if writeErr != nil {
+				return copied, writeErr
+			}
+			if written < n {
+				return copied, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return copied, err
+		}
+	}
+
+	n, err := io.Copy(restDst, restSrc)
+	return copied + n, err
+}
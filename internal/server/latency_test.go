@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/upstream"
+)
+
+func Test_measureFirstByte(t *testing.T) {
+	lbSide, hostSide := net.Pipe()
+	defer lbSide.Close()
+	defer hostSide.Close()
+
+	host := &upstream.TcpHost{}
+	conn := measureFirstByte(lbSide, host)
+
+	go func() {
+		// The host sends a banner before the client writes anything, which must not count as a response.
+		hostSide.Write([]byte("banner"))
+		buf := make([]byte, 16)
+		if _, err := hostSide.Read(buf); err != nil {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+		hostSide.Write([]byte("response"))
+	}()
+
+	buf := make([]byte, 16)
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := host.FirstByteLatency(); got != 0 {
+		t.Fatalf("FirstByteLatency() after a banner = %v, want 0", got)
+	}
+
+	if _, err := conn.Write([]byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := host.FirstByteLatency(); got < time.Millisecond*20 {
+		t.Errorf("FirstByteLatency() = %v, want at least 20ms", got)
+	}
+}
+
+func Test_measureFirstByte_Copy(t *testing.T) {
+	lbSide, hostSide := net.Pipe()
+	defer lbSide.Close()
+
+	host := &upstream.TcpHost{}
+	conn := measureFirstByte(lbSide, host)
+	if _, ok := conn.(io.ReaderFrom); !ok {
+		t.Fatal("measured connection does not implement io.ReaderFrom")
+	}
+	if _, ok := conn.(io.WriterTo); !ok {
+		t.Fatal("measured connection does not implement io.WriterTo")
+	}
+
+	go func() {
+		defer hostSide.Close()
+		buf := make([]byte, 16)
+		if _, err := hostSide.Read(buf); err != nil {
+			return
+		}
+		time.Sleep(time.Millisecond * 20)
+		hostSide.Write([]byte("response"))
+		hostSide.Write([]byte(" and more"))
+	}()
+
+	sent := make(chan error, 1)
+	go func() {
+		// Hiding the WriteTo of the reader makes io.Copy call ReadFrom, as it does for a client connection.
+		_, err := io.Copy(conn, struct{ io.Reader }{strings.NewReader("request")})
+		sent <- err
+	}()
+
+	var received bytes.Buffer
+	if _, err := io.Copy(&received, conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if got, want := received.String(), "response and more"; got != want {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	if got := host.FirstByteLatency(); got < time.Millisecond*20 {
+		t.Errorf("FirstByteLatency() = %v, want at least 20ms", got)
+	}
+}
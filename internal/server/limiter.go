@@ -0,0 +1,115 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"tcp-load-balancer/internal/identity"
+
+	"github.com/google/uuid"
+)
+
+var ErrConnectionLimitExceeded = errors.New("client connection limit exceeded")
+
+// ConnectionLimiter caps the number of connections each client may have open at once.
+// Clients are keyed by identity, which is derived from the source IP when connections are accepted without TLS.
+type ConnectionLimiter struct {
+	// defaultLimit applies to clients without an override. Zero means unlimited.
+	defaultLimit uint64
+
+	// overrides maps client names to their limit, and takes precedence over defaultLimit. Zero means unlimited.
+	overrides map[string]uint64
+
+	// active tracks the number of open connections for each client ID.
+	// A mutex is used rather than a sync.Map so that clients can be removed once their last connection closes,
+	// which keeps memory bounded when many distinct clients connect over time.
+	active map[uuid.UUID]uint64
+
+	// mu protects the limits and active from concurrent access.
+	mu sync.Mutex
+
+	// rejected counts connections refused because the client was at its limit.
+	rejected uint64
+}
+
+// NewConnectionLimiter returns a limiter which allows defaultLimit active connections per client,
+// except for clients named in overrides. A limit of zero means unlimited.
+func NewConnectionLimiter(defaultLimit uint64, overrides map[string]uint64) *ConnectionLimiter {
+	c := &ConnectionLimiter{active: make(map[uuid.UUID]uint64)}
+	c.SetLimits(defaultLimit, overrides)
+	return c
+}
+
+// SetLimits replaces the limits of the limiter. Connections which are already open are kept, even if a client now has
+// more than its new limit, but the client cannot open more until it is below the limit.
+func (c *ConnectionLimiter) SetLimits(defaultLimit uint64, overrides map[string]uint64) {
+	o := make(map[string]uint64, len(overrides))
+	for name, limit := range overrides {
+		o[name] = limit
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultLimit = defaultLimit
+	c.overrides = o
+}
+
+// Acquire reserves a connection slot for the client, and returns ErrConnectionLimitExceeded if the client is at its limit.
+// Every successful Acquire must be paired with a Release.
+func (c *ConnectionLimiter) Acquire(client identity.ClientIdentity) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	limit := c.limit(client)
+	if limit > 0 && c.active[client.ID] >= limit {
+		atomic.AddUint64(&c.rejected, 1)
+		return fmt.Errorf("%w: %s already has %d active connections", ErrConnectionLimitExceeded, client, limit)
+	}
+	c.active[client.ID]++
+
+	return nil
+}
+
+// Release frees a connection slot previously reserved with Acquire.
+func (c *ConnectionLimiter) Release(client identity.ClientIdentity) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.active[client.ID] {
+	case 0:
+		// Nothing to release; guard against underflow from unpaired calls.
+	case 1:
+		delete(c.active, client.ID)
+	default:
+		c.active[client.ID]--
+	}
+}
+
+// Limit returns the maximum number of active connections for the client. Zero means unlimited.
+func (c *ConnectionLimiter) Limit(client identity.ClientIdentity) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.limit(client)
+}
+
+// limit returns the maximum number of active connections for the client. The caller must hold mu.
+func (c *ConnectionLimiter) limit(client identity.ClientIdentity) uint64 {
+	if limit, ok := c.overrides[client.Name]; ok {
+		return limit
+	}
+	return c.defaultLimit
+}
+
+// Active returns the number of active connections for the client.
+func (c *ConnectionLimiter) Active(client identity.ClientIdentity) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active[client.ID]
+}
+
+// Rejected returns the number of connections refused because the client was at its limit.
+func (c *ConnectionLimiter) Rejected() uint64 {
+	return atomic.LoadUint64(&c.rejected)
+}
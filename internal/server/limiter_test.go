@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"tcp-load-balancer/internal/identity"
+)
+
+func TestConnectionLimiter_Acquire(t *testing.T) {
+	alice := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})
+	bob := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 2)})
+	unlimited := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 3)})
+
+	tests := []struct {
+		name         string
+		client       identity.ClientIdentity
+		acquisitions int
+		wantRejected int
+	}{
+		{
+			name:         "default limit rejects connections above the limit",
+			client:       alice,
+			acquisitions: 4,
+			wantRejected: 2,
+		},
+		{
+			name:         "override raises the limit for a client",
+			client:       bob,
+			acquisitions: 4,
+			wantRejected: 0,
+		},
+		{
+			name:         "override of zero removes the limit for a client",
+			client:       unlimited,
+			acquisitions: 100,
+			wantRejected: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewConnectionLimiter(2, map[string]uint64{bob.Name: 5, unlimited.Name: 0})
+
+			rejected := 0
+			for i := 0; i < tt.acquisitions; i++ {
+				if err := c.Acquire(tt.client); err != nil {
+					if !errors.Is(err, ErrConnectionLimitExceeded) {
+						t.Fatalf("ConnectionLimiter.Acquire() error = %v, want %v", err, ErrConnectionLimitExceeded)
+					}
+					rejected++
+				}
+			}
+
+			if rejected != tt.wantRejected {
+				t.Errorf("rejected %d connections, want %d", rejected, tt.wantRejected)
+			}
+			if c.Rejected() != uint64(tt.wantRejected) {
+				t.Errorf("ConnectionLimiter.Rejected() = %d, want %d", c.Rejected(), tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestConnectionLimiter_Release(t *testing.T) {
+	client := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})
+	c := NewConnectionLimiter(10, nil)
+
+	// Acquire and release concurrently to verify that slots are never leaked.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Acquire(client); err == nil {
+				c.Release(client)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if c.Active(client) != 0 {
+		t.Errorf("ConnectionLimiter.Active() = %d after all connections were released, want 0", c.Active(client))
+	}
+	if len(c.active) != 0 {
+		t.Errorf("limiter still tracks %d clients after all connections were released", len(c.active))
+	}
+
+	// Unpaired releases must not underflow.
+	c.Release(client)
+	if c.Active(client) != 0 {
+		t.Errorf("ConnectionLimiter.Active() = %d after unpaired release, want 0", c.Active(client))
+	}
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/identity"
+
+	"github.com/google/uuid"
+)
+
+var ErrRateLimited = errors.New("connection rate limit exceeded")
+
+// Rate is the sustained number of new connections allowed per second, and the burst allowed above that rate.
+// A Rate with PerSecond of zero is unlimited.
+type Rate struct {
+	// PerSecond is the number of tokens added to the bucket each second.
+	PerSecond float64
+
+	// Burst is the capacity of the bucket, and the number of connections allowed at once after a quiet period.
+	Burst int
+}
+
+// unlimited reports whether the rate does not limit connections.
+func (r Rate) unlimited() bool {
+	return r.PerSecond <= 0
+}
+
+// tokenBucket is a token bucket which is refilled lazily whenever it is used.
+type tokenBucket struct {
+	// tokens is the number of connections currently allowed.
+	tokens float64
+
+	// updated is when tokens was last refilled.
+	updated time.Time
+}
+
+// refill adds the tokens accumulated since the bucket was last updated, up to the burst size.
+func (b *tokenBucket) refill(rate Rate, now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * rate.PerSecond
+		b.updated = now
+	}
+	if burst := float64(rate.Burst); b.tokens > burst {
+		b.tokens = burst
+	}
+}
+
+// RateLimiter limits how often new connections are accepted, for each client and across the whole load balancer.
+// Buckets of clients which have been idle for longer than the idle TTL are expired, so memory stays bounded as
+// connections arrive from many distinct clients.
+type RateLimiter struct {
+	// perClient is the rate allowed for each client.
+	perClient Rate
+
+	// global is the rate allowed across all clients.
+	global Rate
+
+	// idleTTL is how long a client bucket is kept after its last connection.
+	idleTTL time.Duration
+
+	// requestedIdleTTL is the idle TTL the limiter was created with, before it was raised to the time to refill a bucket.
+	requestedIdleTTL time.Duration
+
+	// clock tells the time used to refill buckets.
+	clock clock.Clock
+
+	// globalBucket holds the tokens shared by all clients.
+	globalBucket tokenBucket
+
+	// clients holds the bucket of each client ID.
+	clients map[uuid.UUID]*tokenBucket
+
+	// lastSweep is when idle client buckets were last expired.
+	lastSweep time.Time
+
+	// mu protects the buckets from concurrent access.
+	mu sync.Mutex
+
+	// rejected counts connections refused because a rate was exceeded.
+	rejected uint64
+}
+
+// NewRateLimiter returns a limiter which allows perClient connections per client and global connections in total.
+// Client buckets idle for longer than idleTTL are expired; an idleTTL shorter than the time to refill a bucket
+// is raised to that time, so expiring a bucket never grants a client extra connections.
+func NewRateLimiter(perClient, global Rate, idleTTL time.Duration, c clock.Clock) *RateLimiter {
+	now := c.Now()
+	r := &RateLimiter{
+		requestedIdleTTL: idleTTL,
+		clock:            c,
+		clients:          make(map[uuid.UUID]*tokenBucket),
+		lastSweep:        now,
+	}
+	r.SetRates(perClient, global)
+	r.globalBucket = tokenBucket{tokens: float64(r.global.Burst), updated: now}
+	return r
+}
+
+// SetRates replaces the rates of the limiter. Tokens already in buckets are kept, up to the new burst sizes.
+func (r *RateLimiter) SetRates(perClient, global Rate) {
+	// A bucket must hold at least one token for any connection to be allowed.
+	if perClient.Burst < 1 {
+		perClient.Burst = 1
+	}
+	if global.Burst < 1 {
+		global.Burst = 1
+	}
+
+	idleTTL := r.requestedIdleTTL
+	if !perClient.unlimited() {
+		if refill := time.Duration(float64(perClient.Burst) / perClient.PerSecond * float64(time.Second)); idleTTL < refill {
+			idleTTL = refill
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.perClient = perClient
+	r.global = global
+	r.idleTTL = idleTTL
+}
+
+// Allow takes a token for a new connection from the client, and returns ErrRateLimited if either the
+// client or global rate has been exceeded. A token is only taken when both rates allow the connection.
+func (r *RateLimiter) Allow(client identity.ClientIdentity) error {
+	now := r.clock.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+
+	var clientBucket *tokenBucket
+	if !r.perClient.unlimited() {
+		clientBucket = r.clients[client.ID]
+		if clientBucket == nil {
+			clientBucket = &tokenBucket{tokens: float64(r.perClient.Burst), updated: now}
+			r.clients[client.ID] = clientBucket
+		}
+		clientBucket.refill(r.perClient, now)
+		if clientBucket.tokens < 1 {
+			atomic.AddUint64(&r.rejected, 1)
+			return fmt.Errorf("%w: %s exceeded %.4g connections per second", ErrRateLimited, client, r.perClient.PerSecond)
+		}
+	}
+
+	if !r.global.unlimited() {
+		r.globalBucket.refill(r.global, now)
+		if r.globalBucket.tokens < 1 {
+			atomic.AddUint64(&r.rejected, 1)
+			return fmt.Errorf("%w: load balancer exceeded %.4g connections per second", ErrRateLimited, r.global.PerSecond)
+		}
+		r.globalBucket.tokens--
+	}
+
+	if clientBucket != nil {
+		clientBucket.tokens--
+	}
+
+	return nil
+}
+
+// sweep removes client buckets which have been idle for longer than the idle TTL. It runs at most once per TTL.
+func (r *RateLimiter) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.idleTTL {
+		return
+	}
+	for id, b := range r.clients {
+		if now.Sub(b.updated) >= r.idleTTL {
+			delete(r.clients, id)
+		}
+	}
+	r.lastSweep = now
+}
+
+// Clients returns the number of client buckets currently tracked.
+func (r *RateLimiter) Clients() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.clients)
+}
+
+// Rejected returns the number of connections refused because a rate was exceeded.
+func (r *RateLimiter) Rejected() uint64 {
+	return atomic.LoadUint64(&r.rejected)
+}
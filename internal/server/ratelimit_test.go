@@ -0,0 +1,155 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/identity"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	alice := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})
+	bob := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 2)})
+
+	type attempt struct {
+		client  identity.ClientIdentity
+		advance time.Duration
+		wantErr bool
+	}
+
+	tests := []struct {
+		name      string
+		perClient Rate
+		global    Rate
+		attempts  []attempt
+	}{
+		{
+			name:      "client may burst, and is then limited until tokens refill",
+			perClient: Rate{PerSecond: 1, Burst: 2},
+			attempts: []attempt{
+				{client: alice},
+				{client: alice},
+				{client: alice, wantErr: true},
+				{client: alice, advance: time.Millisecond * 500, wantErr: true},
+				{client: alice, advance: time.Millisecond * 500},
+				{client: alice, wantErr: true},
+			},
+		},
+		{
+			name:      "clients are limited independently",
+			perClient: Rate{PerSecond: 1, Burst: 1},
+			attempts: []attempt{
+				{client: alice},
+				{client: alice, wantErr: true},
+				{client: bob},
+			},
+		},
+		{
+			name:   "global rate is shared by all clients",
+			global: Rate{PerSecond: 10, Burst: 2},
+			attempts: []attempt{
+				{client: alice},
+				{client: bob},
+				{client: alice, wantErr: true},
+				{client: bob, advance: time.Millisecond * 100},
+			},
+		},
+		{
+			name:      "client token is not taken when the global rate rejects the connection",
+			perClient: Rate{PerSecond: 1, Burst: 1},
+			global:    Rate{PerSecond: 1, Burst: 1},
+			attempts: []attempt{
+				{client: bob},
+				{client: alice, wantErr: true},
+				{client: alice, advance: time.Second},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := clock.NewFake(time.Unix(0, 0))
+			r := NewRateLimiter(tt.perClient, tt.global, time.Minute, c)
+
+			rejected := 0
+			for i, a := range tt.attempts {
+				c.Advance(a.advance)
+				err := r.Allow(a.client)
+				if (err != nil) != a.wantErr {
+					t.Fatalf("attempt %d: RateLimiter.Allow() error = %v, wantErr %v", i, err, a.wantErr)
+				}
+				if err != nil {
+					rejected++
+					if !errors.Is(err, ErrRateLimited) {
+						t.Errorf("attempt %d: RateLimiter.Allow() error = %v, want %v", i, err, ErrRateLimited)
+					}
+				}
+			}
+
+			if r.Rejected() != uint64(rejected) {
+				t.Errorf("RateLimiter.Rejected() = %d, want %d", r.Rejected(), rejected)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_ExpiresIdleClients(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	r := NewRateLimiter(Rate{PerSecond: 10, Burst: 10}, Rate{}, time.Minute, c)
+
+	// Connections from many distinct source addresses each create a bucket.
+	for i := 0; i < 1000; i++ {
+		client := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, byte(i/256), byte(i%256))})
+		if err := r.Allow(client); err != nil {
+			t.Fatalf("RateLimiter.Allow() error = %v", err)
+		}
+	}
+	if r.Clients() != 1000 {
+		t.Fatalf("RateLimiter.Clients() = %d, want 1000", r.Clients())
+	}
+
+	// Once the buckets have been idle for the TTL, the next connection expires them.
+	c.Advance(time.Minute)
+	active := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(192, 168, 0, 1)})
+	if err := r.Allow(active); err != nil {
+		t.Fatalf("RateLimiter.Allow() error = %v", err)
+	}
+	if r.Clients() != 1 {
+		t.Errorf("RateLimiter.Clients() = %d after idle buckets expired, want 1", r.Clients())
+	}
+}
+
+func TestRateLimiter_SetRates(t *testing.T) {
+	alice := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})
+	c := clock.NewFake(time.Unix(0, 0))
+	r := NewRateLimiter(Rate{PerSecond: 1, Burst: 1}, Rate{}, time.Minute, c)
+
+	if err := r.Allow(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Allow(alice); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Allow() error = %v, want %v", err, ErrRateLimited)
+	}
+
+	// A higher rate takes effect for the next connection, with the tokens the client already had.
+	r.SetRates(Rate{PerSecond: 10, Burst: 10}, Rate{})
+	c.Advance(time.Millisecond * 200)
+	for i := 0; i < 2; i++ {
+		if err := r.Allow(alice); err != nil {
+			t.Fatalf("Allow() %d after raising the rate error = %v", i, err)
+		}
+	}
+	if err := r.Allow(alice); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Allow() error = %v, want %v", err, ErrRateLimited)
+	}
+
+	// Removing the rate allows every connection.
+	r.SetRates(Rate{}, Rate{})
+	for i := 0; i < 100; i++ {
+		if err := r.Allow(alice); err != nil {
+			t.Fatalf("Allow() without a rate error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"tcp-load-balancer/internal/policy"
+	"tcp-load-balancer/internal/upstream"
+
+	"github.com/google/uuid"
+)
+
+var ErrDuplicateUpstream = errors.New("upstream host is listed more than once")
+
+// Settings are the parts of the configuration of a LoadBalancer which can change while it runs.
+type Settings struct {
+	// Hosts are the upstream hosts to load balance. Hosts which are already load balanced are matched by ID, and keep
+	// their connections, health and latency while taking the pool, labels and weight of the listed host.
+	// Hosts which are no longer listed are drained.
+	Hosts []*upstream.TcpHost
+
+	// Policy decides which clients may reach which hosts. When nil, every client may reach every host.
+	Policy *policy.Policy
+
+	// MaxConnectionsPerClient and ClientConnectionOverrides replace the limits of the connection limiter.
+	// They have no effect on a load balancer created without a connection limiter.
+	MaxConnectionsPerClient   uint64
+	ClientConnectionOverrides map[string]uint64
+
+	// PerClientRate and GlobalRate replace the rates of the rate limiter. They have no effect on a load balancer
+	// created without a rate limiter.
+	PerClientRate Rate
+	GlobalRate    Rate
+
+	// RetryPolicy replaces the policy which controls failover to other hosts when dialing fails.
+	RetryPolicy RetryPolicy
+
+	// DrainTimeout bounds how long the connections of a removed host may stay open. Zero waits until they end,
+	// or until the load balancer is shut down.
+	DrainTimeout time.Duration
+}
+
+// Changes describes how Reconfigure changed the hosts of a LoadBalancer.
+type Changes struct {
+	// Added are the hosts which were not load balanced before.
+	Added []*upstream.TcpHost
+
+	// Updated are the hosts whose pool, labels or weight changed.
+	Updated []*upstream.TcpHost
+
+	// Draining are the hosts which are no longer listed, and are being drained.
+	Draining []*upstream.TcpHost
+}
+
+// Reconfigure applies the settings to the running load balancer. The hosts, policy, limits and retry policy change
+// together, so a new connection sees either the old or the new settings, never a mix of them. Connections which are
+// being forwarded are left open, including those to removed hosts, which are drained in the background.
+// If the settings are invalid, an error is returned and nothing is changed.
+func (l *LoadBalancer) Reconfigure(s Settings) (Changes, error) {
+	listed := make(map[uuid.UUID]*upstream.TcpHost, len(s.Hosts))
+	for _, h := range s.Hosts {
+		if h == nil {
+			return Changes{}, fmt.Errorf("%w: nil host", ErrUnknownUpstream)
+		}
+		if _, ok := listed[h.ID()]; ok {
+			return Changes{}, fmt.Errorf("%w: %s", ErrDuplicateUpstream, h.Address())
+		}
+		listed[h.ID()] = h
+	}
+	if s.RetryPolicy.MaxAttempts < 1 {
+		s.RetryPolicy.MaxAttempts = 1
+	}
+
+	var changes Changes
+	l.hostMu.Lock()
+
+	running := make(map[uuid.UUID]*upstream.TcpHost, len(l.hosts))
+	for _, h := range l.hosts {
+		running[h.ID()] = h
+	}
+
+	for _, h := range s.Hosts {
+		current, ok := running[h.ID()]
+		if !ok {
+			h.OnHealthChange(l.logHealthChange)
+			l.hosts = append(l.hosts, h)
+			changes.Added = append(changes.Added, h)
+			continue
+		}
+
+		if l.draining[current] {
+			// The host was listed again while it was draining, so it is returned to rotation.
+			delete(l.draining, current)
+			changes.Added = append(changes.Added, current)
+		}
+		if updateHost(current, h) {
+			changes.Updated = append(changes.Updated, current)
+		}
+	}
+
+	for _, h := range l.hosts {
+		if _, ok := listed[h.ID()]; !ok && !l.draining[h] {
+			l.markDraining(h)
+			changes.Draining = append(changes.Draining, h)
+		}
+	}
+
+	l.policy = s.Policy
+	l.retryPolicy = s.RetryPolicy
+	if l.connLimiter != nil {
+		l.connLimiter.SetLimits(s.MaxConnectionsPerClient, s.ClientConnectionOverrides)
+	}
+	if l.rateLimiter != nil {
+		l.rateLimiter.SetRates(s.PerClientRate, s.GlobalRate)
+	}
+	l.hostMu.Unlock()
+
+	for _, h := range changes.Draining {
+		go func(host *upstream.TcpHost) {
+			ctx, cancel := l.drainContext(s.DrainTimeout)
+			defer cancel()
+			l.drain(ctx, host)
+		}(h)
+	}
+
+	l.log.Info("Reconfigured load balancer", "added", len(changes.Added), "updated", len(changes.Updated), "draining", len(changes.Draining))
+	return changes, nil
+}
+
+// updateHost copies the pool, labels and weight of the listed host to the running host, and reports whether any changed.
+func updateHost(running, listed *upstream.TcpHost) bool {
+	changed := false
+	if running.Pool() != listed.Pool() {
+		running.SetPool(listed.Pool())
+		changed = true
+	}
+	if !equalLabels(running.Labels(), listed.Labels()) {
+		running.SetLabels(listed.Labels())
+		changed = true
+	}
+	if running.Weight() != listed.Weight() {
+		// The listed host was created with New, so its weight is never too large.
+		_ = running.SetWeight(listed.Weight())
+		changed = true
+	}
+	return changed
+}
+
+// equalLabels reports whether two sets of labels are the same.
+func equalLabels(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// drainContext returns the context which bounds draining a host removed by Reconfigure. It is done once the timeout
+// passes, if there is one, or once the load balancer has shut down and is closing connections.
+func (l *LoadBalancer) drainContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(l.context(), timeout)
+	}
+	return context.WithCancel(l.context())
+}
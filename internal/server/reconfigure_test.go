@@ -0,0 +1,144 @@
+package server_test
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/policy"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+	"tcp-load-balancer/test"
+)
+
+func TestLoadBalancer_Reconfigure(t *testing.T) {
+	t.Run("hosts are added, updated and drained without closing connections", func(t *testing.T) {
+		l, hosts := newLoadBalancerWithHosts(t, 2)
+		clientConn := openSession(t, l, 1)
+		removed := sessionHost(t, l)
+		kept := hosts[0]
+		if kept == removed {
+			kept = hosts[1]
+		}
+
+		// The kept host is listed as a new host with the same address, which identifies it as the running host.
+		reweighted, err := upstream.New(kept.Address().String(), "tcp", upstream.WithWeight(5), upstream.WithLabels(map[string]string{"env": "prod"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		added := newTestHost(t)
+
+		changes, err := l.Reconfigure(server.Settings{Hosts: []*upstream.TcpHost{reweighted, added}, RetryPolicy: server.DefaultRetryPolicy})
+		if err != nil {
+			t.Fatalf("Reconfigure() error = %v", err)
+		}
+		if len(changes.Added) != 1 || changes.Added[0] != added {
+			t.Errorf("Added = %v, want the new host", changes.Added)
+		}
+		if len(changes.Updated) != 1 || changes.Updated[0] != kept {
+			t.Errorf("Updated = %v, want the running host with the same address", changes.Updated)
+		}
+		if len(changes.Draining) != 1 || changes.Draining[0] != removed || !l.Draining(removed) {
+			t.Errorf("Draining = %v, want the host which is no longer listed", changes.Draining)
+		}
+		if kept.Weight() != 5 || kept.Labels()["env"] != "prod" {
+			t.Errorf("running host has weight %d and labels %v, want the weight and labels of the listed host", kept.Weight(), kept.Labels())
+		}
+
+		// The open connection to the removed host is still forwarded, and the host is removed once it ends.
+		if response := writeAndReadResponse(t, clientConn, "existing"); !strings.Contains(response, removed.Address().String()) {
+			t.Errorf("existing connection was answered by %q, want host %s", response, removed.Address())
+		}
+		if !eventually(time.Second*5, func() bool { _, ok := l.Host(removed.ID()); return !ok }) {
+			t.Error("removed host is still load balanced after its connection ended")
+		}
+		if len(l.Hosts()) != 2 {
+			t.Errorf("Hosts() returned %d hosts, want 2", len(l.Hosts()))
+		}
+	})
+
+	t.Run("policy and limits change together", func(t *testing.T) {
+		l, hosts := newLoadBalancerWithHosts(t, 1, server.WithConnectionLimiter(server.NewConnectionLimiter(0, nil)))
+		client := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})
+
+		denyAll, err := policy.New(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := l.Reconfigure(server.Settings{Hosts: hosts, Policy: denyAll, RetryPolicy: server.DefaultRetryPolicy}); err != nil {
+			t.Fatal(err)
+		}
+		_, serverConn := net.Pipe()
+		if err := l.HandleConnection(serverConn, client); !errors.Is(err, server.ErrNoAuthorizedHost) {
+			t.Errorf("HandleConnection() error = %v, want %v", err, server.ErrNoAuthorizedHost)
+		}
+
+		if _, err := l.Reconfigure(server.Settings{Hosts: hosts, MaxConnectionsPerClient: 1, RetryPolicy: server.DefaultRetryPolicy}); err != nil {
+			t.Fatal(err)
+		}
+		openSession(t, l, 1)
+		_, serverConn = net.Pipe()
+		if err := l.HandleConnection(serverConn, client); !errors.Is(err, server.ErrConnectionLimitExceeded) {
+			t.Errorf("HandleConnection() error = %v, want %v", err, server.ErrConnectionLimitExceeded)
+		}
+	})
+
+	t.Run("a draining host which is listed again is returned to rotation", func(t *testing.T) {
+		l, hosts := newLoadBalancerWithHosts(t, 1)
+		clientConn := openSession(t, l, 1)
+
+		if _, err := l.Reconfigure(server.Settings{RetryPolicy: server.DefaultRetryPolicy}); err != nil {
+			t.Fatal(err)
+		}
+		changes, err := l.Reconfigure(server.Settings{Hosts: hosts, RetryPolicy: server.DefaultRetryPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(changes.Added) != 1 || l.Draining(hosts[0]) {
+			t.Error("host listed again was not returned to rotation")
+		}
+
+		clientConn.Close()
+		if !eventually(time.Second*5, func() bool { return len(l.Sessions()) == 0 }) {
+			t.Fatal("connection did not end")
+		}
+		time.Sleep(time.Millisecond * 50)
+		if _, ok := l.Host(hosts[0].ID()); !ok {
+			t.Error("host returned to rotation was removed when its connection ended")
+		}
+	})
+
+	t.Run("invalid settings leave the running settings in place", func(t *testing.T) {
+		l, hosts := newLoadBalancerWithHosts(t, 1)
+		duplicate, err := upstream.New(hosts[0].Address().String(), "tcp")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = l.Reconfigure(server.Settings{Hosts: []*upstream.TcpHost{hosts[0], duplicate}, RetryPolicy: server.DefaultRetryPolicy})
+		if !errors.Is(err, server.ErrDuplicateUpstream) {
+			t.Errorf("Reconfigure() error = %v, want %v", err, server.ErrDuplicateUpstream)
+		}
+		if got := l.Hosts(); len(got) != 1 || got[0] != hosts[0] || l.Draining(hosts[0]) {
+			t.Error("hosts changed after invalid settings were rejected")
+		}
+	})
+}
+
+// newTestHost starts a test host, and returns an upstream host for it.
+func newTestHost(t *testing.T) *upstream.TcpHost {
+	h, err := test.InitializeHost("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+
+	host, err := upstream.New(h.Addr().String(), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+var (
+	ErrAttemptsExhausted = errors.New("dial attempt budget exhausted")
+	ErrDeadlineExceeded  = errors.New("dial deadline exceeded")
+)
+
+// RetryPolicy controls how many upstream hosts are tried for a client when dialing a host fails.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of hosts dialed for a single client connection, including the first.
+	MaxAttempts int
+
+	// Timeout bounds the total time spent dialing hosts for a single client connection. Zero means no deadline.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy is used unless overridden with WithRetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Timeout:     time.Second * 10,
+}
+
+// DialAttempt records a failed attempt to dial an upstream host.
+type DialAttempt struct {
+	// Host is the address of the host which was dialed.
+	Host string
+
+	// Err is the reason the dial failed.
+	Err error
+}
+
+// DialError is returned when no upstream host accepted a connection for a client.
+// It lists every host that was tried and why it failed.
+type DialError struct {
+	// Attempts are the failed attempts, in the order they were made.
+	Attempts []DialAttempt
+
+	// Err is the reason no further hosts were tried.
+	Err error
+}
+
+// Error lists the reason dialing stopped, followed by each failed attempt.
+func (e *DialError) Error() string {
+	attempts := make([]string, len(e.Attempts))
+	for i, a := range e.Attempts {
+		attempts[i] = fmt.Sprintf("%s: %s", a.Host, a.Err)
+	}
+	return fmt.Sprintf("unable to dial an upstream host after %d attempt(s) (%s): [%s]", len(e.Attempts), e.Err, strings.Join(attempts, "; "))
+}
+
+// Unwrap returns the reason no further hosts were tried.
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// dial connects to the host selected for the client. If the dial fails, the host's connection count is decremented,
+// and the connection is retried on a newly selected host which excludes every host already tried, until a host
+// accepts the connection or the retry policy is exhausted. The connection count of the returned host remains incremented.
+// It also returns the number of failed attempts, which were retried unless the dial failed.
+func (l *LoadBalancer) dial(client identity.ClientIdentity, host *upstream.TcpHost) (net.Conn, *upstream.TcpHost, int, error) {
+	retryPolicy := l.currentRetryPolicy()
+	ctx := l.context()
+	if retryPolicy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, retryPolicy.Timeout)
+		defer cancel()
+	}
+
+	var attempts []DialAttempt
+	var tried []*upstream.TcpHost
+	for {
+		hostConn, err := host.DialContext(ctx)
+		if err == nil {
+			return hostConn, host, len(attempts), nil
+		}
+
+		host.DecrementActiveConnections()
+		attempts = append(attempts, DialAttempt{Host: host.Address().String(), Err: err})
+		tried = append(tried, host)
+
+		if len(attempts) >= retryPolicy.MaxAttempts {
+			return nil, nil, len(attempts), &DialError{Attempts: attempts, Err: ErrAttemptsExhausted}
+		}
+		if l.context().Err() != nil {
+			return nil, nil, len(attempts), &DialError{Attempts: attempts, Err: ErrServerClosed}
+		}
+		if ctx.Err() != nil {
+			return nil, nil, len(attempts), &DialError{Attempts: attempts, Err: ErrDeadlineExceeded}
+		}
+
+		l.selectMu.Lock()
+		host, err = l.SelectHost(client, tried...)
+		if err == nil {
+			host.IncrementActiveConnections()
+		}
+		l.selectMu.Unlock()
+
+		if err != nil {
+			return nil, nil, len(attempts), &DialError{Attempts: attempts, Err: err}
+		}
+	}
+}
+
+// currentRetryPolicy returns the retry policy, which may be replaced by Reconfigure.
+func (l *LoadBalancer) currentRetryPolicy() RetryPolicy {
+	l.hostMu.RLock()
+	defer l.hostMu.RUnlock()
+	return l.retryPolicy
+}
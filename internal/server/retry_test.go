@@ -0,0 +1,145 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"tcp-load-balancer/internal/balancer"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestLoadBalancer_dial(t *testing.T) {
+	tests := []struct {
+		name          string
+		hosts         func(t *testing.T) []*upstream.TcpHost
+		policy        RetryPolicy
+		wantErrIs     error
+		wantAttempts  int
+		wantHostIndex int
+	}{
+		{
+			name: "connection fails over to another host when the selected host is down",
+			hosts: func(t *testing.T) []*upstream.TcpHost {
+				return []*upstream.TcpHost{newHost(t, deadAddress(t)), newHost(t, liveAddress(t))}
+			},
+			policy:        RetryPolicy{MaxAttempts: 3},
+			wantAttempts:  1,
+			wantHostIndex: 1,
+		},
+		{
+			name: "dialing stops when the attempt budget is exhausted",
+			hosts: func(t *testing.T) []*upstream.TcpHost {
+				return []*upstream.TcpHost{newHost(t, deadAddress(t)), newHost(t, deadAddress(t)), newHost(t, liveAddress(t))}
+			},
+			policy:       RetryPolicy{MaxAttempts: 2},
+			wantErrIs:    ErrAttemptsExhausted,
+			wantAttempts: 2,
+		},
+		{
+			name: "dialing stops when every host has been tried",
+			hosts: func(t *testing.T) []*upstream.TcpHost {
+				return []*upstream.TcpHost{newHost(t, deadAddress(t)), newHost(t, deadAddress(t))}
+			},
+			policy:       RetryPolicy{MaxAttempts: 5},
+			wantErrIs:    ErrNoHosts,
+			wantAttempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := tt.hosts(t)
+			l := &LoadBalancer{hosts: hosts, retryPolicy: tt.policy, balancer: balancer.LeastConnections{}}
+			client := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})
+
+			// Mirror HandleConnection, which increments the count of the first host before dialing.
+			first, err := l.SelectHost(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first.IncrementActiveConnections()
+
+			conn, host, retries, err := l.dial(client, first)
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Fatalf("LoadBalancer.dial() error = %v, wantErr %v", err, tt.wantErrIs)
+			}
+
+			if retries != tt.wantAttempts {
+				t.Errorf("LoadBalancer.dial() made %d failed attempt(s), want %d", retries, tt.wantAttempts)
+			}
+			if tt.wantErrIs != nil {
+				var dialErr *DialError
+				if !errors.As(err, &dialErr) {
+					t.Fatalf("LoadBalancer.dial() error = %T, want *DialError", err)
+				}
+				if len(dialErr.Attempts) != tt.wantAttempts {
+					t.Errorf("DialError.Attempts has %d attempts, want %d", len(dialErr.Attempts), tt.wantAttempts)
+				}
+				for _, a := range dialErr.Attempts {
+					if !strings.Contains(err.Error(), a.Host) {
+						t.Errorf("DialError %q does not list host %s", err, a.Host)
+					}
+				}
+			} else {
+				defer conn.Close()
+				if host != hosts[tt.wantHostIndex] {
+					t.Errorf("LoadBalancer.dial() connected to %s, want %s", host.Address(), hosts[tt.wantHostIndex].Address())
+				}
+			}
+
+			// Only the connected host should keep its connection count incremented.
+			for i, h := range hosts {
+				want := uint64(0)
+				if tt.wantErrIs == nil && i == tt.wantHostIndex {
+					want = 1
+				}
+				if h.ConnectionCount() != want {
+					t.Errorf("host %d ConnectionCount() = %d, want %d", i, h.ConnectionCount(), want)
+				}
+			}
+		})
+	}
+}
+
+// newHost is a helper to create an upstream host for the address.
+func newHost(t *testing.T, address string) *upstream.TcpHost {
+	h, err := upstream.New(address, "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// liveAddress returns the address of a listener which accepts connections until the test ends.
+func liveAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// deadAddress returns an address which refuses connections.
+func deadAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+	return address
+}
@@ -1,112 +1,314 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
-	"log"
 	"net"
+	"sync/atomic"
 	"time"
+
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/identity"
 )
 
+// DefaultHandshakeTimeout is the time a client has to complete the TLS handshake unless overridden with WithHandshakeTimeout.
+const DefaultHandshakeTimeout = time.Second * 5
+
 var ErrUninitialized = errors.New("load balancer not initialized")
 var ConnectionNotEstablished = errors.New("net.Conn cannot be nil")
+var ErrHostClosed = errors.New("host closed prior to client disconnection")
 
-// Run handles incoming connections until terminated.
-func (l *LoadBalancer) Run() error {
-	if l.listener == nil {
+// Run handles incoming connections until the context is done or the load balancer is shut down. Once the context is
+// done, no new connections are accepted, but connections already accepted are still forwarded; use Shutdown to wait
+// for them to end. Run returns the context's error, or ErrServerClosed after Shutdown.
+func (l *LoadBalancer) Run(ctx context.Context) error {
+	l.listenerMu.Lock()
+	uninitialized := l.listener == nil
+	l.listenerMu.Unlock()
+	if uninitialized {
 		return ErrUninitialized
 	}
 
+	// Closing the listener is the only way to interrupt Accept, so it is closed once the context is done.
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.closeListener()
+		case <-stopped:
+		}
+	}()
+
+	var backoff time.Duration
 	for {
-		// TODO: Set up mTLS in next PR. For now, connect without TLS.
-		clientConn, err := l.listener.Accept()
+		l.listenerMu.Lock()
+		ln := l.listener
+		l.listenerMu.Unlock()
+
+		clientConn, err := ln.Accept()
 		if err != nil {
-			// TODO: attempt to re-establish the listener with a retry mechanism (leaving out of scope for this project).
-			return err
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if l.isShutdown() {
+				return ErrServerClosed
+			}
+
+			if isTemporaryAcceptError(err) {
+				backoff = nextBackoff(backoff, l.acceptPolicy)
+				atomic.AddUint64(&l.acceptRetries, 1)
+				l.log.Warn("Temporary error accepting connection", "retry_in", backoff, "error", err)
+				if !sleep(ctx, backoff) {
+					return ctx.Err()
+				}
+				continue
+			}
+
+			l.log.Error("Listener failed, listening again", "address", ln.Addr(), "error", err)
+			if err = l.relisten(ctx, err); err != nil {
+				return err
+			}
+			backoff = 0
+			continue
+		}
+		backoff = 0
+		atomic.AddUint64(&l.stats.accepted, 1)
+
+		if l.tlsConfig == nil {
+			l.serve(clientConn, identity.FromAddr(clientConn.RemoteAddr()))
+			continue
 		}
 
-		if err := l.HandleConnection(clientConn); err != nil {
-			log.Printf("Unable to handle connection: %s", err)
+		if !l.startWork() {
+			l.closeConnection(clientConn)
+			continue
 		}
+
+		// The handshake runs in its own goroutine so that a slow or malicious client cannot stall the accept loop.
+		go func() {
+			defer l.workers.Done()
+
+			tlsConn, client, err := l.authenticate(clientConn)
+			if err != nil {
+				atomic.AddUint64(&l.rejectedConnections, 1)
+				l.log.Warn("Rejected connection", "client_address", clientConn.RemoteAddr(), "error", err)
+				l.closeConnection(clientConn)
+				return
+			}
+
+			l.serve(tlsConn, client)
+		}()
 	}
 }
 
-// handleConnection selects an upstream host, tracks connection counts, and forwards data upstream.
-func (l *LoadBalancer) HandleConnection(clientConn net.Conn) error {
-	// Host selection is not included in goroutine handling so that requests arriving at the same time are not routed to the same host.
-	// This adds a small amount of latency to the request, but ensures accurate load balancing.
-	host, err := l.LeastConnections()
+// isShutdown reports whether Shutdown has been called.
+func (l *LoadBalancer) isShutdown() bool {
+	l.lifecycleMu.Lock()
+	defer l.lifecycleMu.Unlock()
+	return l.shutdown
+}
+
+// serve checks the connection against the rate limiter, and then passes it to HandleConnection.
+func (l *LoadBalancer) serve(clientConn net.Conn, client identity.ClientIdentity) {
+	if l.rateLimiter != nil {
+		if err := l.rateLimiter.Allow(client); err != nil {
+			l.log.Warn("Rejected connection", "client", client, "error", err)
+			l.closeConnection(clientConn)
+			return
+		}
+	}
+
+	if err := l.HandleConnection(clientConn, client); err != nil {
+		l.log.Warn("Unable to handle connection", "client", client, "error", err)
+	}
+}
+
+// authenticate completes the TLS handshake on the connection, which includes verification of the client certificate,
+// and returns the identity of the client taken from the verified certificate.
+func (l *LoadBalancer) authenticate(conn net.Conn) (*tls.Conn, identity.ClientIdentity, error) {
+	tlsConn := tls.Server(conn, l.tlsConfig)
+
+	if err := tlsConn.SetDeadline(time.Now().Add(l.handshakeTimeout)); err != nil {
+		return nil, identity.ClientIdentity{}, fmt.Errorf("unable to set handshake deadline: %s", err)
+	}
+
+	// The handshake is also abandoned if the load balancer stops while it is in progress.
+	if err := tlsConn.HandshakeContext(l.context()); err != nil {
+		return nil, identity.ClientIdentity{}, fmt.Errorf("tls handshake failed: %s", err)
+	}
+
+	// Clear the deadline so it does not apply to forwarded data.
+	if err := tlsConn.SetDeadline(time.Time{}); err != nil {
+		return nil, identity.ClientIdentity{}, fmt.Errorf("unable to clear handshake deadline: %s", err)
+	}
+
+	client, err := identity.FromConnectionState(tlsConn.ConnectionState(), l.identitySource, conn.RemoteAddr())
+	if err != nil {
+		return nil, identity.ClientIdentity{}, fmt.Errorf("unable to identify client: %w", err)
+	}
+
+	return tlsConn, client, nil
+}
+
+// HandleConnection selects an upstream host for the client, tracks connection counts, and forwards data upstream.
+func (l *LoadBalancer) HandleConnection(clientConn net.Conn, client identity.ClientIdentity) error {
+	if !l.startWork() {
+		l.closeConnection(clientConn)
+		return ErrServerClosed
+	}
+
+	if l.connLimiter != nil {
+		if err := l.connLimiter.Acquire(client); err != nil {
+			l.workers.Done()
+			l.closeConnection(clientConn)
+			return err
+		}
+	}
+
+	record := l.newAccessRecord(client, clientConn)
+	logger := l.log.With("connection_id", record.ConnectionID, "client", client)
+
+	// Host selection is not included in goroutine handling, and is serialized with the count increment, so that requests arriving
+	// at the same time are not routed to the same host. This adds a small amount of latency to the request, but ensures accurate load balancing.
+	l.selectMu.Lock()
+	host, err := l.SelectHost(client)
 	if err != nil {
-		closeConnection(clientConn)
+		l.selectMu.Unlock()
+		atomic.AddUint64(&l.stats.unroutable, 1)
+		l.releaseClient(client)
+		l.workers.Done()
+		l.closeConnection(clientConn)
+		l.logAccess(record, accesslog.Failed, err)
 		return err
 	}
 
 	// Increment the connection count for the selected host.
 	host.IncrementActiveConnections()
+	l.selectMu.Unlock()
 
 	// Copy data to the selected host, and decrement the connection count when the copy finishes.
 	go func() {
+		// Deferred so that the client slot and host count are released however the connection ends.
+		defer l.workers.Done()
+		defer l.releaseClient(client)
+		defer l.closeConnection(clientConn)
 
-		hostConn, err := host.Dial()
+		// If the selected host cannot be dialed, another host is selected, so the host that was connected may differ.
+		hostConn, host, retries, err := l.dial(client, host)
+		record.Retries = retries
 		if err != nil {
-			// TODO: Select a different host if this host is down (next PR).
-			log.Printf("Error dialing host: %s", err)
-			closeConnection(clientConn)
+			atomic.AddUint64(&l.stats.dialFailures, 1)
+			logger.Error("Unable to dial a host", "retries", retries, "error", err)
+			l.logAccess(record, accesslog.Failed, err)
 			return
 		}
+		record.Upstream = host.Address().String()
+		logger = logger.With("host_id", host.ID(), "host", host.Address())
+		logger.Debug("Forwarding connection", "retries", retries)
+		// The session is untracked last, so that the host's connection count is released once draining it completes.
+		s := l.startSession(record.ConnectionID, client, host, clientConn, hostConn)
+		defer l.sessions.untrack(s)
+		defer host.DecrementActiveConnections()
+		defer l.closeConnection(hostConn)
 
-		if err = ForwardData(clientConn, hostConn, l.hostTimeout); err != nil {
-			// TODO: Select a different host if this host is down, and communicate the error over a channel rather than just logging it here (next PR).
-			log.Printf("Error forwarding data: %s", err)
+		// The connections are passed to forward unwrapped, or wrapped in a way which keeps ReadFrom and WriteTo, so
+		// that data between TCP connections can be spliced rather than copied through the process.
+		bytesIn, bytesOut, err := forward(clientConn, measureFirstByte(hostConn, host))
+		record.BytesIn, record.BytesOut = uint64(bytesIn), uint64(bytesOut)
+		l.recordBytes(record.BytesIn, record.BytesOut)
+		if s.wasForced() {
+			logger.Info("Closed connection")
+			l.logAccess(record, accesslog.Closed, nil)
+			return
 		}
-
-		closeConnection(clientConn)
-		closeConnection(hostConn)
-
-		// Decrement the connection count for the selected host.
-		host.DecrementActiveConnections()
+		// A host which closes its connection first has finished its response, as in most request/response protocols,
+		// so only a reset or a timeout counts as a passive failure. Dial failures are recorded when dialing.
+		switch ForwardErrorCauseOf(err) {
+		case CauseReset, CauseTimeout:
+			host.RecordFailure()
+		default:
+			host.RecordSuccess()
+		}
+		if err != nil {
+			l.recordForwardError(err)
+			// TODO: Communicate the error over a channel rather than just logging it here (next PR).
+			logger.Warn("Error forwarding data", "bytes_in", record.BytesIn, "bytes_out", record.BytesOut, "error", err)
+		}
+		l.logAccess(record, termination(err), err)
 	}()
 
 	return nil
 }
 
+// releaseClient frees the connection slot held by the client, if connections are limited.
+func (l *LoadBalancer) releaseClient(client identity.ClientIdentity) {
+	if l.connLimiter != nil {
+		l.connLimiter.Release(client)
+	}
+}
+
 // ForwardData copies data from the client to the host, and also from the host to the client.
 // It will return an error if data cannot be copied, or the host closes prior to the client disconnecting.
 func ForwardData(clientConn net.Conn, hostConn net.Conn, hostTimeout time.Duration) error {
+	_, _, err := forward(clientConn, hostConn)
+	return err
+}
+
+// forward copies data between the client and the host as ForwardData does, and returns the number of bytes copied
+// from the client to the host and from the host to the client. Once either copy ends, the deadlines of both
+// connections are expired so that the other copy ends as well, and its count is known.
+func forward(clientConn net.Conn, hostConn net.Conn) (bytesIn, bytesOut int64, err error) {
 	if clientConn == nil || hostConn == nil {
-		return ConnectionNotEstablished
+		return 0, 0, ConnectionNotEstablished
 	}
 
-	// result is used to do one of the following:
-	// 1. return any error from the client to host copy command
-	// 2. return nil when the client is closed before the host
-	// 3. return an error from the host to client copy if it either closes or errors BEFORE the client disconnects.
-	result := make(chan error, 1)
+	// The first copy to end decides the result:
+	// 1. any error from the client to host copy
+	// 2. nil when the client is closed before the host
+	// 3. an error from the host to client copy if it either closes or errors BEFORE the client disconnects.
+	fromHost := make(chan error, 1)
+	fromClient := make(chan error, 1)
 
 	go func() {
 		// Copy response from host to client. It will continue running until hostConn is closed or an error is received.
-		if _, err := io.Copy(clientConn, hostConn); err != nil {
-			result <- err
-			return
+		var err error
+		if bytesOut, err = io.Copy(clientConn, hostConn); err == nil {
+			err = ErrHostClosed
 		}
-		result <- errors.New("host closed prior to client disconnection")
+		fromHost <- err
 	}()
 	go func() {
 		// Copy data to host (dst) from client (src). This will stay open until clientConn is closed.
-		_, err := io.Copy(hostConn, clientConn)
-		// Push the err (which is usually nil) onto the result channel to signal that this function can finish.
-		result <- err
+		var err error
+		bytesIn, err = io.Copy(hostConn, clientConn)
+		fromClient <- err
 	}()
 
-	return <-result
+	other := fromClient
+	select {
+	case err = <-fromHost:
+	case err = <-fromClient:
+		other = fromHost
+	}
+	now := time.Now()
+	clientConn.SetDeadline(now)
+	hostConn.SetDeadline(now)
+	<-other
+
+	return bytesIn, bytesOut, err
 }
 
-// closeConnection closes the connection and logs the error, if any.
-func closeConnection(conn net.Conn) {
+// closeConnection closes the connection and logs the error, if any, at debug level, since connections are often
+// closed by the other side first.
+func (l *LoadBalancer) closeConnection(conn net.Conn) {
 	if conn == nil {
 		return
 	}
 	if err := conn.Close(); err != nil {
-		log.Printf("Unable to close client connection: %s", err)
+		l.log.Debug("Unable to close connection", "remote_address", conn.RemoteAddr(), "error", err)
 	}
 }
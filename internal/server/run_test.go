@@ -3,11 +3,18 @@ package server_test
 // Using separate _test package to avoid circular dependency with import of "tcp-load-balancer/test" package.
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
 	"net"
 	"strings"
 	"testing"
 	"time"
 
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/logging"
 	"tcp-load-balancer/internal/server"
 	"tcp-load-balancer/internal/upstream"
 	"tcp-load-balancer/test"
@@ -146,7 +153,7 @@ func TestLoadBalancer_handleConnection_Counter(t *testing.T) {
 		// Start watching the connection count, and allow some time to observe the expected change.
 		expectConnectionChange(host, time.Second*5, 1, incremented)
 
-		if err := l.HandleConnection(clientServerConn); err != nil {
+		if err := l.HandleConnection(clientServerConn, identity.FromAddr(clientServerConn.RemoteAddr())); err != nil {
 			t.Errorf("LoadBalancer.HandleConnection() error = %v", err)
 		}
 
@@ -167,6 +174,59 @@ func TestLoadBalancer_handleConnection_Counter(t *testing.T) {
 	})
 }
 
+func TestLoadBalancer_HandleConnection_HostClosesAfterResponding(t *testing.T) {
+	// The host answers each request and then closes its connection, as request/response protocols do.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 64)
+			n, _ := conn.Read(buf)
+			conn.Write(append([]byte("response to "), buf[:n]...))
+			conn.Close()
+		}
+	}()
+
+	host, err := upstream.New(ln.Addr().String(), "tcp", upstream.WithUnhealthyThreshold(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := server.New("tcp", ":0", time.Second*1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.AddUpstream(host)
+
+	for i := 0; i < 5; i++ {
+		clientConn, serverConn := net.Pipe()
+		if err := l.HandleConnection(serverConn, identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientConn.Write([]byte("request")); err != nil {
+			t.Fatal(err)
+		}
+		// The client reads until the load balancer closes its connection, which it does once the host closed first.
+		response, _ := io.ReadAll(clientConn)
+		clientConn.Close()
+		if string(response) != "response to request" {
+			t.Fatalf("response = %q, want %q", response, "response to request")
+		}
+		if !eventually(time.Second*5, func() bool { return len(l.Sessions()) == 0 }) {
+			t.Fatal("connection did not end after the host closed it")
+		}
+		if !host.Healthy() {
+			t.Fatalf("host was marked unhealthy after %d connections which it closed normally", i+1)
+		}
+	}
+}
+
 // expectConnectionChange is a helper function that watches the connection count of a host and returns true when expected difference is observed.
 // results are written to the input channel.
 func expectConnectionChange(host *upstream.TcpHost, timeout time.Duration, expectedDifference int, c chan bool) {
@@ -205,3 +265,235 @@ func writeAndReadResponse(t *testing.T, conn net.Conn, payload string) string {
 
 	return string(response[:n])
 }
+
+func TestLoadBalancer_Run_MutualTLS(t *testing.T) {
+	pki, err := test.NewPKI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := test.InitializeHost("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := upstream.New(h.Addr().String(), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := server.New("tcp", ":0", time.Second*1, server.WithMutualTLS(pki.ServerCertificate, pki.ClientCA.Pool()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.AddUpstream(host)
+
+	go func() {
+		_ = l.Run(context.Background())
+	}()
+
+	tests := []struct {
+		name         string
+		clientConfig func() *tls.Config
+		wantRejected bool
+	}{
+		{
+			name: "client with certificate signed by trusted CA is forwarded",
+			clientConfig: func() *tls.Config {
+				c, err := pki.ClientTLSConfig("trusted-client")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c
+			},
+			wantRejected: false,
+		},
+		{
+			name: "client with certificate signed by unknown CA is rejected",
+			clientConfig: func() *tls.Config {
+				unknownCA, err := test.NewCertificateAuthority("unknown CA")
+				if err != nil {
+					t.Fatal(err)
+				}
+				certificate, err := unknownCA.IssueClient("untrusted-client")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return &tls.Config{
+					Certificates: []tls.Certificate{certificate},
+					RootCAs:      pki.ServerCA.Pool(),
+					ServerName:   test.ServerName,
+					MinVersion:   tls.VersionTLS13,
+				}
+			},
+			wantRejected: true,
+		},
+		{
+			name: "client without a certificate is rejected",
+			clientConfig: func() *tls.Config {
+				return &tls.Config{
+					RootCAs:    pki.ServerCA.Pool(),
+					ServerName: test.ServerName,
+					MinVersion: tls.VersionTLS13,
+				}
+			},
+			wantRejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejectedBefore := l.RejectedConnections()
+
+			// With TLS 1.3 the client finishes its side of the handshake before the server verifies the client certificate,
+			// so a rejection is only observed when reading from the connection.
+			response, err := sendOverTLS(l.Address().String(), tt.clientConfig(), "payload")
+			if tt.wantRejected {
+				if err == nil {
+					t.Errorf("expected connection to be rejected, got response %q", response)
+				}
+				if !eventually(time.Second*5, func() bool { return l.RejectedConnections() == rejectedBefore+1 }) {
+					t.Errorf("LoadBalancer.RejectedConnections() = %d, want %d", l.RejectedConnections(), rejectedBefore+1)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error sending over TLS: %s", err)
+			}
+			if !strings.Contains(response, "payload") {
+				t.Errorf("response %q did not contain original payload", response)
+			}
+			if l.RejectedConnections() != rejectedBefore {
+				t.Errorf("LoadBalancer.RejectedConnections() = %d, want %d", l.RejectedConnections(), rejectedBefore)
+			}
+		})
+	}
+}
+
+// sendOverTLS dials the address over TLS, writes the payload, and returns the response.
+func sendOverTLS(address string, config *tls.Config, payload string) (string, error) {
+	conn, err := tls.Dial("tcp", address, config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(time.Second * 5)); err != nil {
+		return "", err
+	}
+	if _, err = conn.Write([]byte(payload)); err != nil {
+		return "", err
+	}
+
+	response := make([]byte, 1024)
+	n, err := conn.Read(response)
+	if err != nil {
+		return "", err
+	}
+	return string(response[:n]), nil
+}
+
+// eventually polls the condition until it returns true or the timeout elapses.
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return condition()
+}
+
+func TestLoadBalancer_HandleConnection_ConnectionLimiter(t *testing.T) {
+	h, err := test.InitializeHost("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, err := upstream.New(h.Addr().String(), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := server.NewConnectionLimiter(1, nil)
+	l, err := server.New("tcp", ":0", time.Second*1, server.WithConnectionLimiter(limiter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.AddUpstream(host)
+
+	client := identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000})
+
+	firstClientConn, firstServerConn := net.Pipe()
+	if err := l.HandleConnection(firstServerConn, client); err != nil {
+		t.Fatalf("LoadBalancer.HandleConnection() error = %v", err)
+	}
+
+	// A second connection from the same client exceeds the limit, and is closed.
+	_, secondServerConn := net.Pipe()
+	if err := l.HandleConnection(secondServerConn, client); !errors.Is(err, server.ErrConnectionLimitExceeded) {
+		t.Errorf("LoadBalancer.HandleConnection() error = %v, want %v", err, server.ErrConnectionLimitExceeded)
+	}
+	if !connectionIsClosed(secondServerConn) {
+		t.Error("The rejected connection was not closed.")
+	}
+	if limiter.Rejected() != 1 {
+		t.Errorf("ConnectionLimiter.Rejected() = %d, want 1", limiter.Rejected())
+	}
+
+	// Closing the first connection releases the slot.
+	_ = writeAndReadResponse(t, firstClientConn, "test")
+	if !eventually(time.Second*5, func() bool { return limiter.Active(client) == 0 }) {
+		t.Fatalf("ConnectionLimiter.Active() = %d after connection closed, want 0", limiter.Active(client))
+	}
+
+	thirdClientConn, thirdServerConn := net.Pipe()
+	if err := l.HandleConnection(thirdServerConn, client); err != nil {
+		t.Errorf("LoadBalancer.HandleConnection() error = %v after slot was released", err)
+	}
+	_ = writeAndReadResponse(t, thirdClientConn, "test")
+}
+
+func TestLoadBalancer_HandleConnection_Logger(t *testing.T) {
+	var buf lockedBuffer
+	logger := logging.New(&buf, logging.WithLevel(logging.LevelDebug), logging.WithFormat(logging.JSON))
+	l, hosts := newLoadBalancerWithHosts(t, 1, server.WithName("api"), server.WithLogger(logger))
+
+	conn := openSession(t, l, 1)
+	defer conn.Close()
+	if err := l.RemoveUpstream(hosts[0].ID()); err != nil {
+		t.Fatal(err)
+	}
+	if !eventually(time.Second*5, func() bool { return strings.Contains(buf.String(), `"msg":"Closed connection"`) }) {
+		t.Fatalf("log = %q, want the connection to be closed", buf.String())
+	}
+
+	// Every message about the connection names the frontend, the connection, the client and the host.
+	for _, msg := range []string{"Forwarding connection", "Closed connection"} {
+		var found bool
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var m struct {
+				Level        string `json:"level"`
+				Msg          string `json:"msg"`
+				Frontend     string `json:"frontend"`
+				ConnectionID uint64 `json:"connection_id"`
+				Client       string `json:"client"`
+				HostID       string `json:"host_id"`
+			}
+			if err := json.Unmarshal([]byte(line), &m); err != nil {
+				t.Fatalf("unable to decode %q: %s", line, err)
+			}
+			if m.Msg != msg {
+				continue
+			}
+			found = true
+			if m.Frontend != "api" || m.ConnectionID == 0 || m.Client != "address=10.0.0.1" || m.HostID != hosts[0].ID().String() {
+				t.Errorf("%q = %+v, want the frontend, connection, client and host", msg, m)
+			}
+		}
+		if !found {
+			t.Errorf("log = %q, want %q", buf.String(), msg)
+		}
+	}
+}
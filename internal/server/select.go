@@ -0,0 +1,130 @@
+package server
+
+import (
+	"errors"
+	"math/rand"
+
+	"tcp-load-balancer/internal/balancer"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+var (
+	ErrNoHosts          = balancer.ErrNoHosts
+	ErrNoAuthorizedHost = errors.New("no authorized upstream host available for client")
+)
+
+// sampleAttempts is the number of hosts sampled for each candidate a balancer.Sampler compares, before the hosts are
+// filtered in full instead.
+const sampleAttempts = 4
+
+// SelectHost filters the hosts to those the client is authorized to reach, and asks the balancer to pick one of them.
+// Draining hosts and hosts in exclude are never selected, which allows a connection to fail over to a host it has not tried yet.
+// Unhealthy hosts are skipped unless none of the remaining hosts are healthy, in which case the unhealthy
+// hosts are offered anyway, since a host marked unhealthy by passive failures may have since recovered. A host
+// marked unhealthy by passive failures is also selected once its cooldown passes, to test whether it recovered.
+// With sticky sessions, a client is sent to the host it is pinned to while that host is a healthy candidate,
+// and is otherwise re-balanced and pinned to the newly picked host.
+// Balancers which only compare a few random candidates, such as PowerOfTwoChoices, are given hosts sampled at random,
+// so that only the sampled hosts are checked, unless too few of them are healthy candidates or sessions are sticky.
+func (l *LoadBalancer) SelectHost(client identity.ClientIdentity, exclude ...*upstream.TcpHost) (*upstream.TcpHost, error) {
+	l.hostMu.RLock()
+	defer l.hostMu.RUnlock()
+	if len(l.hosts) == 0 {
+		return nil, ErrNoHosts
+	}
+
+	if sampler, ok := l.balancer.(balancer.Sampler); ok && l.sticky == nil {
+		if host, ok := l.sampleHost(sampler, client, exclude); ok {
+			return host, nil
+		}
+	}
+
+	var healthy, unhealthy []*upstream.TcpHost
+	authorized := false
+
+	for _, h := range l.hosts {
+		if l.policy != nil && !l.policy.Authorize(client, h).Allowed {
+			continue
+		}
+		authorized = true
+		if l.draining[h] || containsHost(exclude, h) {
+			continue
+		}
+		if h.Healthy() {
+			healthy = append(healthy, h)
+			continue
+		}
+		if h.ClaimRetry() {
+			return h, nil
+		}
+		unhealthy = append(unhealthy, h)
+	}
+
+	if !authorized {
+		return nil, ErrNoAuthorizedHost
+	}
+
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = unhealthy
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoHosts
+	}
+
+	if l.sticky == nil {
+		return l.balancer.Pick(candidates, balancer.ConnInfo{Client: client})
+	}
+
+	if pinned, ok := l.sticky.Lookup(client); ok && pinned.Healthy() && containsHost(candidates, pinned) {
+		l.sticky.Pin(client, pinned)
+		return pinned, nil
+	}
+	host, err := l.balancer.Pick(candidates, balancer.ConnInfo{Client: client})
+	if err != nil {
+		return nil, err
+	}
+	l.sticky.Pin(client, host)
+	return host, nil
+}
+
+// sampleHost picks a host from hosts sampled at random, checking only the sampled hosts, and reports whether enough of
+// them were healthy candidates. A sampled host whose passive failure cooldown has passed is selected to test whether
+// it recovered, as it is by a full scan. The caller must hold hostMu.
+func (l *LoadBalancer) sampleHost(sampler balancer.Sampler, client identity.ClientIdentity, exclude []*upstream.TcpHost) (*upstream.TcpHost, bool) {
+	size := sampler.SampleSize()
+	candidates := make([]*upstream.TcpHost, 0, size)
+	for attempt := 0; attempt < size*sampleAttempts && len(candidates) < size; attempt++ {
+		h := l.hosts[rand.Intn(len(l.hosts))]
+		if containsHost(candidates, h) || l.draining[h] || containsHost(exclude, h) {
+			continue
+		}
+		if l.policy != nil && !l.policy.Authorize(client, h).Allowed {
+			continue
+		}
+		if h.Healthy() {
+			candidates = append(candidates, h)
+			continue
+		}
+		if h.ClaimRetry() {
+			return h, true
+		}
+	}
+	if len(candidates) < size {
+		return nil, false
+	}
+
+	host, err := sampler.Pick(candidates, balancer.ConnInfo{Client: client})
+	return host, err == nil
+}
+
+// containsHost reports whether the host is in the list.
+func containsHost(hosts []*upstream.TcpHost, host *upstream.TcpHost) bool {
+	for _, h := range hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,346 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/balancer"
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/policy"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestLoadBalancer_SelectHost(t *testing.T) {
+	tests := []struct {
+		name            string
+		l               *LoadBalancer
+		client          identity.ClientIdentity
+		exclude         []int
+		wantErr         bool
+		wantErrIs       error
+		wantHostAtIndex int
+	}{
+		{
+			name: "host picked by the balancer is selected",
+			l: func() *LoadBalancer {
+				h0 := &upstream.TcpHost{}
+				h0.IncrementActiveConnections()
+
+				// h1 has the fewest connections and should be selected.
+				h1 := &upstream.TcpHost{}
+
+				return &LoadBalancer{
+					hosts:    []*upstream.TcpHost{h0, h1},
+					balancer: balancer.LeastConnections{},
+				}
+			}(),
+			wantErr:         false,
+			wantHostAtIndex: 1,
+		},
+		{
+			name:      "no hosts returns an error (and does not panic)",
+			l:         &LoadBalancer{balancer: balancer.LeastConnections{}},
+			wantErr:   true,
+			wantErrIs: ErrNoHosts,
+		},
+		{
+			name: "excluded hosts are skipped",
+			l: &LoadBalancer{
+				hosts:    []*upstream.TcpHost{{}, {}},
+				balancer: balancer.LeastConnections{},
+			},
+			exclude:         []int{0},
+			wantErr:         false,
+			wantHostAtIndex: 1,
+		},
+		{
+			name: "every host excluded returns an error",
+			l: &LoadBalancer{
+				hosts:    []*upstream.TcpHost{{}},
+				balancer: balancer.LeastConnections{},
+			},
+			exclude:   []int{0},
+			wantErr:   true,
+			wantErrIs: ErrNoHosts,
+		},
+		{
+			name: "hosts the client is not authorized for are skipped",
+			l: func() *LoadBalancer {
+				// h0 has the fewest connections, but is in a pool the client may not reach.
+				h0 := newPooledHost(t, "127.0.0.1:9000", "restricted")
+
+				h1 := newPooledHost(t, "127.0.0.1:9001", "public")
+				h1.IncrementActiveConnections()
+
+				return &LoadBalancer{
+					hosts:    []*upstream.TcpHost{h0, h1},
+					policy:   newPolicy(t, policy.Rule{Name: "public", Effect: policy.Allow, Upstreams: policy.UpstreamSelector{Pools: []string{"public"}}}),
+					balancer: balancer.LeastConnections{},
+				}
+			}(),
+			client:          identity.ClientIdentity{Name: "client"},
+			wantErr:         false,
+			wantHostAtIndex: 1,
+		},
+		{
+			name: "unhealthy hosts are skipped",
+			l: func() *LoadBalancer {
+				// h0 has the fewest connections, but is unhealthy.
+				h0 := &upstream.TcpHost{}
+				h0.SetHealthy(false)
+
+				h1 := &upstream.TcpHost{}
+				h1.IncrementActiveConnections()
+
+				return &LoadBalancer{
+					hosts:    []*upstream.TcpHost{h0, h1},
+					balancer: balancer.LeastConnections{},
+				}
+			}(),
+			wantErr:         false,
+			wantHostAtIndex: 1,
+		},
+		{
+			name: "unhealthy host is selected when no healthy hosts remain",
+			l: func() *LoadBalancer {
+				h0 := &upstream.TcpHost{}
+				h0.SetHealthy(false)
+
+				return &LoadBalancer{
+					hosts:    []*upstream.TcpHost{h0},
+					balancer: balancer.LeastConnections{},
+				}
+			}(),
+			wantErr:         false,
+			wantHostAtIndex: 0,
+		},
+		{
+			name: "no authorized hosts returns a distinct error",
+			l: &LoadBalancer{
+				hosts:    []*upstream.TcpHost{newPooledHost(t, "127.0.0.1:9000", "restricted")},
+				policy:   newPolicy(t),
+				balancer: balancer.LeastConnections{},
+			},
+			client:    identity.ClientIdentity{Name: "client"},
+			wantErr:   true,
+			wantErrIs: ErrNoAuthorizedHost,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var exclude []*upstream.TcpHost
+			for _, i := range tt.exclude {
+				exclude = append(exclude, tt.l.Hosts()[i])
+			}
+
+			got, err := tt.l.SelectHost(tt.client, exclude...)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadBalancer.SelectHost() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("LoadBalancer.SelectHost() error = %v, want %v", err, tt.wantErrIs)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.l.Hosts()[tt.wantHostAtIndex]) {
+				t.Errorf("LoadBalancer.SelectHost() = %v, want %v", got, tt.l.Hosts()[tt.wantHostAtIndex])
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_SelectHost_EjectedHostRecovers(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	ejected, err := upstream.New("127.0.0.1:9000", "tcp", upstream.WithUnhealthyThreshold(1), upstream.WithEjectionCooldown(time.Second), upstream.WithClock(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	healthy := newPooledHost(t, "127.0.0.1:9001", "")
+	l := &LoadBalancer{hosts: []*upstream.TcpHost{ejected, healthy}, balancer: balancer.LeastConnections{}}
+
+	ejected.RecordFailure()
+	for i := 0; i < 3; i++ {
+		if got, _ := l.SelectHost(identity.ClientIdentity{}); got != healthy {
+			t.Fatal("ejected host was selected before its cooldown passed")
+		}
+	}
+
+	c.Advance(time.Second)
+	if got, _ := l.SelectHost(identity.ClientIdentity{}); got != ejected {
+		t.Fatal("ejected host was not selected once its cooldown passed")
+	}
+
+	// The connection to the host succeeded, so it is balanced like any other healthy host.
+	ejected.RecordSuccess()
+	healthy.IncrementActiveConnections()
+	if got, _ := l.SelectHost(identity.ClientIdentity{}); got != ejected {
+		t.Error("recovered host was not returned to rotation")
+	}
+}
+
+func TestLoadBalancer_SelectHost_Sampled(t *testing.T) {
+	tests := []struct {
+		name string
+		// unavailable makes hosts other than the wanted ones unavailable to the client.
+		unavailable func(l *LoadBalancer, h *upstream.TcpHost)
+		hosts       int
+		want        []int
+	}{
+		{
+			name:        "unhealthy hosts are never sampled",
+			unavailable: func(l *LoadBalancer, h *upstream.TcpHost) { h.SetHealthy(false) },
+			hosts:       10,
+			want:        []int{2, 6},
+		},
+		{
+			name:        "draining hosts are never sampled",
+			unavailable: func(l *LoadBalancer, h *upstream.TcpHost) { l.markDraining(h) },
+			hosts:       10,
+			want:        []int{3, 4, 9},
+		},
+		{
+			name:        "hosts are filtered in full when too few are sampled",
+			unavailable: func(l *LoadBalancer, h *upstream.TcpHost) { h.SetHealthy(false) },
+			hosts:       1000,
+			want:        []int{417},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &LoadBalancer{balancer: balancer.PowerOfTwoChoices{}}
+			wanted := make(map[*upstream.TcpHost]bool)
+			for i := 0; i < tt.hosts; i++ {
+				l.hosts = append(l.hosts, &upstream.TcpHost{})
+			}
+			for _, i := range tt.want {
+				wanted[l.hosts[i]] = true
+			}
+			for _, h := range l.hosts {
+				if !wanted[h] {
+					tt.unavailable(l, h)
+				}
+			}
+
+			for i := 0; i < 200; i++ {
+				got, err := l.SelectHost(identity.ClientIdentity{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !wanted[got] {
+					t.Fatal("SelectHost() selected a host which was not available")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkLoadBalancer_SelectHost measures host selection as a connection sees it, including the filtering of hosts
+// by policy, draining and health, rather than the balancer alone.
+func BenchmarkLoadBalancer_SelectHost(b *testing.B) {
+	strategies := []struct {
+		name     string
+		balancer balancer.Balancer
+	}{
+		{name: "LeastConnections", balancer: balancer.LeastConnections{}},
+		{name: "PowerOfTwoChoices", balancer: balancer.PowerOfTwoChoices{}},
+	}
+
+	for _, n := range []int{10, 100, 1000} {
+		hosts := make([]*upstream.TcpHost, n)
+		for i := range hosts {
+			hosts[i] = &upstream.TcpHost{}
+			for c := 0; c < i%7; c++ {
+				hosts[i].IncrementActiveConnections()
+			}
+		}
+
+		for _, s := range strategies {
+			l := &LoadBalancer{hosts: hosts, balancer: s.balancer}
+			b.Run(fmt.Sprintf("%s/hosts=%d", s.name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := l.SelectHost(identity.ClientIdentity{}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestLoadBalancer_SelectHost_ConsistentHash(t *testing.T) {
+	l := &LoadBalancer{balancer: balancer.NewRingHash(balancer.HashByClientID, balancer.DefaultVirtualNodes)}
+	for i := 0; i < 5; i++ {
+		l.AddUpstream(newPooledHost(t, fmt.Sprintf("10.1.0.%d:8080", i+1), ""))
+	}
+
+	clients := make([]identity.ClientIdentity, 1000)
+	before := make([]*upstream.TcpHost, len(clients))
+	for i := range clients {
+		clients[i] = identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i))})
+		h, err := l.SelectHost(clients[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[i] = h
+	}
+
+	added := newPooledHost(t, "10.1.0.6:8080", "")
+	l.AddUpstream(added)
+
+	moved := 0
+	for i, c := range clients {
+		h, err := l.SelectHost(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != before[i] {
+			moved++
+			if h != added {
+				t.Fatal("a client moved to a host other than the added host")
+			}
+		}
+	}
+	// Ideally a sixth of the clients move to the added host.
+	if moved == 0 || moved > 350 {
+		t.Errorf("%d of 1000 clients moved after adding a 6th host, want roughly 170", moved)
+	}
+
+	// Removing the host again returns every client to the host it was on before.
+	if err := l.RemoveUpstream(added.ID()); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range clients {
+		h, err := l.SelectHost(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h != before[i] {
+			t.Fatal("a client did not return to its original host after the added host was removed")
+		}
+	}
+}
+
+// newPooledHost is a helper to create a host in the named pool.
+func newPooledHost(t *testing.T, address, pool string) *upstream.TcpHost {
+	h, err := upstream.New(address, "tcp", upstream.WithPool(pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// newPolicy is a helper to create a policy from the given rules.
+func newPolicy(t *testing.T, rules ...policy.Rule) *policy.Policy {
+	p, err := policy.New(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
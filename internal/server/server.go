@@ -1,39 +1,297 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/balancer"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/policy"
 	"tcp-load-balancer/internal/upstream"
+
+	"github.com/google/uuid"
 )
 
+var ErrUnknownUpstream = errors.New("upstream host is not load balanced")
+
 // LoadBalancer is a TCP load balancer with methods for handling connections from clients to hosts.
 type LoadBalancer struct {
-	// listener is the TCP listener for this load balancer.
-	listener *net.TCPListener
+	// name identifies the load balancer among the frontends of a process.
+	name string
+
+	// listener is the TCP listener for this load balancer. It is replaced if it fails and Run listens again.
+	listener net.Listener
+
+	// network is the network the listener listens on, so that Run can listen again on the same network.
+	network string
+
+	// listenFunc opens a new listener when Run listens again. When nil, net.Listen is used. It is set by tests.
+	listenFunc func(network, address string) (net.Listener, error)
+
+	// listenerClosed is set once the listener has been closed to stop Run, after which it is not replaced.
+	listenerClosed bool
+
+	// listenerMu protects listener and listenerClosed from concurrent access.
+	listenerMu sync.Mutex
+
+	// acceptPolicy controls how Run recovers when accepting a connection fails.
+	acceptPolicy AcceptPolicy
+
+	// acceptRetries and relistens count the failures Run recovered from.
+	acceptRetries uint64
+	relistens     uint64
 
 	// hosts is the list of upstream hosts
 	hosts []*upstream.TcpHost
 
-	// hostMu protects the hosts list from concurrent access.
+	// policy decides which clients may reach which hosts. When nil, every client may reach every host.
+	policy *policy.Policy
+
+	// connLimiter caps the number of active connections per client. When nil, clients are not limited.
+	connLimiter *ConnectionLimiter
+
+	// rateLimiter limits how often new connections are accepted. When nil, connections are not rate limited.
+	rateLimiter *RateLimiter
+
+	// retryPolicy controls failover to other hosts when dialing the selected host fails.
+	retryPolicy RetryPolicy
+
+	// balancer picks the host for each connection from the hosts the client may reach.
+	balancer balancer.Balancer
+
+	// sticky pins clients to the host they were last sent to. When nil, every connection is balanced.
+	sticky *StickyTable
+
+	// draining holds the hosts which are being drained. They remain in hosts until their sessions have ended,
+	// but are not selected for new connections.
+	draining map[*upstream.TcpHost]bool
+
+	// hostMu protects the hosts list, draining hosts, policy and retry policy from concurrent access, so that
+	// Reconfigure changes them together.
 	hostMu sync.RWMutex
 
+	// sessions tracks the connections being forwarded, so that they can be closed when a host is drained.
+	sessions sessionRegistry
+
+	// workers counts the goroutines handling connections, so that Shutdown can wait for them.
+	workers sync.WaitGroup
+
+	// shutdown is set by Shutdown, after which no new connections are handled.
+	shutdown bool
+
+	// lifecycleMu protects shutdown, and orders it with additions to workers.
+	lifecycleMu sync.Mutex
+
+	// lifetime is done once the load balancer has shut down and is closing connections, which abandons dials
+	// and TLS handshakes in progress. endLifetime ends it.
+	lifetime    context.Context
+	endLifetime context.CancelFunc
+
 	// hostTimeout controls how long the LB will wait for a response from the host prior to timing out.
 	hostTimeout time.Duration
+
+	// tlsConfig is used to terminate mTLS on accepted connections. When nil, connections are accepted without TLS.
+	tlsConfig *tls.Config
+
+	// identitySource selects which field of the verified client certificate identifies the client.
+	identitySource identity.Source
+
+	// handshakeTimeout bounds how long a client has to complete the TLS handshake.
+	handshakeTimeout time.Duration
+
+	// selectMu serializes host selection and connection count increments so that concurrent connections are balanced accurately.
+	selectMu sync.Mutex
+
+	// rejectedConnections counts connections which were closed because they failed authentication.
+	rejectedConnections uint64
+
+	// accessLog records every connection which is forwarded, or which fails to be. When nil, connections are not recorded.
+	accessLog *accesslog.Logger
+
+	// stats counts accepted connections, the failures to forward them, and the data forwarded.
+	stats stats
+
+	// log receives messages about the load balancer and its connections. Nil means the default logger.
+	log *logging.Logger
+}
+
+// Option configures optional behavior of a LoadBalancer during New.
+type Option func(*LoadBalancer)
+
+// WithName names the load balancer, which identifies it among the Frontends of a process.
+func WithName(name string) Option {
+	return func(l *LoadBalancer) {
+		l.name = name
+	}
+}
+
+// WithMutualTLS requires every client to complete a TLS 1.3 handshake and present a certificate signed by one of clientCAs.
+// The certificate is presented to clients as the identity of the load balancer.
+func WithMutualTLS(certificate tls.Certificate, clientCAs *x509.CertPool) Option {
+	return func(l *LoadBalancer) {
+		l.tlsConfig = &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientCAs:    clientCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS13,
+		}
+	}
+}
+
+// WithHandshakeTimeout overrides the default time a client has to complete the TLS handshake.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(l *LoadBalancer) {
+		l.handshakeTimeout = timeout
+	}
 }
 
-// Hosts returns the list of hosts that are being load balanced.
+// WithIdentitySource selects which field of the verified client certificate is authoritative for the client's identity.
+// The default is the subject common name. It has no effect unless mTLS is enabled.
+func WithIdentitySource(source identity.Source) Option {
+	return func(l *LoadBalancer) {
+		l.identitySource = source
+	}
+}
+
+// WithPolicy restricts which upstream hosts each client may be forwarded to.
+// The policy denies access by default, so every client needs at least one allow rule to connect.
+func WithPolicy(p *policy.Policy) Option {
+	return func(l *LoadBalancer) {
+		l.policy = p
+	}
+}
+
+// WithConnectionLimiter caps the number of connections each client may have open at once.
+func WithConnectionLimiter(limiter *ConnectionLimiter) Option {
+	return func(l *LoadBalancer) {
+		l.connLimiter = limiter
+	}
+}
+
+// WithRateLimiter limits how often new connections are accepted, per client and across the load balancer.
+func WithRateLimiter(limiter *RateLimiter) Option {
+	return func(l *LoadBalancer) {
+		l.rateLimiter = limiter
+	}
+}
+
+// WithAccessLog records every connection which is forwarded to a host, or which no host could be found for, in the
+// access log. Connections refused by limiters or failing authentication are counted but not recorded.
+func WithAccessLog(logger *accesslog.Logger) Option {
+	return func(l *LoadBalancer) {
+		l.accessLog = logger
+	}
+}
+
+// WithLogger sets the logger which receives messages about the load balancer and its connections. The name of the
+// load balancer is added to every message.
+func WithLogger(logger *logging.Logger) Option {
+	return func(l *LoadBalancer) {
+		l.log = logger
+	}
+}
+
+// WithRetryPolicy overrides DefaultRetryPolicy, which controls failover to other hosts when dialing fails.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(l *LoadBalancer) {
+		if policy.MaxAttempts < 1 {
+			policy.MaxAttempts = 1
+		}
+		l.retryPolicy = policy
+	}
+}
+
+// WithBalancer overrides the default least connections strategy used to pick a host for each connection.
+func WithBalancer(b balancer.Balancer) Option {
+	return func(l *LoadBalancer) {
+		l.balancer = b
+	}
+}
+
+// WithStickySessions sends each client to the host it was last sent to, for as long as the table keeps it pinned.
+func WithStickySessions(table *StickyTable) Option {
+	return func(l *LoadBalancer) {
+		l.sticky = table
+	}
+}
+
+// Name returns the name of the load balancer, or an empty string if it was not named with WithName.
+func (l *LoadBalancer) Name() string {
+	return l.name
+}
+
+// Logger returns the logger of the load balancer, which adds its name to every message.
+func (l *LoadBalancer) Logger() *logging.Logger {
+	return l.log
+}
+
+// hostLogger returns the logger of the load balancer with the ID and address of the host added to every message.
+func (l *LoadBalancer) hostLogger(host *upstream.TcpHost) *logging.Logger {
+	return l.log.With("host_id", host.ID(), "host", host.Address())
+}
+
+// StickySessions returns the table of pinned clients, or nil if sticky sessions are not enabled.
+func (l *LoadBalancer) StickySessions() *StickyTable {
+	return l.sticky
+}
+
+// ConnectionLimiter returns the limiter of active connections per client, or nil if clients are not limited.
+func (l *LoadBalancer) ConnectionLimiter() *ConnectionLimiter {
+	return l.connLimiter
+}
+
+// RateLimiter returns the limiter of new connections, or nil if connections are not rate limited.
+func (l *LoadBalancer) RateLimiter() *RateLimiter {
+	return l.rateLimiter
+}
+
+// RejectedConnections returns the number of connections which were closed because they failed authentication.
+func (l *LoadBalancer) RejectedConnections() uint64 {
+	return atomic.LoadUint64(&l.rejectedConnections)
+}
+
+// Hosts returns a copy of the list of hosts that are being load balanced, including hosts which are draining.
 func (l *LoadBalancer) Hosts() []*upstream.TcpHost {
 	l.hostMu.RLock()
 	defer l.hostMu.RUnlock()
-	return l.hosts
+	hosts := make([]*upstream.TcpHost, len(l.hosts))
+	copy(hosts, l.hosts)
+	return hosts
+}
+
+// Host returns the load balanced host with the given ID.
+func (l *LoadBalancer) Host(id uuid.UUID) (*upstream.TcpHost, bool) {
+	l.hostMu.RLock()
+	defer l.hostMu.RUnlock()
+	for _, h := range l.hosts {
+		if h.ID() == id {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// Draining reports whether the host is being drained.
+func (l *LoadBalancer) Draining(host *upstream.TcpHost) bool {
+	l.hostMu.RLock()
+	defer l.hostMu.RUnlock()
+	return l.draining[host]
 }
 
 // Address returns the address of the load balancer.
 // If the listener is nil, a blank address is returned.
 func (l *LoadBalancer) Address() net.Addr {
+	l.listenerMu.Lock()
+	defer l.listenerMu.Unlock()
 	if l.listener == nil {
 		return &net.TCPAddr{}
 	}
@@ -43,15 +301,136 @@ func (l *LoadBalancer) Address() net.Addr {
 // AddUpstream adds a new upstream host to the load balancer.
 func (l *LoadBalancer) AddUpstream(host *upstream.TcpHost) {
 	if host != nil {
+		host.OnHealthChange(l.logHealthChange)
 		l.hostMu.Lock()
 		l.hosts = append(l.hosts, host)
 		l.hostMu.Unlock()
 	}
 }
 
+// RemoveUpstream stops load balancing the host with the given ID, and immediately closes its open connections.
+func (l *LoadBalancer) RemoveUpstream(id uuid.UUID) error {
+	host, ok := l.removeHost(id)
+	if !ok {
+		return ErrUnknownUpstream
+	}
+
+	forced := l.sessions.await(canceledContext(), func(s *session) bool { return s.Host == host })
+	l.hostLogger(host).Info("Removed upstream host", "closed_connections", forced)
+	return nil
+}
+
+// DrainUpstream stops sending new connections to the host with the given ID, and waits for its open connections
+// to end before it stops load balancing the host. If the context is done before the connections end, they are closed.
+// Pass a context with a deadline to bound how long draining takes.
+func (l *LoadBalancer) DrainUpstream(ctx context.Context, id uuid.UUID) error {
+	l.hostMu.Lock()
+	var host *upstream.TcpHost
+	for _, h := range l.hosts {
+		if h.ID() == id {
+			host = h
+		}
+	}
+	if host == nil {
+		l.hostMu.Unlock()
+		return ErrUnknownUpstream
+	}
+	l.markDraining(host)
+	l.hostMu.Unlock()
+
+	l.drain(ctx, host)
+	return nil
+}
+
+// markDraining stops new connections from being sent to the host. The caller must hold hostMu.
+func (l *LoadBalancer) markDraining(host *upstream.TcpHost) {
+	if l.draining == nil {
+		l.draining = make(map[*upstream.TcpHost]bool)
+	}
+	l.draining[host] = true
+}
+
+// drain waits for the open connections of a draining host to end, closing any which remain once the context is done,
+// and then stops load balancing the host. A host which is returned to rotation while it is draining is kept, along
+// with its connections.
+func (l *LoadBalancer) drain(ctx context.Context, host *upstream.TcpHost) {
+	logger := l.hostLogger(host)
+	logger.Info("Draining upstream host")
+	forced := 0
+	for {
+		forced += l.sessions.await(ctx, func(s *session) bool { return s.Host == host && l.Draining(host) })
+		removed, pending := l.removeDrained(host)
+		if pending {
+			// A connection to the host was dialed before it started draining, and connected since.
+			continue
+		}
+		if !removed {
+			logger.Info("Upstream host was returned to rotation while draining")
+			return
+		}
+		logger.Info("Drained upstream host", "closed_connections", forced)
+		return
+	}
+}
+
+// removeDrained removes the host from the hosts list if it is still draining and has no sessions, and reports whether
+// it was removed, and whether it was kept because sessions remain.
+func (l *LoadBalancer) removeDrained(host *upstream.TcpHost) (removed, pending bool) {
+	l.hostMu.Lock()
+	defer l.hostMu.Unlock()
+
+	if !l.draining[host] {
+		return false, false
+	}
+	// Sessions which are tracked once the host is removed are closed by startSession.
+	if len(l.sessions.find(func(s *session) bool { return s.Host == host })) > 0 {
+		return false, true
+	}
+	delete(l.draining, host)
+	for i, h := range l.hosts {
+		if h == host {
+			l.hosts = append(l.hosts[:i], l.hosts[i+1:]...)
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// removeHost removes the host with the given ID from the hosts list, returning the host if it was present.
+func (l *LoadBalancer) removeHost(id uuid.UUID) (*upstream.TcpHost, bool) {
+	l.hostMu.Lock()
+	defer l.hostMu.Unlock()
+
+	for i, h := range l.hosts {
+		if h.ID() == id {
+			l.hosts = append(l.hosts[:i], l.hosts[i+1:]...)
+			delete(l.draining, h)
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// canceledContext returns a context which is already done, so that sessions are closed without waiting.
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+// logHealthChange logs when a host transitions between healthy and unhealthy.
+func (l *LoadBalancer) logHealthChange(host *upstream.TcpHost, healthy bool) {
+	if healthy {
+		l.hostLogger(host).Info("Upstream host is healthy")
+		return
+	}
+	l.hostLogger(host).Warn("Upstream host is unhealthy")
+}
+
 // New initializes a new LoadBalancer and begins listening for connections.
 // Pass :0" as the address to have the load balancer listen on a random port.
-func New(tcpNetwork, address string, hostTimeout time.Duration) (*LoadBalancer, error) {
+// Options such as WithMutualTLS are applied before the load balancer is returned.
+func New(tcpNetwork, address string, hostTimeout time.Duration, opts ...Option) (*LoadBalancer, error) {
 	a, err := net.ResolveTCPAddr(tcpNetwork, address)
 	if err != nil {
 		return nil, fmt.Errorf("unable to resolve TCP address: %s", err)
@@ -62,10 +441,23 @@ func New(tcpNetwork, address string, hostTimeout time.Duration) (*LoadBalancer,
 		return nil, fmt.Errorf("unable to listen on %s: %s", a.String(), err)
 	}
 
-	// TODO: Load TLS config as part of New LB setup in the PR that handles mTLS requirement.
+	l := &LoadBalancer{
+		listener:         ln,
+		network:          tcpNetwork,
+		acceptPolicy:     DefaultAcceptPolicy,
+		hostTimeout:      hostTimeout,
+		handshakeTimeout: DefaultHandshakeTimeout,
+		identitySource:   identity.SourceCommonName,
+		retryPolicy:      DefaultRetryPolicy,
+		balancer:         balancer.LeastConnections{},
+	}
+	l.lifetime, l.endLifetime = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.name != "" {
+		l.log = l.log.With("frontend", l.name)
+	}
 
-	return &LoadBalancer{
-		listener:    ln,
-		hostTimeout: hostTimeout,
-	}, nil
+	return l, nil
 }
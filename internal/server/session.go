@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+// Session describes a client connection which is being forwarded to an upstream host.
+type Session struct {
+	// ID uniquely identifies the connection of the session within the load balancer.
+	ID uint64
+
+	// Client is the identity of the client.
+	Client identity.ClientIdentity
+
+	// Host is the upstream host the client is connected to.
+	Host *upstream.TcpHost
+
+	// Started is when the connection to the host was established.
+	Started time.Time
+}
+
+// session is a tracked Session, along with the connections needed to close it.
+type session struct {
+	Session
+
+	// clientConn and hostConn are the connections data is forwarded between.
+	clientConn net.Conn
+	hostConn   net.Conn
+
+	// forced is set when the session was closed by the load balancer rather than by either end.
+	forced uint32
+
+	// done is closed once the session has ended.
+	done chan struct{}
+}
+
+// forceClose interrupts the session by expiring the deadlines of both connections, so that forwarding stops and
+// the connections are closed as they would be at the end of any session.
+func (s *session) forceClose() {
+	atomic.StoreUint32(&s.forced, 1)
+	now := time.Now()
+	s.clientConn.SetDeadline(now)
+	s.hostConn.SetDeadline(now)
+}
+
+// wasForced reports whether the session was closed by the load balancer.
+func (s *session) wasForced() bool {
+	return atomic.LoadUint32(&s.forced) == 1
+}
+
+// sessionRegistry tracks the sessions of a load balancer, so that they can be listed, and closed when a host is
+// drained or the load balancer shuts down. The zero value is ready to use.
+type sessionRegistry struct {
+	// lastID is the most recently assigned connection ID.
+	lastID uint64
+
+	// sessions are the sessions which have not ended.
+	sessions map[*session]struct{}
+
+	// mu protects sessions from concurrent access.
+	mu sync.Mutex
+}
+
+// newID assigns an ID to a connection, which identifies its session if it is forwarded.
+func (r *sessionRegistry) newID() uint64 {
+	return atomic.AddUint64(&r.lastID, 1)
+}
+
+// track registers a new session for the connection with the given ID, which must be passed to untrack once it ends.
+func (r *sessionRegistry) track(id uint64, client identity.ClientIdentity, host *upstream.TcpHost, clientConn, hostConn net.Conn) *session {
+	s := &session{
+		Session: Session{
+			ID:      id,
+			Client:  client,
+			Host:    host,
+			Started: time.Now(),
+		},
+		clientConn: clientConn,
+		hostConn:   hostConn,
+		done:       make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions == nil {
+		r.sessions = make(map[*session]struct{})
+	}
+	r.sessions[s] = struct{}{}
+	return s
+}
+
+// untrack removes a session which has ended, and notifies anything waiting for it.
+func (r *sessionRegistry) untrack(s *session) {
+	r.mu.Lock()
+	delete(r.sessions, s)
+	r.mu.Unlock()
+	close(s.done)
+}
+
+// find returns the sessions for which match returns true, in the order they started. Match is called without
+// holding mu, so that it may take the locks of the load balancer.
+func (r *sessionRegistry) find(match func(*session) bool) []*session {
+	r.mu.Lock()
+	all := make([]*session, 0, len(r.sessions))
+	for s := range r.sessions {
+		all = append(all, s)
+	}
+	r.mu.Unlock()
+
+	var found []*session
+	for _, s := range all {
+		if match(s) {
+			found = append(found, s)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found
+}
+
+// await waits for every session for which match returns true to end. If the context is done first, the remaining
+// sessions are force closed. Sessions which start while waiting are also waited for.
+// It returns the number of sessions which were force closed.
+func (r *sessionRegistry) await(ctx context.Context, match func(*session) bool) int {
+	forced := 0
+	for {
+		pending := r.find(match)
+		if len(pending) == 0 {
+			return forced
+		}
+
+		if ctx.Err() != nil {
+			for _, s := range pending {
+				s.forceClose()
+			}
+			for _, s := range pending {
+				<-s.done
+			}
+			forced += len(pending)
+			continue
+		}
+
+		select {
+		case <-pending[0].done:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// startSession tracks the session of a connection which was forwarded to the host, and closes it straight away if
+// the load balancer is shutting down or the host was removed while it was being dialed. Shutdown, RemoveUpstream and
+// DrainUpstream only close the sessions which are tracked, so such a session would otherwise be missed. A session
+// with a host which started draining is existing work, and is left for draining to wait for.
+func (l *LoadBalancer) startSession(id uint64, client identity.ClientIdentity, host *upstream.TcpHost, clientConn, hostConn net.Conn) *session {
+	s := l.sessions.track(id, client, host, clientConn, hostConn)
+	if l.context().Err() != nil || !l.balances(host) {
+		s.forceClose()
+	}
+	return s
+}
+
+// balances reports whether the host is in the hosts list, including while it is draining.
+func (l *LoadBalancer) balances(host *upstream.TcpHost) bool {
+	l.hostMu.RLock()
+	defer l.hostMu.RUnlock()
+	for _, h := range l.hosts {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// Sessions returns the sessions which are currently being forwarded, in the order they started.
+func (l *LoadBalancer) Sessions() []Session {
+	found := l.sessions.find(func(*session) bool { return true })
+	sessions := make([]Session, len(found))
+	for i, s := range found {
+		sessions[i] = s.Session
+	}
+	return sessions
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestLoadBalancer_startSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		leave      func(l *LoadBalancer, host *upstream.TcpHost)
+		wantForced bool
+	}{
+		{
+			name:       "host in rotation",
+			leave:      func(l *LoadBalancer, host *upstream.TcpHost) {},
+			wantForced: false,
+		},
+		{
+			name: "host started draining while it was dialed",
+			leave: func(l *LoadBalancer, host *upstream.TcpHost) {
+				l.markDraining(host)
+			},
+			wantForced: false,
+		},
+		{
+			name: "host was removed while it was dialed",
+			leave: func(l *LoadBalancer, host *upstream.TcpHost) {
+				l.removeHost(host.ID())
+			},
+			wantForced: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := upstream.New("127.0.0.1:9000", "tcp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := &LoadBalancer{hosts: []*upstream.TcpHost{host}}
+			tt.leave(l, host)
+
+			clientConn, _ := net.Pipe()
+			defer clientConn.Close()
+			hostConn, _ := net.Pipe()
+			defer hostConn.Close()
+
+			s := l.startSession(l.sessions.newID(), identity.ClientIdentity{}, host, clientConn, hostConn)
+			defer l.sessions.untrack(s)
+			if s.wasForced() != tt.wantForced {
+				t.Errorf("session was force closed = %v, want %v", s.wasForced(), tt.wantForced)
+			}
+			if len(l.Sessions()) != 1 {
+				t.Errorf("got %d sessions, want the session to be tracked", len(l.Sessions()))
+			}
+		})
+	}
+}
+
+func TestLoadBalancer_drain_SessionStartedWhileDraining(t *testing.T) {
+	host, err := upstream.New("127.0.0.1:9000", "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &LoadBalancer{hosts: []*upstream.TcpHost{host}}
+	l.hostMu.Lock()
+	l.markDraining(host)
+	l.hostMu.Unlock()
+
+	clientConn, _ := net.Pipe()
+	defer clientConn.Close()
+	hostConn, _ := net.Pipe()
+	defer hostConn.Close()
+
+	// The connection was dialed before the host started draining, and connects once it has.
+	s := l.startSession(l.sessions.newID(), identity.ClientIdentity{}, host, clientConn, hostConn)
+	if s.wasForced() {
+		t.Fatal("session with a draining host was force closed as it started")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan struct{})
+	go func() {
+		l.drain(ctx, host)
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		t.Fatal("drain returned while a session with the host remained")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// Once the drain deadline passes, the session is closed, and the host is removed once it ends.
+	go func() {
+		for !s.wasForced() {
+			time.Sleep(time.Millisecond)
+		}
+		l.sessions.untrack(s)
+	}()
+	cancel()
+	select {
+	case <-drained:
+	case <-time.After(time.Second * 5):
+		t.Fatal("drain did not return after its deadline passed")
+	}
+	if l.balances(host) {
+		t.Error("drained host is still load balanced")
+	}
+}
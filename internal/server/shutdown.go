@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrServerClosed = errors.New("load balancer is shut down")
+
+// Shutdown stops the load balancer from accepting connections, and waits for connections which are being handled
+// to end. If the context is done first, connections which are still being forwarded are closed, and dials and TLS
+// handshakes in progress are abandoned. Shutdown returns once every connection has been closed, along with the
+// context's error if connections had to be closed.
+func (l *LoadBalancer) Shutdown(ctx context.Context) error {
+	l.lifecycleMu.Lock()
+	l.shutdown = true
+	l.lifecycleMu.Unlock()
+	l.closeListener()
+
+	finished := make(chan struct{})
+	go func() {
+		l.workers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	// Once the lifetime ends, sessions which start from now on are closed as soon as they are tracked.
+	if l.endLifetime != nil {
+		l.endLifetime()
+	}
+	forced := l.sessions.await(canceledContext(), func(*session) bool { return true })
+	<-finished
+
+	l.log.Warn("Closed connections which outlived the shutdown deadline", "closed_connections", forced)
+	return ctx.Err()
+}
+
+// startWork registers a goroutine which handles a connection, so that Shutdown waits for it. It returns false once
+// the load balancer is shut down, in which case the connection should be closed instead. Every successful call
+// must be followed by a call to workers.Done.
+func (l *LoadBalancer) startWork() bool {
+	l.lifecycleMu.Lock()
+	defer l.lifecycleMu.Unlock()
+	if l.shutdown {
+		return false
+	}
+	l.workers.Add(1)
+	return true
+}
+
+// closeListener closes the listener once, which interrupts Run.
+func (l *LoadBalancer) closeListener() {
+	l.listenerMu.Lock()
+	defer l.listenerMu.Unlock()
+	if l.listenerClosed || l.listener == nil {
+		return
+	}
+	l.listenerClosed = true
+	l.listener.Close()
+}
+
+// context returns a context which is done once the load balancer has shut down and is closing connections.
+func (l *LoadBalancer) context() context.Context {
+	if l.lifetime == nil {
+		return context.Background()
+	}
+	return l.lifetime
+}
@@ -0,0 +1,204 @@
+package server_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+	"tcp-load-balancer/test"
+)
+
+func TestLoadBalancer_Run_ContextDone(t *testing.T) {
+	l, _ := newLoadBalancerWithHosts(t, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan error, 1)
+	go func() {
+		ran <- l.Run(ctx)
+	}()
+
+	cancel()
+	select {
+	case err := <-ran:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Run() did not return after its context was done")
+	}
+
+	if _, err := net.Dial("tcp", l.Address().String()); err == nil {
+		t.Error("load balancer still accepts connections after Run() returned")
+	}
+}
+
+func TestLoadBalancer_Shutdown(t *testing.T) {
+	t.Run("open connections finish before shutdown completes", func(t *testing.T) {
+		l, _ := newLoadBalancerWithHosts(t, 1)
+		ran := runLoadBalancer(l)
+
+		conn, err := net.Dial("tcp", l.Address().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if !eventually(time.Second*5, func() bool { return len(l.Sessions()) == 1 }) {
+			t.Fatal("connection was not forwarded to a host")
+		}
+
+		shutdown := make(chan error, 1)
+		go func() {
+			shutdown <- l.Shutdown(context.Background())
+		}()
+
+		select {
+		case err := <-ran:
+			if !errors.Is(err, server.ErrServerClosed) {
+				t.Errorf("Run() error = %v, want %v", err, server.ErrServerClosed)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("Run() did not return after Shutdown()")
+		}
+
+		// The open connection is still forwarded while the load balancer shuts down.
+		if response := writeAndReadResponse(t, conn, "in flight"); !strings.Contains(response, "in flight") {
+			t.Errorf("response %q did not contain original payload", response)
+		}
+
+		select {
+		case err := <-shutdown:
+			if err != nil {
+				t.Errorf("Shutdown() error = %v, want nil", err)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("Shutdown() did not return after the open connection finished")
+		}
+	})
+
+	t.Run("connections are closed once the deadline passes", func(t *testing.T) {
+		l, _ := newLoadBalancerWithHosts(t, 1)
+		runLoadBalancer(l)
+
+		conn, err := net.Dial("tcp", l.Address().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if !eventually(time.Second*5, func() bool { return len(l.Sessions()) == 1 }) {
+			t.Fatal("connection was not forwarded to a host")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		if err := l.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if !closedByPeer(conn) {
+			t.Error("connection which outlived the deadline was not closed")
+		}
+	})
+
+	t.Run("connections handled after shutdown are closed", func(t *testing.T) {
+		l, _ := newLoadBalancerWithHosts(t, 1)
+		if err := l.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		clientConn, serverConn := net.Pipe()
+		if err := l.HandleConnection(serverConn, identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1)})); !errors.Is(err, server.ErrServerClosed) {
+			t.Errorf("HandleConnection() error = %v, want %v", err, server.ErrServerClosed)
+		}
+		if !connectionIsClosed(clientConn) {
+			t.Error("connection handled after shutdown was not closed")
+		}
+	})
+}
+
+func TestLoadBalancer_Shutdown_NoGoroutineLeaks(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	pki, err := test.NewPKI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := test.InitializeHost("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, err := upstream.New(h.Addr().String(), "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := server.New("tcp", "127.0.0.1:0", time.Second, server.WithMutualTLS(pki.ServerCertificate, pki.ClientCA.Pool()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.AddUpstream(host)
+	runLoadBalancer(l)
+
+	clientConfig, err := pki.ClientTLSConfig("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Finished connections, a connection left open, and a connection stuck in its handshake are all cleaned up.
+	for i := 0; i < 3; i++ {
+		if _, err := sendOverTLS(l.Address().String(), clientConfig, "payload"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	openConn, err := tls.Dial("tcp", l.Address().String(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer openConn.Close()
+	if _, err := openConn.Write([]byte("open")); err != nil {
+		t.Fatal(err)
+	}
+	stalled, err := net.Dial("tcp", l.Address().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	if !eventually(time.Second*5, func() bool { return len(l.Sessions()) == 1 }) {
+		t.Fatal("open connection was not forwarded to a host")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	_ = l.Shutdown(ctx)
+	h.Close()
+
+	if !eventually(time.Second*5, func() bool { return runtime.NumGoroutine() <= before }) {
+		buf := make([]byte, 1<<16)
+		t.Errorf("%d goroutines are running after shutdown, want at most %d:\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+// closedByPeer reports whether the other end of a TCP connection closed it. Unlike connectionIsClosed, it reads rather
+// than writes, since a write to a TCP connection closed by its peer only fails after the peer has reset it.
+func closedByPeer(conn net.Conn) bool {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second * 5)); err != nil {
+		return false
+	}
+	_, err := conn.Read(make([]byte, 1))
+	return errors.Is(err, io.EOF)
+}
+
+// runLoadBalancer runs the load balancer on a new goroutine, and returns a channel which receives the result of Run.
+func runLoadBalancer(l *server.LoadBalancer) <-chan error {
+	ran := make(chan error, 1)
+	go func() {
+		ran <- l.Run(context.Background())
+	}()
+	return ran
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+)
+
+// ForwardErrorCause classifies why forwarding data between a client and a host failed.
+type ForwardErrorCause int
+
+const (
+	// CauseHostClosed is a host which closed its connection before the client did.
+	CauseHostClosed ForwardErrorCause = iota
+
+	// CauseTimeout is a read or write which exceeded its deadline.
+	CauseTimeout
+
+	// CauseReset is a connection which was reset or broken by its peer.
+	CauseReset
+
+	// CauseOther is any other error.
+	CauseOther
+)
+
+// ForwardErrorCauses lists every ForwardErrorCause.
+var ForwardErrorCauses = []ForwardErrorCause{CauseHostClosed, CauseTimeout, CauseReset, CauseOther}
+
+// String returns the name of the cause, such as "host_closed".
+func (c ForwardErrorCause) String() string {
+	switch c {
+	case CauseHostClosed:
+		return "host_closed"
+	case CauseTimeout:
+		return "timeout"
+	case CauseReset:
+		return "reset"
+	default:
+		return "other"
+	}
+}
+
+// ForwardErrorCauseOf classifies an error returned by ForwardData.
+func ForwardErrorCauseOf(err error) ForwardErrorCause {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrHostClosed):
+		return CauseHostClosed
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return CauseTimeout
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return CauseReset
+	default:
+		return CauseOther
+	}
+}
+
+// stats counts what happened to the connections of a load balancer. Its fields are updated atomically.
+type stats struct {
+	// accepted counts connections accepted by the listener.
+	accepted uint64
+
+	// unroutable counts connections closed because no host could be selected for the client.
+	unroutable uint64
+
+	// dialFailures counts connections closed because no host accepted a connection for the client.
+	dialFailures uint64
+
+	// bytesFromClients and bytesToClients count the data forwarded in each direction.
+	bytesFromClients uint64
+	bytesToClients   uint64
+
+	// forwardErrors counts the errors forwarding data, indexed by ForwardErrorCause.
+	forwardErrors [CauseOther + 1]uint64
+}
+
+// AcceptedConnections returns the number of connections accepted by the listener.
+func (l *LoadBalancer) AcceptedConnections() uint64 {
+	return atomic.LoadUint64(&l.stats.accepted)
+}
+
+// UnroutableConnections returns the number of connections which were closed because no host could be selected
+// for the client, such as when no host is healthy or the policy allows none.
+func (l *LoadBalancer) UnroutableConnections() uint64 {
+	return atomic.LoadUint64(&l.stats.unroutable)
+}
+
+// DialFailures returns the number of connections which were closed because no host accepted a connection for them.
+func (l *LoadBalancer) DialFailures() uint64 {
+	return atomic.LoadUint64(&l.stats.dialFailures)
+}
+
+// BytesFromClients returns the number of bytes read from clients and forwarded to hosts. The bytes of a connection
+// are counted once it ends.
+func (l *LoadBalancer) BytesFromClients() uint64 {
+	return atomic.LoadUint64(&l.stats.bytesFromClients)
+}
+
+// BytesToClients returns the number of bytes forwarded from hosts and written to clients. The bytes of a connection
+// are counted once it ends.
+func (l *LoadBalancer) BytesToClients() uint64 {
+	return atomic.LoadUint64(&l.stats.bytesToClients)
+}
+
+// ForwardErrors returns the number of connections whose forwarding failed for the cause.
+func (l *LoadBalancer) ForwardErrors(cause ForwardErrorCause) uint64 {
+	return atomic.LoadUint64(&l.stats.forwardErrors[cause])
+}
+
+// recordForwardError counts the error returned by ForwardData.
+func (l *LoadBalancer) recordForwardError(err error) {
+	atomic.AddUint64(&l.stats.forwardErrors[ForwardErrorCauseOf(err)], 1)
+}
+
+// recordBytes counts the bytes forwarded over a connection which ended.
+func (l *LoadBalancer) recordBytes(in, out uint64) {
+	atomic.AddUint64(&l.stats.bytesFromClients, in)
+	atomic.AddUint64(&l.stats.bytesToClients, out)
+}
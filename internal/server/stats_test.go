@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// timeoutError is a net.Error which timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestForwardErrorCauseOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ForwardErrorCause
+	}{
+		{name: "host closed", err: ErrHostClosed, want: CauseHostClosed},
+		{name: "timeout", err: &net.OpError{Op: "read", Err: timeoutError{}}, want: CauseTimeout},
+		{name: "reset", err: &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, want: CauseReset},
+		{name: "broken pipe", err: fmt.Errorf("copy: %w", syscall.EPIPE), want: CauseReset},
+		{name: "other", err: errors.New("unexpected"), want: CauseOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ForwardErrorCauseOf(tt.err); got != tt.want {
+				t.Errorf("ForwardErrorCauseOf(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_forward(t *testing.T) {
+	lbSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	hostSide, remoteHost := net.Pipe()
+
+	go func() {
+		// The host answers the request, and then closes its connection before the client.
+		buf := make([]byte, 16)
+		n, _ := remoteHost.Read(buf)
+		remoteHost.Write([]byte("response to " + string(buf[:n])))
+		remoteHost.Close()
+	}()
+	go func() {
+		clientSide.Write([]byte("request"))
+		clientSide.Read(make([]byte, 32))
+	}()
+
+	bytesIn, bytesOut, err := forward(lbSide, hostSide)
+	if !errors.Is(err, ErrHostClosed) {
+		t.Errorf("forward() error = %v, want %v", err, ErrHostClosed)
+	}
+	if bytesIn != 7 || bytesOut != 19 {
+		t.Errorf("forward() copied %d bytes from the client and %d to it, want 7 and 19", bytesIn, bytesOut)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+
+	"github.com/google/uuid"
+)
+
+// DefaultStickyMaxEntries bounds a StickyTable unless another size is given to NewStickyTable.
+const DefaultStickyMaxEntries = 10000
+
+// StickyEntry describes the host a client is pinned to.
+type StickyEntry struct {
+	// Client is the identity of the pinned client.
+	Client identity.ClientIdentity
+
+	// Host is the host the client was last sent to.
+	Host *upstream.TcpHost
+
+	// LastUsed is when the client was last sent to the host.
+	LastUsed time.Time
+
+	// ExpiresAt is when the entry expires unless the client connects again.
+	ExpiresAt time.Time
+}
+
+// StickyTable pins each client identity to the host it was last sent to, so that subsequent connections reuse
+// the host until the client has been idle for longer than the TTL. The table holds at most maxEntries clients,
+// and evicts the least recently used client when full.
+type StickyTable struct {
+	// ttl is how long a client stays pinned after its last connection.
+	ttl time.Duration
+
+	// maxEntries is the maximum number of pinned clients.
+	maxEntries int
+
+	// clock tells the time of connections, so that expiry can be tested.
+	clock clock.Clock
+
+	// entries indexes the elements of lru by client ID.
+	entries map[uuid.UUID]*list.Element
+
+	// lru holds a *StickyEntry per client, with the most recently used at the front.
+	lru *list.List
+
+	// mu protects entries and lru from concurrent access.
+	mu sync.Mutex
+}
+
+// NewStickyTable returns a StickyTable which pins clients for ttl after their last connection, and holds at most
+// maxEntries clients. A maxEntries of zero means DefaultStickyMaxEntries.
+func NewStickyTable(ttl time.Duration, maxEntries int, c clock.Clock) *StickyTable {
+	if maxEntries <= 0 {
+		maxEntries = DefaultStickyMaxEntries
+	}
+	return &StickyTable{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		clock:      c,
+		entries:    make(map[uuid.UUID]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// Lookup returns the host the client is pinned to, if the entry has not expired.
+func (s *StickyTable) Lookup(client identity.ClientIdentity) (*upstream.TcpHost, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[client.ID]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*StickyEntry)
+	if !s.clock.Now().Before(entry.ExpiresAt) {
+		s.remove(e)
+		return nil, false
+	}
+	return entry.Host, true
+}
+
+// Pin records that the client was sent to the host, renewing its TTL.
+func (s *StickyTable) Pin(client identity.ClientIdentity, host *upstream.TcpHost) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	if e, ok := s.entries[client.ID]; ok {
+		entry := e.Value.(*StickyEntry)
+		entry.Host, entry.LastUsed, entry.ExpiresAt = host, now, now.Add(s.ttl)
+		s.lru.MoveToFront(e)
+		return
+	}
+
+	s.entries[client.ID] = s.lru.PushFront(&StickyEntry{
+		Client:    client,
+		Host:      host,
+		LastUsed:  now,
+		ExpiresAt: now.Add(s.ttl),
+	})
+	for s.lru.Len() > s.maxEntries {
+		s.remove(s.lru.Back())
+	}
+}
+
+// Forget unpins the client.
+func (s *StickyTable) Forget(client identity.ClientIdentity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[client.ID]; ok {
+		s.remove(e)
+	}
+}
+
+// Entries returns the unexpired entries, most recently used first.
+func (s *StickyTable) Entries() []StickyEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	entries := make([]StickyEntry, 0, s.lru.Len())
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		if entry := e.Value.(*StickyEntry); now.Before(entry.ExpiresAt) {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
+
+// Len returns the number of entries, including expired entries which have not been removed yet.
+func (s *StickyTable) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// Clear unpins every client.
+func (s *StickyTable) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = make(map[uuid.UUID]*list.Element)
+	s.lru.Init()
+}
+
+// remove deletes the element from the table. The caller must hold mu.
+func (s *StickyTable) remove(e *list.Element) {
+	delete(s.entries, e.Value.(*StickyEntry).Client.ID)
+	s.lru.Remove(e)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/balancer"
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/identity"
+	"tcp-load-balancer/internal/upstream"
+)
+
+func TestStickyTable(t *testing.T) {
+	alice, bob, carol := newClient(1), newClient(2), newClient(3)
+	h0, h1 := &upstream.TcpHost{}, &upstream.TcpHost{}
+
+	t.Run("pinned host is returned until the ttl expires", func(t *testing.T) {
+		c := clock.NewFake(time.Unix(0, 0))
+		s := NewStickyTable(time.Minute, 0, c)
+		s.Pin(alice, h0)
+
+		c.Advance(time.Second * 59)
+		if got, ok := s.Lookup(alice); !ok || got != h0 {
+			t.Fatalf("Lookup() before the ttl = %v, %v, want the pinned host", got, ok)
+		}
+
+		c.Advance(time.Second)
+		if _, ok := s.Lookup(alice); ok {
+			t.Error("Lookup() returned a host after the ttl expired")
+		}
+		if s.Len() != 0 {
+			t.Errorf("Len() after an expired lookup = %d, want 0", s.Len())
+		}
+	})
+
+	t.Run("pinning again renews the ttl and replaces the host", func(t *testing.T) {
+		c := clock.NewFake(time.Unix(0, 0))
+		s := NewStickyTable(time.Minute, 0, c)
+		s.Pin(alice, h0)
+		c.Advance(time.Second * 45)
+		s.Pin(alice, h1)
+		c.Advance(time.Second * 45)
+
+		if got, ok := s.Lookup(alice); !ok || got != h1 {
+			t.Errorf("Lookup() = %v, %v, want the host pinned most recently", got, ok)
+		}
+	})
+
+	t.Run("least recently used client is evicted when full", func(t *testing.T) {
+		s := NewStickyTable(time.Minute, 2, clock.NewFake(time.Unix(0, 0)))
+		s.Pin(alice, h0)
+		s.Pin(bob, h0)
+		// Looking up alice makes bob the least recently used.
+		s.Lookup(alice)
+		s.Pin(alice, h0)
+		s.Pin(carol, h1)
+
+		if _, ok := s.Lookup(bob); ok {
+			t.Error("least recently used client was not evicted")
+		}
+		if _, ok := s.Lookup(alice); !ok {
+			t.Error("recently used client was evicted")
+		}
+		if s.Len() != 2 {
+			t.Errorf("Len() = %d, want 2", s.Len())
+		}
+	})
+
+	t.Run("entries are listed most recent first, without expired entries", func(t *testing.T) {
+		c := clock.NewFake(time.Unix(0, 0))
+		s := NewStickyTable(time.Minute, 0, c)
+		s.Pin(alice, h0)
+		c.Advance(time.Second * 30)
+		s.Pin(bob, h1)
+		s.Pin(carol, h0)
+		c.Advance(time.Second * 30)
+
+		entries := s.Entries()
+		if len(entries) != 2 {
+			t.Fatalf("Entries() returned %d entries, want 2", len(entries))
+		}
+		if entries[0].Client.ID != carol.ID || entries[1].Client.ID != bob.ID {
+			t.Errorf("Entries() = %s, %s, want carol then bob", entries[0].Client, entries[1].Client)
+		}
+		if entries[1].Host != h1 || !entries[1].ExpiresAt.Equal(time.Unix(90, 0)) {
+			t.Errorf("Entries()[1] = %+v, want host h1 expiring 60s after it was pinned", entries[1])
+		}
+	})
+
+	t.Run("clear and forget unpin clients", func(t *testing.T) {
+		s := NewStickyTable(time.Minute, 0, clock.NewFake(time.Unix(0, 0)))
+		s.Pin(alice, h0)
+		s.Pin(bob, h0)
+
+		s.Forget(alice)
+		if _, ok := s.Lookup(alice); ok {
+			t.Error("Lookup() returned a host after Forget()")
+		}
+
+		s.Clear()
+		if s.Len() != 0 || len(s.Entries()) != 0 {
+			t.Errorf("Len() after Clear() = %d, want 0", s.Len())
+		}
+	})
+}
+
+func TestLoadBalancer_SelectHost_StickySessions(t *testing.T) {
+	client := newClient(1)
+
+	newLoadBalancer := func() (*LoadBalancer, *upstream.TcpHost, *upstream.TcpHost) {
+		h0, h1 := &upstream.TcpHost{}, &upstream.TcpHost{}
+		return &LoadBalancer{
+			hosts:    []*upstream.TcpHost{h0, h1},
+			balancer: balancer.LeastConnections{},
+			sticky:   NewStickyTable(time.Minute, 0, clock.NewFake(time.Unix(0, 0))),
+		}, h0, h1
+	}
+
+	t.Run("client returns to its pinned host", func(t *testing.T) {
+		l, h0, _ := newLoadBalancer()
+		first := selectAndCount(t, l, client)
+		if first != h0 {
+			t.Fatal("first connection was not balanced to the least loaded host")
+		}
+
+		// The balancer would now pick h1, which has fewer connections.
+		if got := selectAndCount(t, l, client); got != h0 {
+			t.Error("second connection was not sent to the pinned host")
+		}
+	})
+
+	t.Run("client is re-balanced when its pinned host is unhealthy", func(t *testing.T) {
+		l, h0, h1 := newLoadBalancer()
+		selectAndCount(t, l, client)
+		h0.SetHealthy(false)
+
+		if got := selectAndCount(t, l, client); got != h1 {
+			t.Fatal("connection was sent to the unhealthy pinned host")
+		}
+		if got, _ := l.sticky.Lookup(client); got != h1 {
+			t.Error("sticky table was not updated with the new host")
+		}
+	})
+
+	t.Run("client is re-balanced when its pinned host is removed", func(t *testing.T) {
+		l, _, h1 := newLoadBalancer()
+		selectAndCount(t, l, client)
+		l.hosts = []*upstream.TcpHost{h1}
+
+		if got := selectAndCount(t, l, client); got != h1 {
+			t.Fatal("connection was sent to a host which is no longer load balanced")
+		}
+		if got, _ := l.sticky.Lookup(client); got != h1 {
+			t.Error("sticky table was not updated with the new host")
+		}
+	})
+
+	t.Run("excluded pinned host is not selected", func(t *testing.T) {
+		l, h0, h1 := newLoadBalancer()
+		selectAndCount(t, l, client)
+
+		got, err := l.SelectHost(client, h0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != h1 {
+			t.Error("SelectHost() returned the excluded pinned host")
+		}
+	})
+}
+
+// newClient returns a distinct client identified by its address.
+func newClient(n byte) identity.ClientIdentity {
+	return identity.FromAddr(&net.TCPAddr{IP: net.IPv4(10, 0, 0, n)})
+}
+
+// selectAndCount selects a host for the client and increments its connection count, as HandleConnection does.
+func selectAndCount(t *testing.T, l *LoadBalancer, client identity.ClientIdentity) *upstream.TcpHost {
+	h, err := l.SelectHost(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.IncrementActiveConnections()
+	return h
+}
@@ -0,0 +1,108 @@
+package upstream
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"tcp-load-balancer/internal/metrics"
+)
+
+// DefaultLatencyDecay is the time over which a latency observation loses most of its influence,
+// unless overridden with WithLatencyDecay.
+const DefaultLatencyDecay = time.Second * 10
+
+// ewma is a peak-sensitive, time-weighted moving average of latency. An observation above the average replaces it,
+// so a host which slows down is penalized immediately, while faster observations pull the average down gradually.
+// Without observations the average decays towards zero, so a host which stopped receiving connections because
+// it was slow is eventually tried again.
+type ewma struct {
+	// value is the average in nanoseconds as of stamp.
+	value float64
+
+	// stamp is when value was last updated. It is zero until the first observation.
+	stamp time.Time
+
+	// mu protects value and stamp from concurrent access.
+	mu sync.Mutex
+}
+
+// observe adds a latency observation made at now.
+func (e *ewma) observe(latency time.Duration, now time.Time, decay time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	observed := float64(latency)
+	if e.stamp.IsZero() || observed > e.value {
+		e.value = observed
+	} else {
+		w := e.weight(now, decay)
+		e.value = e.value*w + observed*(1-w)
+	}
+	e.stamp = now
+}
+
+// get returns the average as of now, decayed by the time since the last observation.
+func (e *ewma) get(now time.Time, decay time.Duration) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stamp.IsZero() {
+		return 0
+	}
+	return time.Duration(e.value * e.weight(now, decay))
+}
+
+// weight returns how much of the current value is retained at now.
+func (e *ewma) weight(now time.Time, decay time.Duration) float64 {
+	elapsed := now.Sub(e.stamp)
+	if elapsed <= 0 {
+		return 1
+	}
+	return math.Exp(-float64(elapsed) / float64(decay))
+}
+
+// ObserveDialLatency records how long it took to establish a connection to the host.
+// It is called by DialContext, so callers only need it when dialing the host some other way.
+func (h *TcpHost) ObserveDialLatency(latency time.Duration) {
+	h.dialLatency.observe(latency, h.now(), h.decay())
+	h.dialDurations.Observe(latency)
+}
+
+// DialLatency returns the moving average of the time taken to establish a connection to the host.
+// It is zero until the first connection is established.
+func (h *TcpHost) DialLatency() time.Duration {
+	return h.dialLatency.get(h.now(), h.decay())
+}
+
+// DialDurations returns the distribution of the time taken to establish connections to the host.
+func (h *TcpHost) DialDurations() metrics.HistogramSnapshot {
+	return h.dialDurations.Snapshot()
+}
+
+// ObserveFirstByteLatency records how long the host took to send its first byte after receiving data from a client.
+func (h *TcpHost) ObserveFirstByteLatency(latency time.Duration) {
+	h.firstByteLatency.observe(latency, h.now(), h.decay())
+}
+
+// FirstByteLatency returns the moving average of the time the host takes to send its first byte after receiving
+// data from a client. It is zero until the first observation.
+func (h *TcpHost) FirstByteLatency() time.Duration {
+	return h.firstByteLatency.get(h.now(), h.decay())
+}
+
+// now returns the current time of the host's clock.
+func (h *TcpHost) now() time.Time {
+	if h.clock == nil {
+		return time.Now()
+	}
+	return h.clock.Now()
+}
+
+// decay returns the time over which latency observations lose most of their influence.
+func (h *TcpHost) decay() time.Duration {
+	if h.latencyDecay <= 0 {
+		return DefaultLatencyDecay
+	}
+	return h.latencyDecay
+}
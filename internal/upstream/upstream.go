@@ -1,18 +1,48 @@
 package upstream
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"tcp-load-balancer/internal/clock"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/metrics"
 
 	"github.com/google/uuid"
 )
 
 var (
-	ErrNoAddress = errors.New("no upstream host address available")
+	ErrNoAddress      = errors.New("no upstream host address available")
+	ErrWeightTooLarge = fmt.Errorf("weight must be at most %d", MaxWeight)
 )
 
+// DefaultWeight is the weight of a host unless set with WithWeight or SetWeight.
+const DefaultWeight = 1
+
+// MaxWeight is the largest weight of a host. Balancers build tables in proportion to the weights of hosts, so weights
+// are bounded to bound the size of those tables.
+const MaxWeight = 1000
+
+// DefaultUnhealthyThreshold is the number of consecutive failures after which a host is marked unhealthy,
+// unless overridden with WithUnhealthyThreshold.
+const DefaultUnhealthyThreshold = 3
+
+// DefaultEjectionCooldown is how long a host marked unhealthy by passive failures is kept out of rotation before a
+// connection is sent to it to test whether it recovered, unless overridden with WithEjectionCooldown. Each failed test
+// doubles the cooldown, up to MaxEjectionCooldown.
+const DefaultEjectionCooldown = time.Second * 10
+
+// MaxEjectionCooldown bounds the cooldown of a host which keeps failing once it is offered connections again.
+const MaxEjectionCooldown = time.Minute * 5
+
+// HealthChangeHandler is called when a host transitions between healthy and unhealthy.
+type HealthChangeHandler func(host *TcpHost, healthy bool)
+
 // TcpHost represents the upstream hosts to which the LB connects and forwards data.
 type TcpHost struct {
 	// id is the unique identifier of this host.
@@ -24,8 +54,66 @@ type TcpHost struct {
 	// network is the network type of the TcpHost. One of "tcp", "tcp4", "tcp6"
 	network string
 
+	// pool is the name of the upstream pool this host belongs to, used by authorization policies.
+	pool string
+
+	// labels are arbitrary key-value attributes of the host, used by authorization policies.
+	labels map[string]string
+
+	// attributesMu protects pool and labels, which may change while the host is load balanced.
+	attributesMu sync.RWMutex
+
 	// activeConnections tracks the number of open connections to the host.
 	activeConnections uint64
+
+	// weight is the relative capacity of the host, used by weighted balancing strategies. Zero means DefaultWeight.
+	weight uint64
+
+	// consecutiveFailures counts failures since the last success.
+	consecutiveFailures uint64
+
+	// unhealthyThreshold is the number of consecutive failures after which the host is marked unhealthy.
+	// Zero means DefaultUnhealthyThreshold.
+	unhealthyThreshold uint64
+
+	// unhealthy is set while the host is unhealthy, so that the zero value of TcpHost is healthy.
+	unhealthy bool
+
+	// ejected is set while the host is unhealthy because of passive failures rather than SetHealthy, in which case
+	// it is offered a connection again once retryAt passes.
+	ejected bool
+
+	// retryAt is when an ejected host may next be offered a connection, and cooldown is the time until the one after.
+	retryAt  time.Time
+	cooldown time.Duration
+
+	// retrying is set while the outcome of a connection offered to an ejected host is awaited.
+	retrying bool
+
+	// ejectionCooldown is the first cooldown of an ejected host. Zero means DefaultEjectionCooldown.
+	ejectionCooldown time.Duration
+
+	// healthHandlers are notified of health transitions.
+	healthHandlers []HealthChangeHandler
+
+	// healthMu protects the health state and handlers from concurrent access.
+	healthMu sync.Mutex
+
+	// dialLatency and firstByteLatency are moving averages of the latency of the host, used by latency-aware balancing strategies.
+	dialLatency      ewma
+	firstByteLatency ewma
+
+	// dialDurations is the distribution of the time taken to establish connections to the host, for monitoring.
+	dialDurations metrics.Histogram
+
+	// latencyDecay is the time over which latency observations lose most of their influence. Zero means DefaultLatencyDecay.
+	latencyDecay time.Duration
+
+	// clock tells the time of latency observations. Nil means the system time.
+	clock clock.Clock
+
+	// log receives messages about the host. Nil means the default logger.
+	log *logging.Logger
 }
 
 // IncrementActiveConnections increments the active connection count for this host.
@@ -38,35 +126,308 @@ func (h *TcpHost) DecrementActiveConnections() {
 	atomic.AddUint64(&h.activeConnections, ^uint64(0))
 }
 
+// ID returns the unique identifier of this host.
+func (h *TcpHost) ID() uuid.UUID {
+	return h.id
+}
+
+// Logger returns the logger of the host, which adds the ID and address of the host to every message.
+func (h *TcpHost) Logger() *logging.Logger {
+	return h.log.With("host_id", h.id, "host", h.address)
+}
+
+// Pool returns the name of the upstream pool this host belongs to.
+func (h *TcpHost) Pool() string {
+	h.attributesMu.RLock()
+	defer h.attributesMu.RUnlock()
+	return h.pool
+}
+
+// SetPool moves the host to another upstream pool.
+func (h *TcpHost) SetPool(pool string) {
+	h.attributesMu.Lock()
+	defer h.attributesMu.Unlock()
+	h.pool = pool
+}
+
+// Labels returns the labels of this host. The returned map must not be modified.
+func (h *TcpHost) Labels() map[string]string {
+	h.attributesMu.RLock()
+	defer h.attributesMu.RUnlock()
+	return h.labels
+}
+
+// SetLabels replaces the labels of this host.
+func (h *TcpHost) SetLabels(labels map[string]string) {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		copied[k] = v
+	}
+
+	h.attributesMu.Lock()
+	defer h.attributesMu.Unlock()
+	h.labels = copied
+}
+
 // Address returns the address of the host.
 func (h *TcpHost) Address() *net.TCPAddr {
 	return h.address
 }
 
+// Weight returns the relative capacity of the host. It is always at least 1.
+func (h *TcpHost) Weight() uint64 {
+	if w := atomic.LoadUint64(&h.weight); w > 0 {
+		return w
+	}
+	return DefaultWeight
+}
+
+// SetWeight changes the relative capacity of the host. It takes effect for the next connection, and a weight of zero resets it to DefaultWeight.
+// A weight above MaxWeight is rejected with ErrWeightTooLarge.
+func (h *TcpHost) SetWeight(weight uint64) error {
+	if weight > MaxWeight {
+		return ErrWeightTooLarge
+	}
+	atomic.StoreUint64(&h.weight, weight)
+	return nil
+}
+
+// Network returns the network type of the host. One of "tcp", "tcp4", "tcp6"
+func (h *TcpHost) Network() string {
+	return h.network
+}
+
 // ConnectionCount returns the number of active connections to this host.
 func (h *TcpHost) ConnectionCount() uint64 {
 	return atomic.LoadUint64(&h.activeConnections)
 }
 
+// Healthy reports whether the host should receive new connections.
+func (h *TcpHost) Healthy() bool {
+	h.healthMu.Lock()
+	defer h.healthMu.Unlock()
+	return !h.unhealthy
+}
+
+// ConsecutiveFailures returns the number of failures recorded since the last success.
+func (h *TcpHost) ConsecutiveFailures() uint64 {
+	h.healthMu.Lock()
+	defer h.healthMu.Unlock()
+	return h.consecutiveFailures
+}
+
+// OnHealthChange registers a handler which is called whenever the host transitions between healthy and unhealthy.
+// Handlers are called synchronously, in registration order, and must not block.
+func (h *TcpHost) OnHealthChange(handler HealthChangeHandler) {
+	h.healthMu.Lock()
+	defer h.healthMu.Unlock()
+	h.healthHandlers = append(h.healthHandlers, handler)
+}
+
+// RecordSuccess resets the consecutive failure count and marks the host healthy.
+func (h *TcpHost) RecordSuccess() {
+	h.setHealth(true, true)
+}
+
+// RecordFailure increments the consecutive failure count, and marks the host unhealthy once the threshold is reached.
+func (h *TcpHost) RecordFailure() {
+	h.setHealth(false, false)
+}
+
+// SetHealthy marks the host healthy or unhealthy regardless of its failure count, which is reset.
+// It is used by components with their own view of host health, such as active health checks, so a host marked
+// unhealthy this way is not offered connections again until it is marked healthy.
+func (h *TcpHost) SetHealthy(healthy bool) {
+	h.setHealth(healthy, true)
+}
+
+// setHealth records an outcome and notifies handlers if the health of the host changed.
+// When force is false, a failure only marks the host unhealthy once the threshold is reached.
+func (h *TcpHost) setHealth(healthy bool, force bool) {
+	h.healthMu.Lock()
+
+	wasHealthy := !h.unhealthy
+	switch {
+	case healthy:
+		h.consecutiveFailures = 0
+		h.unhealthy = false
+		h.ejected = false
+		h.retrying = false
+	case force:
+		h.consecutiveFailures = 0
+		h.unhealthy = true
+		h.ejected = false
+		h.retrying = false
+	case h.ejected && h.retrying:
+		// The connection offered to the ejected host failed, so it waits twice as long for the next one.
+		h.retrying = false
+		h.cooldown *= 2
+		if h.cooldown > MaxEjectionCooldown {
+			h.cooldown = MaxEjectionCooldown
+		}
+		h.retryAt = h.now().Add(h.cooldown)
+	default:
+		h.consecutiveFailures++
+		threshold := h.unhealthyThreshold
+		if threshold == 0 {
+			threshold = DefaultUnhealthyThreshold
+		}
+		if h.consecutiveFailures >= threshold && !h.unhealthy {
+			h.unhealthy = true
+			h.ejected = true
+			h.cooldown = h.ejectionCooldown
+			if h.cooldown <= 0 {
+				h.cooldown = DefaultEjectionCooldown
+			}
+			h.retryAt = h.now().Add(h.cooldown)
+		}
+	}
+
+	isHealthy := !h.unhealthy
+	handlers := h.healthHandlers
+	h.healthMu.Unlock()
+
+	if wasHealthy != isHealthy {
+		for _, handler := range handlers {
+			handler(h, isHealthy)
+		}
+	}
+}
+
+// ClaimRetry reports whether the host was marked unhealthy by passive failures and its cooldown has passed, in which
+// case the caller should offer it a connection to test whether it recovered. The outcome of that connection, recorded
+// with RecordSuccess or RecordFailure, returns the host to rotation or doubles its cooldown. Only one caller claims
+// each retry, and the host is offered again after another cooldown if no outcome is recorded.
+func (h *TcpHost) ClaimRetry() bool {
+	h.healthMu.Lock()
+	defer h.healthMu.Unlock()
+
+	now := h.now()
+	if !h.ejected || now.Before(h.retryAt) {
+		return false
+	}
+	h.retrying = true
+	h.retryAt = now.Add(h.cooldown)
+	return true
+}
+
 // Dial returns a net connection to the tcp host.
 func (h *TcpHost) Dial() (net.Conn, error) {
+	return h.DialContext(context.Background())
+}
+
+// DialContext returns a net connection to the tcp host, giving up when the context is done.
+// The time taken by a successful dial is added to the dial latency of the host.
+// A failed dial is recorded as a failure of the host. A successful dial is not recorded as a success on its own,
+// since a host which accepts connections and then immediately closes them is not healthy; the caller should
+// record the outcome once the connection has been used.
+func (h *TcpHost) DialContext(ctx context.Context) (net.Conn, error) {
 	if h.Address() == nil {
 		return nil, ErrNoAddress
 	}
 
-	return net.Dial(h.network, h.Address().String())
+	start := h.now()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, h.network, h.Address().String())
+	if err != nil {
+		if ctx.Err() == nil {
+			// Dials abandoned because the context was cancelled say nothing about the health of the host.
+			h.RecordFailure()
+		}
+		h.Logger().Debug("Unable to dial upstream host", "error", err)
+		return nil, err
+	}
+
+	h.ObserveDialLatency(h.now().Sub(start))
+	return conn, nil
+}
+
+// Option configures optional attributes of a TcpHost during New.
+type Option func(*TcpHost)
+
+// WithID overrides the default host ID, which is derived from the network and address of the host.
+func WithID(id uuid.UUID) Option {
+	return func(h *TcpHost) {
+		h.id = id
+	}
+}
+
+// WithPool sets the name of the upstream pool this host belongs to.
+func WithPool(pool string) Option {
+	return func(h *TcpHost) {
+		h.pool = pool
+	}
+}
+
+// WithLabels sets the labels of this host.
+func WithLabels(labels map[string]string) Option {
+	return func(h *TcpHost) {
+		h.SetLabels(labels)
+	}
+}
+
+// WithWeight sets the relative capacity of the host. New returns ErrWeightTooLarge if it is above MaxWeight.
+func WithWeight(weight uint64) Option {
+	return func(h *TcpHost) {
+		h.weight = weight
+	}
+}
+
+// WithUnhealthyThreshold sets the number of consecutive failures after which the host is marked unhealthy.
+func WithUnhealthyThreshold(threshold uint64) Option {
+	return func(h *TcpHost) {
+		h.unhealthyThreshold = threshold
+	}
+}
+
+// WithEjectionCooldown sets how long a host marked unhealthy by passive failures waits before it is offered a
+// connection again.
+func WithEjectionCooldown(cooldown time.Duration) Option {
+	return func(h *TcpHost) {
+		h.ejectionCooldown = cooldown
+	}
+}
+
+// WithLatencyDecay sets the time over which latency observations lose most of their influence.
+func WithLatencyDecay(decay time.Duration) Option {
+	return func(h *TcpHost) {
+		h.latencyDecay = decay
+	}
+}
+
+// WithClock sets the clock used to time latency observations.
+func WithClock(c clock.Clock) Option {
+	return func(h *TcpHost) {
+		h.clock = c
+	}
+}
+
+// WithLogger sets the logger which receives messages about the host.
+func WithLogger(logger *logging.Logger) Option {
+	return func(h *TcpHost) {
+		h.log = logger
+	}
 }
 
 // New initializes a new TcpUpstreamHost.
-func New(address, network string) (*TcpHost, error) {
+// Unless overridden with WithID, the host ID is a V5 UUID of the network and resolved address, so it is stable across restarts.
+func New(address, network string, opts ...Option) (*TcpHost, error) {
 	a, err := net.ResolveTCPAddr(network, address)
 	if err != nil {
 		return nil, fmt.Errorf("unable to resolve TCP address: %s", err)
 	}
 
-	return &TcpHost{
+	h := &TcpHost{
+		id:      uuid.NewSHA1(uuid.NameSpaceURL, []byte(network+"://"+a.String())),
 		address: a,
 		network: network,
-		// TODO: Add hostIDs during PR with authorization scheme
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.weight > MaxWeight {
+		return nil, ErrWeightTooLarge
+	}
+
+	return h, nil
 }
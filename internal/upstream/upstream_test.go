@@ -1,7 +1,12 @@
 package upstream
 
 import (
+	"errors"
+	"reflect"
 	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/clock"
 )
 
 func TestTcpHost_DecrementActiveConnections(t *testing.T) {
@@ -30,3 +35,185 @@ func TestTcpHost_DecrementActiveConnections(t *testing.T) {
 		})
 	}
 }
+
+func TestNew_ID(t *testing.T) {
+	a, err := New("127.0.0.1:8000", "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New("127.0.0.1:8000", "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New("127.0.0.1:8001", "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.ID() != b.ID() {
+		t.Errorf("hosts with the same address have different IDs: %s != %s", a.ID(), b.ID())
+	}
+	if a.ID() == c.ID() {
+		t.Errorf("hosts with different addresses have the same ID: %s", a.ID())
+	}
+}
+
+func TestTcpHost_RecordFailure(t *testing.T) {
+	tests := []struct {
+		name        string
+		threshold   uint64
+		outcomes    []bool
+		wantHealthy bool
+		wantChanges []bool
+	}{
+		{
+			name:        "host is unhealthy after threshold consecutive failures",
+			threshold:   3,
+			outcomes:    []bool{false, false, false},
+			wantHealthy: false,
+			wantChanges: []bool{false},
+		},
+		{
+			name:        "success resets the consecutive failure count",
+			threshold:   3,
+			outcomes:    []bool{false, false, true, false, false},
+			wantHealthy: true,
+			wantChanges: nil,
+		},
+		{
+			name:        "success after ejection returns the host to health",
+			threshold:   2,
+			outcomes:    []bool{false, false, false, true},
+			wantHealthy: true,
+			wantChanges: []bool{false, true},
+		},
+		{
+			name:        "default threshold is used when none is set",
+			threshold:   0,
+			outcomes:    make([]bool, DefaultUnhealthyThreshold),
+			wantHealthy: false,
+			wantChanges: []bool{false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &TcpHost{unhealthyThreshold: tt.threshold}
+
+			var changes []bool
+			h.OnHealthChange(func(host *TcpHost, healthy bool) {
+				if host != h {
+					t.Error("handler was called with a different host")
+				}
+				changes = append(changes, healthy)
+			})
+
+			for _, success := range tt.outcomes {
+				if success {
+					h.RecordSuccess()
+				} else {
+					h.RecordFailure()
+				}
+			}
+
+			if h.Healthy() != tt.wantHealthy {
+				t.Errorf("TcpHost.Healthy() = %v, want %v", h.Healthy(), tt.wantHealthy)
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("health changes = %v, want %v", changes, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestTcpHost_ClaimRetry(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	h := &TcpHost{unhealthyThreshold: 1, ejectionCooldown: time.Second * 10, clock: c}
+
+	h.RecordFailure()
+	if h.Healthy() || h.ClaimRetry() {
+		t.Fatal("ejected host was offered a connection before its cooldown passed")
+	}
+
+	c.Advance(time.Second * 10)
+	if !h.ClaimRetry() {
+		t.Fatal("ejected host was not offered a connection once its cooldown passed")
+	}
+	if h.ClaimRetry() {
+		t.Fatal("the same retry was claimed twice")
+	}
+
+	// The connection offered to the host failed, so the next cooldown is twice as long.
+	h.RecordFailure()
+	c.Advance(time.Second * 10)
+	if h.ClaimRetry() {
+		t.Fatal("host which failed its retry was offered a connection before its doubled cooldown passed")
+	}
+	c.Advance(time.Second * 10)
+	if !h.ClaimRetry() {
+		t.Fatal("host was not offered a connection once its doubled cooldown passed")
+	}
+
+	h.RecordSuccess()
+	if !h.Healthy() || h.ClaimRetry() {
+		t.Error("host which succeeded its retry was not returned to rotation")
+	}
+
+	// A host marked unhealthy by an active health check waits for the check to mark it healthy again.
+	h.SetHealthy(false)
+	c.Advance(MaxEjectionCooldown)
+	if h.ClaimRetry() {
+		t.Error("host marked unhealthy with SetHealthy was offered a connection")
+	}
+}
+
+func TestTcpHost_SetWeight(t *testing.T) {
+	h := &TcpHost{}
+	if err := h.SetWeight(MaxWeight); err != nil {
+		t.Fatalf("SetWeight(%d) = %v, want no error", MaxWeight, err)
+	}
+	if err := h.SetWeight(MaxWeight + 1); !errors.Is(err, ErrWeightTooLarge) {
+		t.Fatalf("SetWeight(%d) = %v, want %v", MaxWeight+1, err, ErrWeightTooLarge)
+	}
+	if h.Weight() != MaxWeight {
+		t.Errorf("Weight() = %d after a rejected SetWeight, want %d", h.Weight(), MaxWeight)
+	}
+	if _, err := New("127.0.0.1:8000", "tcp", WithWeight(MaxWeight+1)); !errors.Is(err, ErrWeightTooLarge) {
+		t.Errorf("New() with weight %d = %v, want %v", MaxWeight+1, err, ErrWeightTooLarge)
+	}
+}
+
+func TestTcpHost_DialLatency(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	h, err := New("127.0.0.1:8000", "tcp", WithClock(c), WithLatencyDecay(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := h.DialLatency(); got != 0 {
+		t.Fatalf("DialLatency() before any observation = %v, want 0", got)
+	}
+
+	h.ObserveDialLatency(time.Millisecond * 100)
+	if got := h.DialLatency(); got != time.Millisecond*100 {
+		t.Errorf("DialLatency() after the first observation = %v, want 100ms", got)
+	}
+
+	h.ObserveDialLatency(time.Millisecond * 300)
+	if got := h.DialLatency(); got != time.Millisecond*300 {
+		t.Errorf("DialLatency() after a slower observation = %v, want the peak of 300ms", got)
+	}
+
+	// Half the decay time later, a faster observation pulls the average down gradually rather than replacing it.
+	c.Advance(time.Millisecond * 500)
+	h.ObserveDialLatency(time.Millisecond * 100)
+	if got := h.DialLatency(); got <= time.Millisecond*100 || got >= time.Millisecond*300 {
+		t.Errorf("DialLatency() after a faster observation = %v, want between 100ms and 300ms", got)
+	}
+
+	// Without observations the average decays, so a host which stopped receiving connections is tried again.
+	before := h.DialLatency()
+	c.Advance(time.Second * 5)
+	if got := h.DialLatency(); got >= before/100 {
+		t.Errorf("DialLatency() after 5 decay periods without observations = %v, want less than %v", got, before/100)
+	}
+}
@@ -1,29 +1,150 @@
 package main
 
 import (
+	"context"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"tcp-load-balancer/internal/admin"
 	"tcp-load-balancer/internal/config"
+	"tcp-load-balancer/internal/health"
+	"tcp-load-balancer/internal/logging"
 	"tcp-load-balancer/internal/server"
 	"tcp-load-balancer/test"
+
+	"github.com/google/uuid"
 )
 
 func main() {
-	// Initialize the load balancer.
-	lb, err := server.New(config.TCPNetwork, config.GetPort(), config.UpstreamHostTimeout)
+	flags, err := config.ParseFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := config.FromFlags(flags)
+	if flags.ConfigPath != "" {
+		if cfg, err = config.Load(flags.ConfigPath); err != nil {
+			log.Fatalf("invalid configuration:\n%s", err)
+		}
+	}
+	logger, err := newLogger(cfg)
+	if err != nil {
+		log.Fatalf("invalid configuration: %s", err)
+	}
+	// Messages of packages which are not given a logger are written to it as well.
+	logging.SetDefault(logger)
+	shared := newLimiters(cfg.Limits)
+
+	// The access log is closed once every frontend has shut down, after the last connection is recorded.
+	accessLog, accessLogFile, err := newAccessLog(cfg)
 	if err != nil {
-		log.Fatalf("unable to start tcp load balancer: %s", err)
+		fatal(logger, "Unable to start tcp load balancer", err)
+	}
+	defer accessLogFile.Close()
+
+	// The demo generates in-memory certificates for the first listener and the static clients, which replace any
+	// certificates in the configuration.
+	var pki *test.PKI
+	var demo []server.Option
+	if flags.Demo {
+		if pki, err = test.NewPKI(); err != nil {
+			fatal(logger, "Unable to generate certificates", err)
+		}
+		demo = append(demo, server.WithMutualTLS(pki.ServerCertificate, pki.ClientCA.Pool()))
 	}
 
-	log.Printf("Load balancer listening on %s", lb.Address())
+	// Start a frontend for each listener, which load balances the hosts of its pool with the policy, limits and
+	// retries of the configuration.
+	var frontends server.Frontends
+	listed := make(map[string]map[uuid.UUID]bool)
+	for i, listener := range cfg.Listeners {
+		extra := []server.Option{server.WithAccessLog(accessLog), server.WithLogger(logger)}
+		if i == 0 {
+			extra = append(extra, demo...)
+		}
+		lb, err := newFrontend(cfg, listener, shared, extra...)
+		if err != nil {
+			fatal(logger, "Unable to start tcp load balancer", err)
+		}
+		listed[listener.Name] = hostIDs(lb.Hosts())
+
+		if flags.Demo && i == 0 {
+			clientTLSConfig, err := pki.ClientTLSConfig("static-client")
+			if err != nil {
+				fatal(logger, "Unable to generate client certificate", err)
+			}
+
+			// Manually configure upstream hosts and downstream clients to demonstrate functionality. The demo hosts
+			// are not in the configuration, and are kept when the configuration is reloaded.
+			if err = test.Setup(lb, clientTLSConfig, config.NumberOfHosts, config.NumberOfClients, config.ClientMessageInterval); err != nil {
+				fatal(logger, "Unable to setup static connection simulators", err)
+			}
+		}
 
-	// Manually configure upstream hosts and downstream clients to demonstrate functionality.
-	if err = test.Setup(lb, config.NumberOfHosts, config.NumberOfClients, config.ClientMessageInterval); err != nil {
-		log.Fatalf("unable to setup static connection simulators: %s", err)
+		if err = frontends.Start(lb); err != nil {
+			fatal(logger, "Unable to start tcp load balancer", err)
+		}
 	}
+	r := &reloader{path: flags.ConfigPath, frontends: &frontends, shared: shared, accessLog: accessLog, log: logger, listed: listed, current: cfg}
 
-	// Await connections until process is terminated.
-	if err = lb.Run(); err != nil {
-		log.Fatalf("error running tcp load balancer: %s", err)
+	// Serve the admin API, which shows the configuration in effect as it is reloaded.
+	var api *admin.Server
+	if cfg.Admin != nil {
+		var auditLog io.Closer
+		api, auditLog, err = newAdmin(cfg, &frontends, func() interface{} { return r.config() }, logger)
+		if err != nil {
+			fatal(logger, "Unable to start admin API", err)
+		}
+		defer auditLog.Close()
+		go func() {
+			if err := api.Serve(); err != nil {
+				logger.Error("Admin API stopped", "error", err)
+			}
+		}()
+		logger.Info("Admin API listening", "address", api.Address())
 	}
+
+	// Actively probe upstream hosts so that unhealthy hosts are detected, and returned to rotation once they recover.
+	var checker *health.Checker
+	if !cfg.HealthCheck.Disabled {
+		checker = health.NewChecker(frontends.Hosts, healthProbe(cfg), healthConfig(cfg))
+		checker.Start()
+	}
+
+	// Await connections until the process is told to stop.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if flags.ConfigPath != "" {
+		go r.watch(ctx)
+	}
+	<-ctx.Done()
+
+	// Restore the default behavior of signals, so that a second signal stops the process immediately.
+	stop()
+	if checker != nil {
+		checker.Stop()
+	}
+
+	shutdownTimeout := time.Duration(r.config().Timeouts.Shutdown)
+	logger.Info("Shutting down, waiting for open connections to finish", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if api != nil {
+		api.Shutdown(shutdownCtx)
+	}
+	if err := frontends.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Shut down before every connection finished", "error", err)
+		return
+	}
+	logger.Info("Shut down")
+}
+
+// fatal logs the error at error level and exits, as log.Fatalf does.
+func fatal(logger *logging.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
 }
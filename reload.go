@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"tcp-load-balancer/internal/accesslog"
+	"tcp-load-balancer/internal/config"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+
+	"github.com/google/uuid"
+)
+
+// reloader applies changes to the configuration file to the running frontends.
+type reloader struct {
+	// path is the path of the configuration file.
+	path string
+
+	// frontends are the running frontends, one for each listener.
+	frontends *server.Frontends
+
+	// shared are the limiters of the frontends without limits of their own.
+	shared limiters
+
+	// accessLog records the connections of every frontend, or is nil if connections are not recorded.
+	accessLog *accesslog.Logger
+
+	// log receives messages about reloads, and is the logger of the frontends which are started.
+	log *logging.Logger
+
+	// listed maps the name of a frontend to the IDs of the hosts it load balances because the configuration lists them.
+	// Its other hosts, such as the demo hosts and hosts added through the admin API, are kept by a reload.
+	listed map[string]map[uuid.UUID]bool
+
+	// current is the configuration in effect.
+	current *config.File
+
+	// mu serializes reloads, and protects current.
+	mu sync.Mutex
+}
+
+// reload reads the configuration file again and applies it to the load balancer. An invalid configuration is
+// rejected, and the configuration in effect is kept.
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := config.Load(r.path)
+	if err != nil {
+		r.log.Error("Rejected configuration, keeping the configuration in effect", "path", r.path, "error", err)
+		return
+	}
+
+	merged, restart := r.current.Reload(next)
+
+	// Everything is prepared before anything is applied, so that a configuration which cannot be applied to one
+	// frontend is not applied to any of them.
+	running := make(map[string]server.Settings)
+	listed := make(map[string]map[uuid.UUID]bool)
+	var started []*server.LoadBalancer
+	for i, listener := range merged.Listeners {
+		lb, ok := r.frontends.Get(listener.Name)
+		if !ok {
+			// The listener is new, or its frontend stopped after its listener failed, so it is started as configured.
+			merged.Listeners[i] = next.Listeners[i]
+			if lb, err = newFrontend(merged, next.Listeners[i], r.shared, server.WithAccessLog(r.accessLog), server.WithLogger(r.log)); err != nil {
+				break
+			}
+			started = append(started, lb)
+			listed[lb.Name()] = hostIDs(lb.Hosts())
+			continue
+		}
+		var s server.Settings
+		if s, err = settings(merged, listener, r.unlisted(lb), lb.Logger()); err != nil {
+			break
+		}
+		running[lb.Name()] = s
+		pool, _ := merged.Pool(listener.Pool)
+		listed[lb.Name()] = hostIDs(s.Hosts[:len(pool.Hosts)])
+	}
+	if err != nil {
+		for _, lb := range started {
+			lb.Shutdown(context.Background())
+		}
+		r.log.Error("Rejected configuration, keeping the configuration in effect", "path", r.path, "error", err)
+		return
+	}
+
+	for name, s := range running {
+		if lb, ok := r.frontends.Get(name); ok {
+			if _, err = lb.Reconfigure(s); err != nil {
+				lb.Logger().Error("Unable to reconfigure frontend", "error", err)
+			}
+		}
+	}
+	for _, lb := range started {
+		if err = r.frontends.Start(lb); err != nil {
+			lb.Shutdown(context.Background())
+			lb.Logger().Error("Unable to start frontend", "error", err)
+		}
+	}
+
+	// Frontends whose listener was removed stop accepting connections, and their open connections may last as long
+	// as those of a drained host.
+	for _, name := range r.frontends.Names() {
+		if _, ok := merged.Listener(name); !ok {
+			r.stop(name, time.Duration(merged.Timeouts.Drain))
+		}
+	}
+
+	r.current = merged
+	r.listed = listed
+	if len(restart) > 0 {
+		r.log.Warn("Some changes take effect after a restart", "changes", strings.Join(restart, ", "))
+	}
+	r.log.Info("Reloaded configuration", "path", r.path)
+}
+
+// unlisted returns the hosts of the running frontend which the configuration does not list, leaving out those which
+// are draining.
+func (r *reloader) unlisted(lb *server.LoadBalancer) []*upstream.TcpHost {
+	var hosts []*upstream.TcpHost
+	for _, h := range lb.Hosts() {
+		if !r.listed[lb.Name()][h.ID()] && !lb.Draining(h) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// hostIDs returns the set of IDs of the hosts.
+func hostIDs(hosts []*upstream.TcpHost) map[uuid.UUID]bool {
+	ids := make(map[uuid.UUID]bool, len(hosts))
+	for _, h := range hosts {
+		ids[h.ID()] = true
+	}
+	return ids
+}
+
+// stop removes the named frontend, and stops it in the background, closing its connections once the timeout
+// passes, if there is one.
+func (r *reloader) stop(name string, timeout time.Duration) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	stopped, err := r.frontends.Remove(ctx, name)
+	if err != nil {
+		cancel()
+		return
+	}
+	r.log.Info("Stopping frontend, its listener was removed", "frontend", name)
+	go func() {
+		defer cancel()
+		if err := <-stopped; err != nil {
+			r.log.Warn("Stopped frontend before every connection finished", "frontend", name, "error", err)
+		}
+	}()
+}
+
+// config returns the configuration in effect.
+func (r *reloader) config() *config.File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// watch reloads the configuration on SIGHUP, or when the configuration file changes, until the context is done.
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// Changes which arrive during a reload are coalesced into a single reload once it finishes.
+	changed := make(chan struct{}, 1)
+	go config.Watch(ctx, r.path, config.ConfigPollInterval, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.log.Info("Received SIGHUP, reloading configuration")
+		case <-changed:
+			r.log.Info("Configuration file changed, reloading configuration")
+		}
+		r.reload()
+	}
+}
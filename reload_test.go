@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tcp-load-balancer/internal/config"
+	"tcp-load-balancer/internal/logging"
+	"tcp-load-balancer/internal/server"
+	"tcp-load-balancer/internal/upstream"
+
+	"github.com/google/uuid"
+)
+
+func TestReloader_reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig := func(hosts string) {
+		config := fmt.Sprintf(`{
+  "listeners": [{"name": "web", "address": "127.0.0.1:0", "pool": "web"}],
+  "pools": [{"name": "web", "hosts": [%s]}]
+}`, hosts)
+		if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(`{"address": "127.0.0.1:8080"}, {"address": "127.0.0.1:8081"}`)
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := logging.New(io.Discard)
+	var frontends server.Frontends
+	defer frontends.Shutdown(context.Background())
+	lb, err := newFrontend(cfg, cfg.Listeners[0], newLimiters(cfg.Limits), server.WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = frontends.Start(lb); err != nil {
+		t.Fatal(err)
+	}
+	r := &reloader{
+		path:      path,
+		frontends: &frontends,
+		shared:    newLimiters(cfg.Limits),
+		log:       logger,
+		listed:    map[string]map[uuid.UUID]bool{"web": hostIDs(lb.Hosts())},
+		current:   cfg,
+	}
+
+	// A host added through the admin API is not in the configuration.
+	added, err := upstream.New("127.0.0.1:9000", "tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lb.AddUpstream(added)
+
+	t.Run("hosts added through the admin API are kept", func(t *testing.T) {
+		writeConfig(`{"address": "127.0.0.1:8080"}`)
+		r.reload()
+		if _, ok := lb.Host(added.ID()); !ok || lb.Draining(added) {
+			t.Error("host added through the admin API was removed by a reload")
+		}
+		removed, _ := upstream.New("127.0.0.1:8081", "tcp")
+		if !eventually(time.Second*5, func() bool { _, ok := lb.Host(removed.ID()); return !ok }) {
+			t.Error("host which is no longer configured was not drained")
+		}
+	})
+
+	t.Run("hosts added through the admin API are managed by the configuration once it lists them", func(t *testing.T) {
+		writeConfig(`{"address": "127.0.0.1:8080"}, {"address": "127.0.0.1:9000", "weight": 3}`)
+		r.reload()
+		if added.Weight() != 3 || lb.Draining(added) {
+			t.Fatalf("host listed by the configuration has weight %d, want 3", added.Weight())
+		}
+
+		writeConfig(`{"address": "127.0.0.1:8080"}`)
+		r.reload()
+		if !eventually(time.Second*5, func() bool { _, ok := lb.Host(added.ID()); return !ok }) {
+			t.Error("host which is no longer configured was not drained")
+		}
+	})
+}
+
+// eventually polls the condition until it returns true or the timeout elapses.
+func eventually(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	return condition()
+}
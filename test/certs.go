@@ -0,0 +1,234 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// certificateValidity controls how long generated certificates remain valid.
+	certificateValidity = time.Hour * 24
+
+	// ServerName is the name that server certificates are issued for, and which clients should verify.
+	ServerName = "localhost"
+)
+
+// CertificateAuthority is a self-signed certificate authority used to issue certificates for tests and demonstrations.
+// Certificates are generated in memory, and only written to disk by PKI.WriteFiles.
+type CertificateAuthority struct {
+	// certificate is the self-signed CA certificate.
+	certificate *x509.Certificate
+
+	// key is the private key used to sign issued certificates.
+	key *ecdsa.PrivateKey
+}
+
+// NewCertificateAuthority generates a new self-signed certificate authority with the given common name.
+func NewCertificateAuthority(commonName string) (*CertificateAuthority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate CA key: %s", err)
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(certificateValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create CA certificate: %s", err)
+	}
+
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse CA certificate: %s", err)
+	}
+
+	return &CertificateAuthority{
+		certificate: certificate,
+		key:         key,
+	}, nil
+}
+
+// Pool returns a certificate pool containing only this certificate authority.
+func (ca *CertificateAuthority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+	return pool
+}
+
+// Issue signs a new certificate built from the given template.
+// The serial number, validity period and key usage are filled in when they are not set on the template.
+func (ca *CertificateAuthority) Issue(template *x509.Certificate) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to generate key: %s", err)
+	}
+
+	if template.SerialNumber == nil {
+		if template.SerialNumber, err = randomSerialNumber(); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Minute)
+	}
+	if template.NotAfter.IsZero() {
+		template.NotAfter = time.Now().Add(certificateValidity)
+	}
+	if template.KeyUsage == 0 {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to create certificate: %s", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("unable to parse certificate: %s", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// IssueServer signs a server certificate valid for ServerName and the loopback addresses.
+func (ca *CertificateAuthority) IssueServer() (tls.Certificate, error) {
+	return ca.Issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: ServerName},
+		DNSNames:    []string{ServerName},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+}
+
+// IssueClient signs a client certificate with the given common name.
+func (ca *CertificateAuthority) IssueClient(commonName string) (tls.Certificate, error) {
+	return ca.Issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// PKI holds the certificates needed to run the load balancer with mTLS alongside the static clients.
+type PKI struct {
+	// ServerCA issues the load balancer's certificate, and is trusted by clients.
+	ServerCA *CertificateAuthority
+
+	// ClientCA issues client certificates, and is trusted by the load balancer.
+	ClientCA *CertificateAuthority
+
+	// ServerCertificate is the certificate presented by the load balancer.
+	ServerCertificate tls.Certificate
+}
+
+// NewPKI generates a server CA, client CA and server certificate for tests and demonstrations.
+func NewPKI() (*PKI, error) {
+	serverCA, err := NewCertificateAuthority("tcp-load-balancer server CA")
+	if err != nil {
+		return nil, err
+	}
+
+	clientCA, err := NewCertificateAuthority("tcp-load-balancer client CA")
+	if err != nil {
+		return nil, err
+	}
+
+	serverCertificate, err := serverCA.IssueServer()
+	if err != nil {
+		return nil, err
+	}
+
+	return &PKI{
+		ServerCA:          serverCA,
+		ClientCA:          clientCA,
+		ServerCertificate: serverCertificate,
+	}, nil
+}
+
+// ClientTLSConfig issues a client certificate with the given common name and returns a TLS config which trusts the server CA.
+func (p *PKI) ClientTLSConfig(commonName string) (*tls.Config, error) {
+	certificate, err := p.ClientCA.IssueClient(commonName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		RootCAs:      p.ServerCA.Pool(),
+		ServerName:   ServerName,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// PKIFiles are the paths of the PEM encoded files written by PKI.WriteFiles.
+type PKIFiles struct {
+	// CertFile and KeyFile hold the server certificate and its private key.
+	CertFile string
+	KeyFile  string
+
+	// ClientCAFile holds the certificate of the client CA.
+	ClientCAFile string
+}
+
+// WriteFiles writes the server certificate, its private key and the client CA certificate to PEM files in dir,
+// for configurations which load certificates from disk.
+func (p *PKI) WriteFiles(dir string) (PKIFiles, error) {
+	files := PKIFiles{
+		CertFile:     filepath.Join(dir, "server.pem"),
+		KeyFile:      filepath.Join(dir, "server-key.pem"),
+		ClientCAFile: filepath.Join(dir, "client-ca.pem"),
+	}
+
+	key, err := x509.MarshalPKCS8PrivateKey(p.ServerCertificate.PrivateKey)
+	if err != nil {
+		return PKIFiles{}, fmt.Errorf("unable to encode server key: %s", err)
+	}
+
+	for path, block := range map[string]*pem.Block{
+		files.CertFile:     {Type: "CERTIFICATE", Bytes: p.ServerCertificate.Certificate[0]},
+		files.KeyFile:      {Type: "PRIVATE KEY", Bytes: key},
+		files.ClientCAFile: {Type: "CERTIFICATE", Bytes: p.ClientCA.certificate.Raw},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			return PKIFiles{}, fmt.Errorf("unable to write %s: %s", path, err)
+		}
+	}
+	return files, nil
+}
+
+// randomSerialNumber returns a random 128 bit certificate serial number.
+func randomSerialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate serial number: %s", err)
+	}
+	return serial, nil
+}
@@ -1,54 +1,65 @@
 package test
 
 import (
-	"log"
+	"crypto/tls"
 	"net"
 	"time"
 
 	"tcp-load-balancer/internal/config"
+	"tcp-load-balancer/internal/logging"
 )
 
 const helloMessage = "Hello"
 
 // InitializeHelloClient is a temporary helper to simulate a client that will connect and pass data to the input address.
 // It will create a new connection as frequent as the clientMessageInterval param, and send a "hello" message each time.
-func InitializeHelloClients(address string, clientMessageInterval time.Duration, numberOfClients int) {
+// When tlsConfig is not nil, clients connect over TLS using the certificates in the config. Every message is logged
+// to logger at debug level.
+func InitializeHelloClients(address string, tlsConfig *tls.Config, clientMessageInterval time.Duration, numberOfClients int, logger *logging.Logger) {
 	for i := 0; i < numberOfClients; i++ {
 		go func() {
 			ticker := time.NewTicker(clientMessageInterval)
 			defer ticker.Stop()
 			for range ticker.C {
 
-				// TODO: In future PR, use DialTLS to connect securely to the LB.
-				conn, err := net.Dial(config.TCPNetwork, address)
+				conn, err := dial(address, tlsConfig)
 				if err != nil {
-					log.Printf("Client was unable to dial: %s", err)
+					logger.Warn("Client was unable to dial", "address", address, "error", err)
 					break
 				}
 
-				log.Printf("Static client at %s sending '%s' to LB address: %s", conn.LocalAddr(), helloMessage, conn.RemoteAddr())
-				SendThenReceive(conn, helloMessage)
+				clientLogger := logger.With("client_address", conn.LocalAddr())
+				clientLogger.Debug("Static client sending message", "message", helloMessage, "address", conn.RemoteAddr())
+				SendThenReceive(conn, helloMessage, clientLogger)
 
 				if err = conn.Close(); err != nil {
-					log.Printf("Client was unable to close: %s", err)
+					clientLogger.Debug("Client was unable to close", "error", err)
 				}
 			}
 		}()
 	}
 }
 
-// SendThenReceive will send a message to the net.Conn and print off the response it receives.
-func SendThenReceive(conn net.Conn, outgoingMessage string) {
+// SendThenReceive will send a message to the net.Conn and log the response it receives at debug level.
+func SendThenReceive(conn net.Conn, outgoingMessage string, logger *logging.Logger) {
 	if _, err := conn.Write([]byte(helloMessage)); err != nil {
-		log.Printf("Client was unable to write: %s", err)
+		logger.Warn("Client was unable to write", "error", err)
 	}
 
 	// TODO: Outside scope of this project, implement strategy for larger messages.
 	data := make([]byte, 2048)
 	n, err := conn.Read(data)
 	if err != nil {
-		log.Printf("client had error reading data: %s", err)
+		logger.Warn("Client had error reading data", "error", err)
 	} else {
-		log.Printf("Client at %s received response: %s ", conn.LocalAddr(), string(data[:n]))
+		logger.Debug("Client received response", "response", string(data[:n]))
 	}
 }
+
+// dial connects to the address, over TLS when tlsConfig is not nil.
+func dial(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig == nil {
+		return net.Dial(config.TCPNetwork, address)
+	}
+	return tls.Dial(config.TCPNetwork, address, tlsConfig)
+}
@@ -3,51 +3,129 @@ package test
 import (
 	"fmt"
 	"io"
-	"log"
 	"net"
+	"sync"
+
+	"tcp-load-balancer/internal/logging"
 )
 
-// InitializeHost is a temporary helper to simulate an upstream host that respond to acknowledge the data it received.
-func InitializeHost(tcpNetwork, address string) (net.Listener, error) {
-	h, err := net.Listen(tcpNetwork, address)
+// Host is a temporary helper to simulate an upstream host that responds to acknowledge the data it received.
+// It can be told to refuse connections, which allows health checking to be tested.
+type Host struct {
+	// network and addr are where the host listens. The address is kept so the host can listen again after refusing connections.
+	network string
+	addr    net.Addr
+
+	// listener accepts connections. It is nil while the host is refusing connections.
+	listener net.Listener
+
+	// mu protects listener from concurrent access.
+	mu sync.Mutex
+
+	// log receives messages about the host and the data it receives. Nil means the default logger.
+	log *logging.Logger
+}
+
+// HostOption configures optional behavior of a Host during InitializeHost.
+type HostOption func(*Host)
+
+// WithLogger sets the logger which receives messages about the host. Every message the host receives is logged at
+// debug level.
+func WithLogger(logger *logging.Logger) HostOption {
+	return func(h *Host) {
+		h.log = logger
+	}
+}
+
+// InitializeHost starts a Host listening on the address.
+func InitializeHost(tcpNetwork, address string, opts ...HostOption) (*Host, error) {
+	ln, err := net.Listen(tcpNetwork, address)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("Statically defined host listening on %s", h.Addr())
+	h := &Host{
+		network:  tcpNetwork,
+		addr:     ln.Addr(),
+		listener: ln,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.log = h.log.With("test_host", ln.Addr())
+	h.log.Info("Statically defined host listening")
+	go h.accept(ln)
 
-	go func() {
-		// In a goroutine, continuously accept connections.
-		for {
-			// TODO: In the PR which includes health checks, set up some interval or predictable/controllable behavior where a host will not accept connection so that we can test the health checking process.
-			conn, err := h.Accept()
-			if err != nil {
-				log.Printf("host was unable to accept incoming connection: %s", err)
-				return
-			}
-			go func() {
-				for {
-					// Continue reading from the established connection until the client closes the connection (resulting in EOF).
-					// TODO: Outside scope of this project, implement strategy for larger messages.
-					data := make([]byte, 2048)
-					n, err := conn.Read(data)
-					if err != nil {
-						if err != io.EOF {
-							log.Printf("error reading data: %s", err)
-						}
-						return
-					}
+	return h, nil
+}
+
+// Addr returns the address the host listens on, even while it is refusing connections.
+func (h *Host) Addr() net.Addr {
+	return h.addr
+}
 
-					// TODO: ensure input data is sanitized.
-					_, err = conn.Write([]byte(fmt.Sprintf("Data '%s' was received by host at %s\n", data[:n], h.Addr())))
-					if err != nil {
-						log.Printf("error writing response: %s", err)
-						return
+// RefuseConnections controls whether the host refuses new connections. While refusing, the host stops
+// listening, so connection attempts fail as they would for a host that is down. Established connections are unaffected.
+func (h *Host) RefuseConnections(refuse bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if refuse {
+		if h.listener == nil {
+			return nil
+		}
+		err := h.listener.Close()
+		h.listener = nil
+		return err
+	}
+
+	if h.listener != nil {
+		return nil
+	}
+	ln, err := net.Listen(h.network, h.addr.String())
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s again: %s", h.addr, err)
+	}
+	h.listener = ln
+	go h.accept(ln)
+
+	return nil
+}
+
+// Close stops the host from accepting connections.
+func (h *Host) Close() error {
+	return h.RefuseConnections(true)
+}
+
+// accept continuously accepts connections until the listener is closed.
+func (h *Host) accept(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			h.log.Debug("Host stopped accepting connections", "error", err)
+			return
+		}
+		go func() {
+			for {
+				// Continue reading from the established connection until the client closes the connection (resulting in EOF).
+				// TODO: Outside scope of this project, implement strategy for larger messages.
+				data := make([]byte, 2048)
+				n, err := conn.Read(data)
+				if err != nil {
+					if err != io.EOF {
+						h.log.Debug("Host had error reading data", "error", err)
 					}
+					return
 				}
-			}()
-		}
-	}()
+				h.log.Debug("Host received data", "data", string(data[:n]), "client_address", conn.RemoteAddr())
 
-	return h, nil
+				// TODO: ensure input data is sanitized.
+				_, err = conn.Write([]byte(fmt.Sprintf("Data '%s' was received by host at %s\n", data[:n], h.addr)))
+				if err != nil {
+					h.log.Debug("Host had error writing response", "error", err)
+					return
+				}
+			}
+		}()
+	}
 }
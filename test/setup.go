@@ -7,6 +7,7 @@ package test
 ////////////////////////////////////////////////////////////////////////////////////////////////////
 
 import (
+	"crypto/tls"
 	"time"
 
 	"tcp-load-balancer/internal/config"
@@ -15,7 +16,8 @@ import (
 )
 
 // Setup configures upstream hosts and downstream clients to demonstrate functionality.
-func Setup(l *server.LoadBalancer, numberOfHosts int, numberOfClients int, clientMessageInterval time.Duration) error {
+// Clients use clientTLSConfig to connect, which should be nil when the load balancer does not terminate TLS.
+func Setup(l *server.LoadBalancer, clientTLSConfig *tls.Config, numberOfHosts int, numberOfClients int, clientMessageInterval time.Duration) error {
 
 	// TODO: Implement a non-static method for registering upstream hosts (outside the scope of this challenge).
 	if err := RegisterUpstreamHosts(l, numberOfHosts); err != nil {
@@ -23,7 +25,7 @@ func Setup(l *server.LoadBalancer, numberOfHosts int, numberOfClients int, clien
 	}
 
 	// TODO: Implement a non-static method for connecting clients (outside the scope of this challenge).
-	InitializeHelloClients(l.Address().String(), clientMessageInterval, numberOfClients)
+	InitializeHelloClients(l.Address().String(), clientTLSConfig, clientMessageInterval, numberOfClients, l.Logger())
 
 	return nil
 }
@@ -31,11 +33,11 @@ func Setup(l *server.LoadBalancer, numberOfHosts int, numberOfClients int, clien
 // RegisterUpstreamHosts adds n static hosts to the load balancer for testing and demonstration purposes.
 func RegisterUpstreamHosts(l *server.LoadBalancer, n int) error {
 	for i := 0; i < n; i++ {
-		h, err := InitializeHost(l.Address().Network(), config.SelectOpenPort)
+		h, err := InitializeHost(l.Address().Network(), config.SelectOpenPort, WithLogger(l.Logger()))
 		if err != nil {
 			return err
 		}
-		u, err := upstream.New(h.Addr().String(), l.Address().Network())
+		u, err := upstream.New(h.Addr().String(), l.Address().Network(), upstream.WithLogger(l.Logger()))
 		if err != nil {
 			return err
 		}